@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"github.com/spf13/pflag"
+
+	qrbackup "perfect-gpg-keypair/internal/qr_backup"
+	shamir "perfect-gpg-keypair/internal/shamir"
+	batchspec "perfect-gpg-keypair/internal/state/batch_spec"
+)
+
+// addOutputFlags adds the flags for the directory the exported keys are saved to
+// and for the passphrase in batch mode
+func addOutputFlags(flags *pflag.FlagSet, spec *batchspec.BatchSpec) {
+	flags.StringVar(&spec.OutputDir, "output-dir", "", "directory the exported keys are saved to (asked for interactively if not set)")
+	flags.BoolVar(&spec.PaperBackup, "paper-backup", false, "also export the master secret as a printable paper backup (text and HTML)")
+	flags.StringVar(&spec.QRBackup, "qr-backup", "", "also export the master secret and the revocation certificate as QR codes (armored|paperkey)")
+	flags.StringVar(&spec.QRFormat, "qr-format", "", "image format of the QR codes (png|svg, default "+string(qrbackup.DefaultFormat)+")")
+	flags.IntVar(&spec.ShamirShares, "shamir-shares", 0, "also split the master secret (or its passphrase) into this many shares")
+	flags.IntVar(&spec.ShamirThreshold, "shamir-threshold", 0, "number of shares needed to recover the secret")
+	flags.StringVar(&spec.ShamirSecret, "shamir-secret", "", "secret to split into shares (private-master|passphrase, default "+string(shamir.DefaultSecret)+")")
+	flags.StringVar(&spec.ShamirDir, "shamir-dir", "", "directory the shares are saved to, one directory per share (asked for interactively if not set)")
+	flags.BoolVar(&spec.Bundle, "bundle", false, "also pack the exported keys into a single archive, encrypted with a separate passphrase")
+	addBundlePassphraseFlags(flags, spec)
+	addPassphraseFlags(flags, spec)
+}
+
+// addPassphraseFlags adds the flags for reading the passphrase in batch mode
+func addPassphraseFlags(flags *pflag.FlagSet, spec *batchspec.BatchSpec) {
+	flags.StringVar(&spec.PassphraseFile, "passphrase-file", "", "file containing the passphrase (batch mode)")
+	flags.StringVar(&spec.PassphraseEnv, "passphrase-env", "", "environment variable containing the passphrase (batch mode)")
+}
+
+// addBundlePassphraseFlags adds the flags for reading the passphrase of the backup bundle in batch mode
+func addBundlePassphraseFlags(flags *pflag.FlagSet, spec *batchspec.BatchSpec) {
+	flags.StringVar(&spec.BundlePassphraseFile, "bundle-passphrase-file", "", "file containing the passphrase of the backup bundle (batch mode)")
+	flags.StringVar(&spec.BundlePassphraseEnv, "bundle-passphrase-env", "", "environment variable containing the passphrase of the backup bundle (batch mode)")
+}
@@ -3,92 +3,309 @@ package cmd
 import (
 	"errors"
 	"fmt"
-	"os"
 	"perfect-gpg-keypair/internal/utils"
+	"strings"
 
 	logger "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	runrecord "perfect-gpg-keypair/internal/run_record"
 	state "perfect-gpg-keypair/internal/state"
+	batchspec "perfect-gpg-keypair/internal/state/batch_spec"
+	keyalgorithm "perfect-gpg-keypair/internal/state/key_algorithm"
+	userinfo "perfect-gpg-keypair/internal/state/user_info"
+	tmpdir "perfect-gpg-keypair/internal/tmp_dir"
+	"perfect-gpg-keypair/internal/wipe"
 )
 
-func NewGenerateCmd() *cobra.Command {
+func NewGenerateCmd(runner utils.GpgRunner) *cobra.Command {
 	var debug bool
+	var isolated bool
+	var batch bool
+	var specFilePath string
+	var abortedRun string
+	var resumeDir string
+	var flagSpec batchspec.BatchSpec
 	generateCmd := &cobra.Command{
 		Use:   "generate",
 		Short: "generate a GPG keypair along with a separate signing subkey",
-		Args:  cobra.NoArgs,
+		Long: "generate a GPG keypair along with a separate signing subkey\n\n" +
+			"By default all information is asked for interactively. With --batch (or --spec) no user interaction\n" +
+			"takes place and all information is taken from the flags and/or the YAML spec file, e.g.:\n\n" +
+			"  name: Jane Doe\n" +
+			"  email: jane@example.com\n" +
+			"  expiry: 1y\n" +
+			"  algorithm: ed25519\n" +
+			"  output_dir: /mnt/backup/gpg\n" +
+			"  passphrase_file: /run/secrets/gpg-passphrase\n\n" +
+			"Flags take precedence over values in the spec file.",
+		Args: cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			mainState := state.NewState(debug)
-			err := generate(&mainState)
-			cleanup(&mainState, debug)
+			if flagSpec.RevocationReason != "" {
+				if _, err := utils.ParseRevocationReason(flagSpec.RevocationReason); err != nil {
+					utils.ExitProgram(err)
+				}
+			}
+			if flagSpec.Algorithm != "" {
+				if _, err := keyalgorithm.GetProfile(flagSpec.Algorithm); err != nil {
+					utils.ExitProgram(err)
+				}
+			}
+			recoveryAction, err := state.ParseRecoveryAction(abortedRun)
+			if err != nil {
+				utils.ExitProgram(err)
+			}
+			mainState := state.NewState(debug, runner)
+			mainState.Isolated = isolated
+			if batch || specFilePath != "" {
+				spec, err := getBatchSpec(specFilePath, flagSpec, cmd.Flags().Changed)
+				if err != nil {
+					utils.ExitProgram(utils.InvalidBatchConfigError(err.Error()))
+				}
+				// a resumed run takes the key and the output options from its journal, it only needs the passphrases
+				if resumeDir != "" {
+					err = mainState.SetResumeFromBatchSpec(spec)
+				} else {
+					err = mainState.SetFromBatchSpec(spec)
+				}
+				if err != nil {
+					utils.ExitProgram(utils.InvalidBatchConfigError(err.Error()))
+				}
+			} else if err := mainState.SetOutputOptions(flagSpec); err != nil {
+				utils.ExitProgram(err)
+			}
+			removeShutdownHook := utils.OnShutdown("clean up generate", func() {
+				cleanup(&mainState, debug)
+				closeRunRecord(&mainState, false)
+			})
+			err = runGenerate(&mainState, flagSpec, recoveryAction, resumeDir)
+			removeShutdownHook()
+			interrupt := &utils.UserInterrupt{}
+			keepTmpDir := err != nil && !errors.As(err, &interrupt) && state.CanResume(mainState.TmpDir)
+			if keepTmpDir {
+				mainState.StopIsolatedKeyring()
+				utils.WarningPrint(fmt.Sprintf(
+					"The temporary directory '%s' is kept, it holds the keys generated so far!\n"+
+						"Resume with 'generate --resume %s' after fixing the error, or run 'generate' again to roll back.",
+					mainState.TmpDir.Path(), mainState.TmpDir.Path(),
+				))
+			} else {
+				cleanup(&mainState, debug)
+			}
 			if err != nil {
-				handleError(err)
+				closeRunRecord(&mainState, keepTmpDir)
+				utils.ExitProgram(err)
+			}
+			if err := runrecord.Remove(); err != nil {
+				logger.Debugf("could not remove run record: %s\n", err)
 			}
 		},
 	}
 
 	// add flags
 	generateCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "debug mode (affects path of tmp dir)")
+	generateCmd.PersistentFlags().StringVarP(
+		&flagSpec.Algorithm, "algorithm", "a", "",
+		fmt.Sprintf("key algorithm profile (%s), asked for interactively if not set", strings.Join(keyalgorithm.ProfileNames(), ", ")),
+	)
+	generateCmd.PersistentFlags().BoolVar(
+		&isolated, "isolated", false,
+		"generate the master key in a throwaway GNUPGHOME and only import the public key and signing subkey into your keyring",
+	)
+	generateCmd.PersistentFlags().StringVar(&flagSpec.SigningAlgorithm, "signing-algorithm", "", "algorithm of the signing subkey (default: from algorithm profile)")
+	generateCmd.PersistentFlags().StringVar(&flagSpec.SigningExpiry, "signing-expiry", "", "expiry of the signing subkey (default: master key expiry)")
+	generateCmd.PersistentFlags().StringVar(&flagSpec.EncryptionAlgorithm, "encryption-algorithm", "", "algorithm of the encryption subkey (default: from algorithm profile)")
+	generateCmd.PersistentFlags().StringVar(&flagSpec.EncryptionExpiry, "encryption-expiry", "", "expiry of the encryption subkey (default: master key expiry)")
+	generateCmd.PersistentFlags().BoolVar(&flagSpec.AuthenticationSubkey, "authentication-subkey", false, "add an authentication subkey (e.g. for SSH)")
+	generateCmd.PersistentFlags().StringVar(&flagSpec.AuthenticationAlgorithm, "authentication-algorithm", "", "algorithm of the authentication subkey (default: from algorithm profile)")
+	generateCmd.PersistentFlags().StringVar(&flagSpec.AuthenticationExpiry, "authentication-expiry", "", "expiry of the authentication subkey (default: master key expiry)")
+	generateCmd.PersistentFlags().StringVar(
+		&flagSpec.RevocationReason, "revocation-reason", "",
+		fmt.Sprintf("reason of the revocation certificate (%s, default: %s)", strings.Join(utils.RevocationReasonNames(), ", "), userinfo.DefaultRevocationReason),
+	)
+	generateCmd.PersistentFlags().StringVar(&flagSpec.RevocationDescription, "revocation-description", "", "description of the revocation certificate")
+	generateCmd.PersistentFlags().BoolVar(&flagSpec.AllRevocationReasons, "all-revocation-reasons", false, "create one revocation certificate per reason")
+	generateCmd.PersistentFlags().BoolVar(&batch, "batch", false, "run without any user interaction")
+	generateCmd.PersistentFlags().StringVar(&specFilePath, "spec", "", "YAML spec file for batch mode (implies --batch)")
+	generateCmd.PersistentFlags().StringVar(&flagSpec.Name, "name", "", "full name (batch mode)")
+	generateCmd.PersistentFlags().StringVar(&flagSpec.Email, "email", "", "email address (batch mode)")
+	generateCmd.PersistentFlags().StringVar(&flagSpec.Expiry, "expiry", "", "expiry of the keys as '<n>w|m|y' or 0 (batch mode, default 1y)")
+	generateCmd.PersistentFlags().StringVar(
+		&abortedRun, "aborted-run", "",
+		"what to do with an aborted run: resume it, finish (back up and remove the master key left in your keyring) or rollback (delete it), asked for if not set",
+	)
+	generateCmd.PersistentFlags().StringVar(&resumeDir, "resume", "", "resume a failed run from its temporary directory, skipping the steps it completed")
+	addOutputFlags(generateCmd.PersistentFlags(), &flagSpec)
 	return generateCmd
 }
 
-func cleanup(mainState *state.State, debug bool) {
-	logger.Debugln("removing temporary exported keys directory")
-	err := os.RemoveAll(mainState.TmpDir.ExportedKeysDirPath())
+// getBatchSpec loads the spec file, if any, and overrides its values with the flags that were set
+func getBatchSpec(specFilePath string, flagSpec batchspec.BatchSpec, isSet func(flag string) bool) (batchspec.BatchSpec, error) {
+	if specFilePath == "" {
+		return flagSpec, nil
+	}
+	spec, err := batchspec.Load(specFilePath)
 	if err != nil {
-		logger.Errorf(
-			"Failed to remove temporary files at '%s'."+
+		return spec, err
+	}
+	return spec.Override(flagSpec, isSet), nil
+}
+
+func cleanup(mainState *state.State, debug bool) {
+	mainState.StopIsolatedKeyring()
+	logger.Debugln("wiping temporary exported keys directory")
+	if report := wipe.Dir(mainState.TmpDir.ExportedKeysDirPath()); !report.OK() {
+		logger.Debugln(report.Error())
+		utils.ErrorPrint(fmt.Sprintf(
+			"Failed to wipe temporary files at '%s':\n%s\n"+
 				"These files contain information about your keys and should be deleted "+
-				"if you intend to use the generated keys!\n", mainState.TmpDir.Path(),
-		)
+				"if you intend to use the generated keys!", mainState.TmpDir.Path(), failedPaths(report),
+		))
 	}
 	// Keep tmp dir after run for debug runs:
 	if !debug {
-		logger.Debugln("removing temporary directory")
-		err := os.RemoveAll(mainState.TmpDir.Path())
+		logger.Debugln("wiping temporary directory")
+		if report := wipe.Dir(mainState.TmpDir.Path()); !report.OK() {
+			logger.Debugln(report.Error())
+			utils.WarningPrint(fmt.Sprintf(
+				"Could not wipe all files of the temporary directory at '%s':\n%s", mainState.TmpDir.Path(), failedPaths(report),
+			))
+		}
+	}
+}
+
+func failedPaths(report wipe.Report) string {
+	paths := make([]string, len(report.Failed))
+	for i, failed := range report.Failed {
+		paths[i] = "  " + failed.Path
+	}
+	return strings.Join(paths, "\n")
+}
+
+// runGenerate deals with what an aborted previous run left behind, then generates a new key or resumes a failed run
+func runGenerate(mainState *state.State, flags batchspec.BatchSpec, action state.RecoveryAction, resumeDir string) error {
+	record, found, err := runrecord.Load()
+	if err != nil {
+		return err
+	}
+	if found && record.IsRunning() {
+		return fmt.Errorf("another run of generate (pid %d) is in progress", record.PID)
+	}
+	if found && resumeDir == "" {
+		taken, err := mainState.RecoverAbortedRun(record, action)
 		if err != nil {
-			logger.Errorf("could not remove temporary directory at '%s'", mainState.TmpDir.Path())
+			return err
+		}
+		switch taken {
+		case state.Finish:
+			return nil
+		case state.Resume:
+			resumeDir = record.TmpDir
 		}
 	}
+	if resumeDir == "" {
+		startRunRecord(mainState)
+		return generate(mainState, flags)
+	}
+
+	tmpDir, err := tmpdir.OpenTmpDir(resumeDir)
+	if err != nil {
+		return fmt.Errorf("could not open the temporary directory to resume: %w", err)
+	}
+	if found && record.TmpDir != tmpDir.Path() {
+		return fmt.Errorf("another run was aborted at '%s', run 'generate' without --resume to deal with it first", record.TmpDir)
+	}
+	journal, err := tmpDir.ReadJournal()
+	if err != nil {
+		return err
+	}
+	mainState.TmpDir = tmpDir
+	mainState.Isolated = journal.Isolated
+	startRunRecord(mainState)
+	return resume(mainState, tmpDir)
 }
 
-func handleError(err error) {
-	interrupt := &utils.UserInterrupt{}
-	if errors.As(err, &interrupt) {
-		fmt.Printf("SIGINT: %s\n", err.Error())
-		os.Exit(130)
-	} else {
-		utils.ExitProgram(err.Error())
+// startRunRecord starts recording the progress of this run, so that it can be finished, rolled back or resumed if aborted
+func startRunRecord(mainState *state.State) {
+	gnupgHome := ""
+	if mainState.Isolated {
+		gnupgHome = mainState.TmpDir.GnupgHomePath()
+	}
+	progress := runrecord.New(mainState.TmpDir.Path(), gnupgHome)
+	progress.OutputDir = mainState.OutputDir
+	if err := progress.Save(); err != nil {
+		utils.WarningPrint(fmt.Sprintf("Could not record the progress of this run, it can not be recovered if aborted: %s", err))
+		return
 	}
+	mainState.Progress = &progress
 }
 
-func generate(mainState *state.State) error {
-	// TODO: Add output path argument?
-	if err := utils.CheckGpgIsInstalled(); err != nil {
-		return fmt.Errorf("gpg command could not be found: %w", err)
+// closeRunRecord keeps the record of an unfinished run only if it left the master key in the default keyring
+// or its temporary directory is kept, so that the next run offers to resume, finish or roll it back
+func closeRunRecord(mainState *state.State, keepTmpDir bool) {
+	if mainState.Progress == nil || keepTmpDir {
+		return
 	}
+	if mainState.Progress.NeedsRecovery() {
+		utils.WarningPrint(fmt.Sprintf(
+			"The master key '%s' may still be in your keyring! Run 'generate' again to finish or roll back this run.",
+			mainState.Progress.Fingerprint,
+		))
+		return
+	}
+	if err := runrecord.Remove(); err != nil {
+		logger.Debugf("could not remove run record: %s\n", err)
+	}
+}
 
-	utils.InfoPrint(
-		"Welcome! This program will follow you through the process of generating a secure GPG keypair.\n" +
-			"The program will generate a master keypair (public and private keys) that should be stored in a safe place.\n" +
-			"In addition, the program will generate a signing subkey to use for this computer.\n" +
-			"Finally, the program will remove the master keypair (after ensuring they are backed up!) and import the " +
-			"signing subkey so that the master key can not be obtained from this computer." +
-			"At any time you can press C-c or Esc to quit the program.",
-	)
+func resume(mainState *state.State, tmpDir tmpdir.TmpDir) error {
+	if err := mainState.CheckGpg(); err != nil {
+		return err
+	}
+	if err := mainState.ResumeGeneration(tmpDir); err != nil {
+		return fmt.Errorf("could not resume generating GPG keys: %w", err)
+	}
+	printGitConfigHint(mainState)
+	return nil
+}
+
+func generate(mainState *state.State, flags batchspec.BatchSpec) error {
+	if err := mainState.CheckGpg(); err != nil {
+		return err
+	}
+
+	if !mainState.Batch {
+		utils.InfoPrint(
+			"Welcome! This program will follow you through the process of generating a secure GPG keypair.\n" +
+				"The program will generate a master keypair (public and private keys) that should be stored in a safe place.\n" +
+				"In addition, the program will generate a signing subkey to use for this computer.\n" +
+				"Finally, the program will remove the master keypair (after ensuring they are backed up!) and import the " +
+				"signing subkey so that the master key can not be obtained from this computer." +
+				"At any time you can press C-c or Esc to quit the program.",
+		)
+	}
 
 	// Create temp dir
 	if err := mainState.TmpDir.Create(); err != nil {
 		return fmt.Errorf("could not create temporary directory: %w", err)
 	}
+	if mainState.Isolated {
+		if err := mainState.CreateIsolatedKeyring(); err != nil {
+			return fmt.Errorf("could not create temporary keyring: %w", err)
+		}
+	}
 
 	// Set info from user input
-	utils.InfoPrint("In order to generate a GPG keypair, we need some information about you")
-	if err := mainState.SetUserInfoFromInput(); err != nil {
-		if err == err.(*utils.UserInterrupt) {
-			return err
-		} else {
+	if mainState.Batch {
+		utils.InfoPrint("Generating a GPG keypair for:")
+		utils.PrintHiddenBorder(mainState.UserInfo.String())
+	} else {
+		utils.InfoPrint("In order to generate a GPG keypair, we need some information about you")
+		if err := mainState.SetUserInfoFromInput(flags); err != nil {
+			interrupt := &utils.UserInterrupt{}
+			if errors.As(err, &interrupt) {
+				return err
+			}
 			return fmt.Errorf("could not get user input: %w", err)
 		}
 	}
@@ -103,12 +320,16 @@ func generate(mainState *state.State) error {
 		return fmt.Errorf("could not generate GPG keys: %w", err)
 	}
 
+	printGitConfigHint(mainState)
+	return nil
+}
+
+func printGitConfigHint(mainState *state.State) {
 	utils.InfoPrint(
 		"You may now want to add the signing key to your git config\n" +
 			"This can be done with the following command in a git repository:\n" +
 			"  'git config user.signingkey [key_id]'\n" +
 			"Add '--global' to use the signing subkey globally " +
-			"the key_id to use is the 16 hex digits after 'sec#  rsa4096/'",
+			fmt.Sprintf("the key_id to use is the 16 hex digits after 'sec#  %s/'", mainState.UserInfo.Algorithm.Master.Name()),
 	)
-	return nil
 }
@@ -1,23 +1,44 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
 	"perfect-gpg-keypair/internal/utils"
+	"slices"
+	"strings"
 
 	"github.com/spf13/cobra"
+
+	keylist "perfect-gpg-keypair/internal/key_list"
 )
 
-func NewListCmd() *cobra.Command {
+func NewListCmd(runner utils.GpgRunner) *cobra.Command {
 	var longFormat bool
 	var secret bool
+	var output string
 	listCmd := &cobra.Command{
 		Use:     "list",
 		Aliases: []string{"ls"},
 		Short:   "list all existing public GPG keys",
 		Args:    cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			format := getFormat(longFormat)
-			if err := utils.ListKeys(secret, format, ""); err != nil {
-				utils.ExitProgram("Failed to list gpg keys: " + err.Error())
+			keyring := utils.Keyring{Runner: runner}
+			if output == "" {
+				format := getFormat(longFormat)
+				if err := keyring.ListKeys(secret, format, ""); err != nil {
+					utils.ExitProgram(fmt.Errorf("Failed to list gpg keys: %w", err))
+				}
+				return
+			}
+			if !slices.Contains(keylist.Formats, output) {
+				utils.ExitProgram(utils.InvalidOutputFormatError(fmt.Sprintf("'%s', must be one of: %s", output, strings.Join(keylist.Formats, ", "))))
+			}
+			keys, err := keyring.GetKeys(secret, "")
+			if err != nil {
+				utils.ExitProgram(fmt.Errorf("Failed to list gpg keys: %w", err))
+			}
+			if err := keylist.Write(os.Stdout, keys, output, longFormat); err != nil {
+				utils.ExitProgram(fmt.Errorf("Failed to write gpg keys: %w", err))
 			}
 		},
 	}
@@ -25,6 +46,10 @@ func NewListCmd() *cobra.Command {
 	// add flags
 	listCmd.PersistentFlags().BoolVar(&longFormat, "long", false, "use long key format")
 	listCmd.PersistentFlags().BoolVar(&secret, "secret", false, "list secret keys")
+	listCmd.PersistentFlags().StringVarP(
+		&output, "output", "o", "",
+		fmt.Sprintf("output format (%s), defaults to the output of gpg", strings.Join(keylist.Formats, ", ")),
+	)
 	return listCmd
 }
 
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"perfect-gpg-keypair/internal/utils"
+
+	"github.com/spf13/cobra"
+
+	shamir "perfect-gpg-keypair/internal/shamir"
+)
+
+func NewRecoverCmd() *cobra.Command {
+	var outputFilepath string
+	recoverCmd := &cobra.Command{
+		Use:   "recover <share file> <share file> ...",
+		Short: "recombine shares into the secret master key or its passphrase",
+		Long: "recombine shares into the secret master key or its passphrase\n\n" +
+			"  recover <share file> <share file> ... [--output <file>]\n" +
+			"    recombines at least as many shares as the threshold written in each share file.\n" +
+			"    A recovered secret master key can be imported with 'gpg --import', a recovered passphrase is written\n" +
+			"    to the output file instead of being printed.",
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := recoverFromShares(args, outputFilepath); err != nil {
+				utils.ExitProgram(fmt.Errorf("could not recover secret: %w", err))
+			}
+		},
+	}
+
+	// add flags
+	recoverCmd.PersistentFlags().StringVarP(&outputFilepath, "output", "o", "", "file the recovered secret is written to (default 'restored-private-master.asc' or 'recovered-passphrase.txt')")
+	return recoverCmd
+}
+
+func recoverFromShares(shareFilePaths []string, outputFilepath string) error {
+	shareFiles := []shamir.ShareFile{}
+	for _, shareFilePath := range shareFilePaths {
+		shareFile, err := shamir.ReadShareFile(shareFilePath)
+		if err != nil {
+			return err
+		}
+		shareFiles = append(shareFiles, shareFile)
+	}
+	if outputFilepath == "" {
+		outputFilepath = "restored-private-master.asc"
+		if shareFiles[0].Secret == shamir.Passphrase {
+			outputFilepath = "recovered-passphrase.txt"
+		}
+	}
+	if err := ensureNotExists(outputFilepath); err != nil {
+		return err
+	}
+	secret, err := shamir.Recover(shareFiles)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputFilepath, secret, 0600); err != nil {
+		return err
+	}
+	if shareFiles[0].Secret == shamir.Passphrase {
+		utils.InfoPrint(fmt.Sprintf("Recovered the passphrase of '%s' to '%s'", shareFiles[0].Fingerprint, outputFilepath))
+		return nil
+	}
+	utils.InfoPrint(fmt.Sprintf(
+		"Recovered the secret key '%s' to '%s'\nImport it with 'gpg --import %s', or use it with 'renew', 'rotate-subkey' or 'revoke'",
+		shareFiles[0].Fingerprint, outputFilepath, outputFilepath,
+	))
+	return nil
+}
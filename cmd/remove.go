@@ -8,7 +8,7 @@ import (
 	"github.com/spf13/cobra"
 )
 
-func NewRemoveCmd() *cobra.Command {
+func NewRemoveCmd(runner utils.GpgRunner) *cobra.Command {
 	var force bool
 	deleteCmd := &cobra.Command{
 		Use:     "delete",
@@ -20,12 +20,12 @@ func NewRemoveCmd() *cobra.Command {
 
 			err := validateFingerprint(fingerprint)
 			if err != nil {
-				utils.ExitProgram("invalid fingerprint: " + err.Error())
+				utils.ExitProgram(err)
 			}
 
-			err = remove(fingerprint, force)
+			err = remove(utils.Keyring{Runner: runner}, fingerprint, force)
 			if err != nil {
-				utils.ExitProgram("could not delete gpg key: " + err.Error())
+				utils.ExitProgram(fmt.Errorf("could not delete gpg key: %w", err))
 			}
 			utils.InfoPrint(fmt.Sprintf("successfully removed key '%s'", fingerprint))
 		},
@@ -36,7 +36,7 @@ func NewRemoveCmd() *cobra.Command {
 	return deleteCmd
 }
 
-func remove(fingerprint string, force bool) error {
+func remove(keyring utils.Keyring, fingerprint string, force bool) error {
 	if !force {
 		confirmMsg := fmt.Sprintf("Are you really sure you want to delete the key with fingerprint '%s'", fingerprint)
 		confirmDelete, err := confirm.Confirm(confirmMsg)
@@ -47,12 +47,12 @@ func remove(fingerprint string, force bool) error {
 			return nil
 		}
 	}
-	return utils.DeleteEntireKey(fingerprint)
+	return keyring.DeleteEntireKey(fingerprint)
 }
 
 func validateFingerprint(fingerprint string) error {
 	if len(fingerprint) != 40 {
-		return fmt.Errorf("must have length of 40")
+		return utils.InvalidFingerprintError("must have length of 40")
 	}
 	return nil
 }
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"perfect-gpg-keypair/internal/utils"
+
+	"github.com/spf13/cobra"
+
+	state "perfect-gpg-keypair/internal/state"
+	batchspec "perfect-gpg-keypair/internal/state/batch_spec"
+	userinfo "perfect-gpg-keypair/internal/state/user_info"
+)
+
+func NewRenewCmd(runner utils.GpgRunner) *cobra.Command {
+	var debug bool
+	var batch bool
+	var expiry string
+	var subkeys []string
+	var flagSpec batchspec.BatchSpec
+	renewCmd := &cobra.Command{
+		Use:   "renew <private-master-key-backup>",
+		Short: "extend the expiry of the master key and its subkeys from a backup",
+		Long: "extend the expiry of the master key and its subkeys from a backup\n\n" +
+			"The backup of the private master key (e.g. '.private-master.gpg') is imported into a throwaway keyring,\n" +
+			"where the expiry of the master key and the selected subkeys (all that are not revoked by default) is extended.\n" +
+			"The updated keys are exported for backup again and the updated public key is imported into your keyring,\n" +
+			"the master secret never touches your keyring.",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := utils.ValidateExpiry(expiry); err != nil {
+				utils.ExitProgram(err)
+			}
+			mainState := state.NewState(debug, runner)
+			if batch {
+				if err := mainState.SetBackupFromBatchSpec(flagSpec); err != nil {
+					utils.ExitProgram(utils.InvalidBatchConfigError(err.Error()))
+				}
+			} else if err := mainState.SetOutputOptions(flagSpec); err != nil {
+				utils.ExitProgram(err)
+			}
+			err := renew(&mainState, args[0], expiry, subkeys)
+			cleanup(&mainState, debug)
+			if err != nil {
+				utils.ExitProgram(err)
+			}
+		},
+	}
+
+	// add flags
+	renewCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "debug mode (affects path of tmp dir)")
+	renewCmd.PersistentFlags().StringVar(&expiry, "expiry", userinfo.DefaultExpiry, "new expiry of the keys as '<n>w|m|y' from now or 0")
+	renewCmd.PersistentFlags().StringArrayVar(&subkeys, "subkey", nil, "fingerprint or key id of a subkey to renew (repeatable, default: all subkeys that are not revoked)")
+	renewCmd.PersistentFlags().BoolVar(&batch, "batch", false, "run without any user interaction")
+	addOutputFlags(renewCmd.PersistentFlags(), &flagSpec)
+	return renewCmd
+}
+
+func renew(mainState *state.State, backupFilePath string, expiry string, subkeys []string) error {
+	if err := mainState.CheckGpg(); err != nil {
+		return err
+	}
+	if err := mainState.TmpDir.Create(); err != nil {
+		return fmt.Errorf("could not create temporary directory: %w", err)
+	}
+
+	master, err := mainState.OpenMasterBackup(backupFilePath)
+	if err != nil {
+		return err
+	}
+	if !mainState.Batch {
+		utils.InfoPrint(fmt.Sprintf("Renewing key '%s' (%s) until %s from now", master.Fingerprint, master.UserID(), expiry))
+	}
+	if err := mainState.RenewKeys(master, expiry, subkeys); err != nil {
+		return fmt.Errorf("could not renew GPG keys: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"perfect-gpg-keypair/internal/utils"
+
+	"github.com/spf13/cobra"
+
+	openpgp "perfect-gpg-keypair/internal/openpgp"
+	paperbackup "perfect-gpg-keypair/internal/paper_backup"
+	qrbackup "perfect-gpg-keypair/internal/qr_backup"
+)
+
+func NewRestoreCmd() *cobra.Command {
+	var paperFilePath string
+	var qrFilePaths []string
+	var publicKeyFilePath string
+	var outputFilepath string
+	restoreCmd := &cobra.Command{
+		Use:   "restore",
+		Short: "restore the secret master key from a paper or QR backup",
+		Long: "restore the secret master key from a paper or QR backup\n\n" +
+			"  restore --from-paper <text file> --public-key <public key> [--output <file>]\n" +
+			"    combines the typed in lines of a paper backup with the public key (e.g. '.public-master.gpg')\n" +
+			"    into a secret key that can be imported with 'gpg --import'. It is still protected by its passphrase.\n\n" +
+			"  restore --from-qr <text file> [--from-qr <text file>...] [--public-key <public key>] [--output <file>]\n" +
+			"    reassembles the decoded text of the QR codes (one per line, in any order, e.g. 'zbarimg --raw *.png').\n" +
+			"    The public key is needed for QR codes of the paperkey form. Revocation certificates in the QR codes\n" +
+			"    are written next to the output file.",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			var err error
+			switch {
+			case paperFilePath != "" && len(qrFilePaths) > 0:
+				utils.ExitProgram(utils.InvalidArgumentsError("only one of --from-paper and --from-qr can be given"))
+			case paperFilePath != "":
+				if publicKeyFilePath == "" {
+					utils.ExitProgram(utils.InvalidArgumentsError("--public-key must be given"))
+				}
+				err = restoreFromPaper(paperFilePath, publicKeyFilePath, outputFilepath)
+			case len(qrFilePaths) > 0:
+				err = restoreFromQR(qrFilePaths, publicKeyFilePath, outputFilepath)
+			default:
+				utils.ExitProgram(utils.InvalidArgumentsError("one of --from-paper and --from-qr must be given"))
+			}
+			if err != nil {
+				utils.ExitProgram(fmt.Errorf("could not restore secret key: %w", err))
+			}
+		},
+	}
+
+	// add flags
+	restoreCmd.PersistentFlags().StringVar(&paperFilePath, "from-paper", "", "text file with the lines of a paper backup")
+	restoreCmd.PersistentFlags().StringArrayVar(&qrFilePaths, "from-qr", nil, "text file with the decoded QR codes of a QR backup (can be repeated)")
+	restoreCmd.PersistentFlags().StringVar(&publicKeyFilePath, "public-key", "", "exported public key of the backed up key")
+	restoreCmd.PersistentFlags().StringVarP(&outputFilepath, "output", "o", "restored-private-master.asc", "file the restored secret key is written to")
+	return restoreCmd
+}
+
+// ensureNotExists refuses to overwrite a file
+func ensureNotExists(filePath string) error {
+	if _, err := os.Stat(filePath); err == nil {
+		return fmt.Errorf("output file '%s' already exists", filePath)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func restoreFromPaper(paperFilePath string, publicKeyFilePath string, outputFilepath string) error {
+	if err := ensureNotExists(outputFilepath); err != nil {
+		return err
+	}
+	paperText, err := os.ReadFile(paperFilePath)
+	if err != nil {
+		return err
+	}
+	publicKeyData, err := os.ReadFile(publicKeyFilePath)
+	if err != nil {
+		return err
+	}
+	var secretKey bytes.Buffer
+	key, err := paperbackup.Restore(string(paperText), publicKeyData, &secretKey)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputFilepath, secretKey.Bytes(), 0600); err != nil {
+		return err
+	}
+	utils.InfoPrint(fmt.Sprintf(
+		"Restored the secret key '%s' to '%s'\nImport it with 'gpg --import %s', or use it with 'renew', 'rotate-subkey' or 'revoke'",
+		key.FingerprintHex(), outputFilepath, outputFilepath,
+	))
+	return nil
+}
+
+func restoreFromQR(qrFilePaths []string, publicKeyFilePath string, outputFilepath string) error {
+	chunks := []qrbackup.Chunk{}
+	for _, qrFilePath := range qrFilePaths {
+		text, err := os.ReadFile(qrFilePath)
+		if err != nil {
+			return err
+		}
+		fileChunks, err := qrbackup.ParseChunks(string(text))
+		if err != nil {
+			return fmt.Errorf("'%s': %w", qrFilePath, err)
+		}
+		chunks = append(chunks, fileChunks...)
+	}
+	payloads, err := qrbackup.Assemble(chunks)
+	if err != nil {
+		return err
+	}
+
+	outputs := map[string][]byte{}
+	var fingerprint string
+	for name, payload := range payloads {
+		switch name {
+		case qrbackup.PrivateMasterKeyName:
+			data, err := openpgp.ReadKeyData(payload)
+			if err != nil {
+				return fmt.Errorf("invalid secret key: %w", err)
+			}
+			key, err := openpgp.ReadKeyInfo(data)
+			if err != nil {
+				return fmt.Errorf("invalid secret key: %w", err)
+			}
+			fingerprint = key.FingerprintHex()
+			outputs[outputFilepath] = payload
+		case qrbackup.PaperkeyName:
+			if publicKeyFilePath == "" {
+				return fmt.Errorf("--public-key must be given to restore QR codes of the paperkey form")
+			}
+			publicKeyData, err := os.ReadFile(publicKeyFilePath)
+			if err != nil {
+				return err
+			}
+			var secretKey bytes.Buffer
+			key, err := paperbackup.RestoreSecrets(payload, publicKeyData, &secretKey)
+			if err != nil {
+				return err
+			}
+			fingerprint = key.FingerprintHex()
+			outputs[outputFilepath] = secretKey.Bytes()
+		default:
+			// revocation certificates
+			outputs[filepath.Join(filepath.Dir(outputFilepath), name+".asc")] = payload
+		}
+	}
+	for path := range outputs {
+		if err := ensureNotExists(path); err != nil {
+			return err
+		}
+	}
+	for path, data := range outputs {
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return err
+		}
+		if path != outputFilepath {
+			utils.InfoPrint(fmt.Sprintf("Restored '%s'", path))
+		}
+	}
+	if fingerprint == "" {
+		utils.InfoPrint("The QR codes did not contain the secret key")
+		return nil
+	}
+	utils.InfoPrint(fmt.Sprintf(
+		"Restored the secret key '%s' to '%s'\nImport it with 'gpg --import %s', or use it with 'renew', 'rotate-subkey' or 'revoke'",
+		fingerprint, outputFilepath, outputFilepath,
+	))
+	return nil
+}
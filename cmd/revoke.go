@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"perfect-gpg-keypair/internal/utils"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	state "perfect-gpg-keypair/internal/state"
+	batchspec "perfect-gpg-keypair/internal/state/batch_spec"
+	confirm "perfect-gpg-keypair/ui/confirm"
+)
+
+func NewRevokeCmd(runner utils.GpgRunner) *cobra.Command {
+	var debug bool
+	var batch bool
+	var subkeyId string
+	var backupFilePath string
+	var reasonName string
+	var description string
+	var outputFilepath string
+	var flagSpec batchspec.BatchSpec
+	revokeCmd := &cobra.Command{
+		Use:   "revoke [<revocation-certificate>]",
+		Short: "revoke the master key with its revocation certificate, or a single subkey",
+		Long: "revoke the master key with its revocation certificate, or a single subkey\n\n" +
+			"  revoke <revocation-certificate> [--output <file>]\n" +
+			"    imports the revocation certificate (e.g. '.revocation-certification.asc') into your keyring\n" +
+			"    and exports the revoked public key to publish.\n\n" +
+			"  revoke --subkey <fingerprint> --backup <private-master-key-backup> [--reason <reason>] [--description <text>]\n" +
+			"    revokes a single subkey using the backup of the master key in a throwaway keyring,\n" +
+			"    backs up the updated keys and imports the updated public key into your keyring.",
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := validateRevokeArgs(args, subkeyId, backupFilePath, outputFilepath); err != nil {
+				utils.ExitProgram(err)
+			}
+			var reason utils.RevocationReason
+			if reasonName != "" {
+				var err error
+				if reason, err = utils.ParseRevocationReason(reasonName); err != nil {
+					utils.ExitProgram(err)
+				}
+			}
+			mainState := state.NewState(debug, runner)
+			if batch {
+				if len(args) == 1 {
+					mainState.Batch = true
+				} else if err := mainState.SetBackupFromBatchSpec(flagSpec); err != nil {
+					utils.ExitProgram(utils.InvalidBatchConfigError(err.Error()))
+				}
+			} else if err := mainState.SetOutputOptions(flagSpec); err != nil {
+				utils.ExitProgram(err)
+			}
+			var err error
+			if len(args) == 1 {
+				err = revokeMasterKey(&mainState, args[0], outputFilepath)
+			} else {
+				err = revokeSubkey(&mainState, backupFilePath, subkeyId, reasonName != "", reason, description)
+			}
+			cleanup(&mainState, debug)
+			if err != nil {
+				utils.ExitProgram(err)
+			}
+		},
+	}
+
+	// add flags
+	revokeCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "debug mode (affects path of tmp dir)")
+	revokeCmd.PersistentFlags().StringVarP(&outputFilepath, "output", "o", "revoked-public-key.asc", "file the revoked public key is exported to")
+	revokeCmd.PersistentFlags().StringVar(&subkeyId, "subkey", "", "fingerprint or key id of the subkey to revoke")
+	revokeCmd.PersistentFlags().StringVar(&backupFilePath, "backup", "", "backup of the private master key, needed to revoke a subkey")
+	revokeCmd.PersistentFlags().StringVar(
+		&reasonName, "reason", "",
+		fmt.Sprintf("reason of the subkey revocation (%s), asked for interactively if not set", strings.Join(utils.RevocationReasonNames(), ", ")),
+	)
+	revokeCmd.PersistentFlags().StringVar(&description, "description", "", "description of the subkey revocation")
+	revokeCmd.PersistentFlags().BoolVar(&batch, "batch", false, "run without any user interaction")
+	addOutputFlags(revokeCmd.PersistentFlags(), &flagSpec)
+	return revokeCmd
+}
+
+func validateRevokeArgs(args []string, subkeyId string, backupFilePath string, outputFilepath string) error {
+	if len(args) == 1 {
+		if subkeyId != "" || backupFilePath != "" {
+			return utils.InvalidArgumentsError("either a revocation certificate or --subkey and --backup can be given, not both")
+		}
+		if _, err := os.Stat(outputFilepath); err == nil {
+			return utils.InvalidArgumentsError(fmt.Sprintf("output file '%s' already exists", outputFilepath))
+		}
+		return nil
+	}
+	if subkeyId == "" || backupFilePath == "" {
+		return utils.InvalidArgumentsError("either a revocation certificate or --subkey and --backup must be given")
+	}
+	return nil
+}
+
+func revokeMasterKey(mainState *state.State, certificateFilePath string, outputFilepath string) error {
+	if err := mainState.CheckGpg(); err != nil {
+		return err
+	}
+	if !mainState.Batch {
+		utils.WarningPrint("Revoking the master key can not be undone, the key and all its subkeys can no longer be used!")
+		confirmed, err := confirm.Confirm("Are you really sure you want to revoke the master key?")
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			return nil
+		}
+	}
+	if err := mainState.TmpDir.Create(); err != nil {
+		return fmt.Errorf("could not create temporary directory: %w", err)
+	}
+	if err := mainState.RevokeMasterKey(certificateFilePath, outputFilepath); err != nil {
+		return fmt.Errorf("could not revoke GPG key: %w", err)
+	}
+	return nil
+}
+
+func revokeSubkey(
+	mainState *state.State, backupFilePath string, subkeyId string, hasReason bool, reason utils.RevocationReason, description string,
+) error {
+	if err := mainState.CheckGpg(); err != nil {
+		return err
+	}
+	if err := mainState.TmpDir.Create(); err != nil {
+		return fmt.Errorf("could not create temporary directory: %w", err)
+	}
+
+	master, err := mainState.OpenMasterBackup(backupFilePath)
+	if err != nil {
+		return err
+	}
+	if !mainState.Batch && !hasReason {
+		utils.InfoPrint(fmt.Sprintf("Revoking subkey '%s' of key '%s' (%s)", subkeyId, master.Fingerprint, master.UserID()))
+		reason, description, err = state.GetRevocationReason()
+		if err != nil {
+			return err
+		}
+	}
+	if err := mainState.RevokeSubkey(master, subkeyId, reason, description); err != nil {
+		return fmt.Errorf("could not revoke subkey: %w", err)
+	}
+	return nil
+}
@@ -1,22 +1,30 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+
+	"perfect-gpg-keypair/internal/utils"
 )
 
 var (
-	logLevel string
-	verbose  bool
-	version  = "0.0.1"
-	rootCmd  = &cobra.Command{
-		Use:          "perfect-gpg-keypair",
-		Version:      version,
-		Short:        "perfect-gpg-keypair is a simple CLI script for generating a super secure GPG keypair with a separate signing subkey",
-		SilenceUsage: true,
+	logLevel    string
+	verbose     bool
+	errorFormat string
+	version     = "0.0.1"
+	rootCmd     = &cobra.Command{
+		Use:     "perfect-gpg-keypair",
+		Version: version,
+		Short:   "perfect-gpg-keypair is a simple CLI script for generating a super secure GPG keypair with a separate signing subkey",
+		// errors are reported by utils.ExitProgram, along with their exit code
+		SilenceUsage:  true,
+		SilenceErrors: true,
 	}
 )
 
@@ -24,9 +32,16 @@ func init() {
 	// global flags
 	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", logrus.InfoLevel.String(), "log level (debug, info, warn, error, fatal, panic")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose mode")
+	rootCmd.PersistentFlags().StringVar(
+		&errorFormat, "error-format", "text",
+		fmt.Sprintf("format of the error reported on failure (%s), json is written to stderr", strings.Join(utils.ErrorFormats, ", ")),
+	)
 
 	// Initialize logger
 	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := utils.SetErrorFormat(errorFormat); err != nil {
+			return err
+		}
 		if err := setUpLogger(os.Stdout, logLevel); err != nil {
 			return err
 		}
@@ -38,16 +53,31 @@ func init() {
 	// Hide auto generated 'Completion' subcommand:
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
 
-	// add subcommands
-	rootCmd.AddCommand(NewGenerateCmd())
-	rootCmd.AddCommand(NewListCmd())
-	rootCmd.AddCommand(NewRemoveCmd())
+	// add subcommands, which run the gpg installed on the system
+	runner := utils.ExecRunner{}
+	rootCmd.AddCommand(NewGenerateCmd(runner))
+	rootCmd.AddCommand(NewListCmd(runner))
+	rootCmd.AddCommand(NewRemoveCmd(runner))
+	rootCmd.AddCommand(NewRenewCmd(runner))
+	rootCmd.AddCommand(NewRotateSubkeyCmd(runner))
+	rootCmd.AddCommand(NewRevokeCmd(runner))
+	rootCmd.AddCommand(NewRestoreCmd())
+	rootCmd.AddCommand(NewRecoverCmd())
+	rootCmd.AddCommand(NewVerifyBackupCmd(runner))
+	rootCmd.AddCommand(NewUnbundleCmd(runner))
 }
 
 func Execute() {
-	err := rootCmd.Execute()
-	if err != nil {
-		os.Exit(1)
+	utils.HandleSignals()
+	// errors of invalid flags are reported before the logger is set up with the level from the flags
+	setUpLogger(os.Stdout, logrus.InfoLevel.String())
+	// the commands exit through utils.ExitProgram themselves, the errors left are invalid arguments or flags
+	if err := rootCmd.Execute(); err != nil {
+		var validation *utils.ValidationError
+		if !errors.As(err, &validation) {
+			err = utils.InvalidArgumentsError(err.Error())
+		}
+		utils.ExitProgram(err)
 	}
 }
 
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"perfect-gpg-keypair/internal/utils"
+
+	"github.com/spf13/cobra"
+
+	state "perfect-gpg-keypair/internal/state"
+	batchspec "perfect-gpg-keypair/internal/state/batch_spec"
+	keyalgorithm "perfect-gpg-keypair/internal/state/key_algorithm"
+	userinfo "perfect-gpg-keypair/internal/state/user_info"
+)
+
+func NewRotateSubkeyCmd(runner utils.GpgRunner) *cobra.Command {
+	var debug bool
+	var batch bool
+	var expiry string
+	var algorithm string
+	var revokeSubkeyId string
+	var flagSpec batchspec.BatchSpec
+	rotateSubkeyCmd := &cobra.Command{
+		Use:   "rotate-subkey <private-master-key-backup>",
+		Short: "issue a new signing subkey (e.g. for a new computer) from a backup",
+		Long: "issue a new signing subkey (e.g. for a new computer) from a backup\n\n" +
+			"The backup of the private master key (e.g. '.private-master.gpg') is imported into a throwaway keyring,\n" +
+			"where a new signing subkey is added and, optionally, an old signing subkey is revoked as superseded.\n" +
+			"The updated keys are exported for backup again, including a subkey-only export of the new subkey\n" +
+			"('.signing-subkey.gpg') to import on the target computer. The updated public key is imported into your keyring.",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := utils.ValidateExpiry(expiry); err != nil {
+				utils.ExitProgram(err)
+			}
+			if algorithm != "" {
+				if _, err := keyalgorithm.ParseKeySpec(algorithm, keyalgorithm.Sign); err != nil {
+					utils.ExitProgram(err)
+				}
+			}
+			mainState := state.NewState(debug, runner)
+			if batch {
+				if err := mainState.SetBackupFromBatchSpec(flagSpec); err != nil {
+					utils.ExitProgram(utils.InvalidBatchConfigError(err.Error()))
+				}
+			} else if err := mainState.SetOutputOptions(flagSpec); err != nil {
+				utils.ExitProgram(err)
+			}
+			err := rotateSubkey(&mainState, args[0], algorithm, expiry, revokeSubkeyId)
+			cleanup(&mainState, debug)
+			if err != nil {
+				utils.ExitProgram(err)
+			}
+		},
+	}
+
+	// add flags
+	rotateSubkeyCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "debug mode (affects path of tmp dir)")
+	rotateSubkeyCmd.PersistentFlags().StringVar(&expiry, "expiry", userinfo.DefaultExpiry, "expiry of the new signing subkey as '<n>w|m|y' or 0")
+	rotateSubkeyCmd.PersistentFlags().StringVarP(
+		&algorithm, "algorithm", "a", "", "algorithm of the new signing subkey (default: matching the master key)",
+	)
+	rotateSubkeyCmd.PersistentFlags().StringVar(
+		&revokeSubkeyId, "revoke", "", "fingerprint or key id of an old subkey to revoke as superseded (asked for interactively if not set)",
+	)
+	rotateSubkeyCmd.PersistentFlags().BoolVar(&batch, "batch", false, "run without any user interaction")
+	addOutputFlags(rotateSubkeyCmd.PersistentFlags(), &flagSpec)
+	return rotateSubkeyCmd
+}
+
+func rotateSubkey(mainState *state.State, backupFilePath string, algorithm string, expiry string, revokeSubkeyId string) error {
+	if err := mainState.CheckGpg(); err != nil {
+		return err
+	}
+	if err := mainState.TmpDir.Create(); err != nil {
+		return fmt.Errorf("could not create temporary directory: %w", err)
+	}
+
+	// the algorithm is checked against the master key before asking for the passphrase and importing the backup
+	masterInfo, err := state.ReadBackupKeyInfo(backupFilePath)
+	if err != nil {
+		return err
+	}
+	subkey := userinfo.Subkey{Usage: keyalgorithm.Sign, Expiry: expiry}
+	if subkey.Algorithm, err = state.SigningSubkeyAlgorithm(masterInfo.Algorithm, algorithm); err != nil {
+		return err
+	}
+	if err := mainState.CheckSubkeyAlgorithm(subkey.Algorithm); err != nil {
+		return err
+	}
+	master, err := mainState.OpenMasterBackup(backupFilePath)
+	if err != nil {
+		return err
+	}
+	if !mainState.Batch {
+		utils.InfoPrint(fmt.Sprintf("Adding a new signing subkey to key '%s' (%s)", master.Fingerprint, master.UserID()))
+		if revokeSubkeyId == "" {
+			revokeSubkeyId, err = state.ChooseSubkeyToRevoke(master)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err := mainState.RotateSigningSubkey(master, subkey, revokeSubkeyId); err != nil {
+		return fmt.Errorf("could not rotate signing subkey: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"perfect-gpg-keypair/internal/utils"
+
+	"github.com/spf13/cobra"
+
+	backupbundle "perfect-gpg-keypair/internal/backup_bundle"
+	state "perfect-gpg-keypair/internal/state"
+	batchspec "perfect-gpg-keypair/internal/state/batch_spec"
+)
+
+func NewUnbundleCmd(runner utils.GpgRunner) *cobra.Command {
+	var batch bool
+	var outputDir string
+	var flagSpec batchspec.BatchSpec
+	unbundleCmd := &cobra.Command{
+		Use:   "unbundle <backup bundle>",
+		Short: "unpack and verify an encrypted backup bundle",
+		Long: "unpack and verify an encrypted backup bundle\n\n" +
+			"The backup bundle (e.g. '.backup-bundle.tar.gpg') is decrypted with its passphrase and unpacked into the output\n" +
+			"directory. The files are checked against the manifest of the bundle and must all belong to the same key.",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := utils.ValidateOutputDir(outputDir); err != nil {
+				utils.ExitProgram(err)
+			}
+			var bundlePassphrase string
+			var err error
+			if batch {
+				if (flagSpec.BundlePassphraseFile == "") == (flagSpec.BundlePassphraseEnv == "") {
+					utils.ExitProgram(utils.InvalidBatchConfigError("exactly one of --bundle-passphrase-file or --bundle-passphrase-env must be set"))
+				}
+				bundlePassphrase, err = flagSpec.ReadBundlePassphrase()
+			} else {
+				bundlePassphrase, err = state.GetExistingBundlePassphrase()
+			}
+			if err != nil {
+				utils.ExitProgram(err)
+			}
+			if err := unbundle(utils.Keyring{Runner: runner}, args[0], bundlePassphrase, utils.ExpandHome(outputDir)); err != nil {
+				utils.ExitProgram(err)
+			}
+		},
+	}
+
+	// add flags
+	unbundleCmd.PersistentFlags().StringVarP(&outputDir, "output-dir", "o", "restored-backup", "directory the bundle is unpacked to (must be empty or not exist)")
+	unbundleCmd.PersistentFlags().BoolVar(&batch, "batch", false, "run without any user interaction")
+	addBundlePassphraseFlags(unbundleCmd.PersistentFlags(), &flagSpec)
+	return unbundleCmd
+}
+
+func unbundle(keyring utils.Keyring, bundleFilePath string, bundlePassphrase string, outputDir string) error {
+	keyring, err := keyring.WithCapabilities()
+	if err != nil {
+		return err
+	}
+	// the archive is only kept in memory, the keys are written to the output directory only
+	tarData, err := keyring.DecryptSymmetric(bundlePassphrase, bundleFilePath)
+	if err != nil {
+		return fmt.Errorf("could not decrypt backup bundle '%s': %w", bundleFilePath, err)
+	}
+	manifest, err := backupbundle.Unpack(tarData, outputDir)
+	if err != nil {
+		return err
+	}
+	utils.InfoPrint(fmt.Sprintf(
+		"Unpacked and verified %d files of the key '%s' (%s) to '%s'\nUse '%s/.private-master.gpg' with 'verify-backup', 'renew', 'rotate-subkey' or 'revoke'",
+		len(manifest.Files), manifest.Fingerprint, manifest.UserID, outputDir, outputDir,
+	))
+	return nil
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"perfect-gpg-keypair/internal/utils"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	keylist "perfect-gpg-keypair/internal/key_list"
+	state "perfect-gpg-keypair/internal/state"
+	batchspec "perfect-gpg-keypair/internal/state/batch_spec"
+)
+
+func NewVerifyBackupCmd(runner utils.GpgRunner) *cobra.Command {
+	var debug bool
+	var batch bool
+	var flagSpec batchspec.BatchSpec
+	verifyBackupCmd := &cobra.Command{
+		Use:   "verify-backup <private-master-key-backup>",
+		Short: "check that a backup of the master key and its passphrase still work",
+		Long: "check that a backup of the master key and its passphrase still work\n\n" +
+			"The backup of the private master key (e.g. '.private-master.gpg') is imported into a throwaway keyring,\n" +
+			"where it is checked that the passphrase unlocks it. The keys of the backup are compared with the key\n" +
+			"in your keyring and the expiry of each key is reported. The throwaway keyring is removed afterwards.",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			mainState := state.NewState(debug, runner)
+			if batch {
+				if err := mainState.SetPassphraseFromBatchSpec(flagSpec); err != nil {
+					utils.ExitProgram(utils.InvalidBatchConfigError(err.Error()))
+				}
+			}
+			err := verifyBackup(&mainState, args[0])
+			cleanup(&mainState, debug)
+			if err != nil {
+				utils.ExitProgram(err)
+			}
+		},
+	}
+
+	// add flags
+	verifyBackupCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "debug mode (affects path of tmp dir)")
+	verifyBackupCmd.PersistentFlags().BoolVar(&batch, "batch", false, "run without any user interaction")
+	addPassphraseFlags(verifyBackupCmd.PersistentFlags(), &flagSpec)
+	return verifyBackupCmd
+}
+
+func verifyBackup(mainState *state.State, backupFilePath string) error {
+	if err := mainState.CheckGpg(); err != nil {
+		return err
+	}
+	if err := mainState.TmpDir.Create(); err != nil {
+		return fmt.Errorf("could not create temporary directory: %w", err)
+	}
+
+	report, err := mainState.VerifyBackupFile(backupFilePath)
+	if err != nil {
+		return err
+	}
+	if err := keylist.Write(os.Stdout, []keylist.Key{report.Key}, "table", true); err != nil {
+		return err
+	}
+	if len(report.Warnings) > 0 {
+		utils.WarningPrint(strings.Join(report.Warnings, "\n"))
+	}
+	utils.InfoPrint(fmt.Sprintf("The backup '%s' holds the secret key '%s' and the passphrase unlocks it", backupFilePath, report.Key.Fingerprint))
+	return nil
+}
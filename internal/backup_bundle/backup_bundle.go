@@ -0,0 +1,162 @@
+package backupbundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	openpgp "perfect-gpg-keypair/internal/openpgp"
+	tmpdir "perfect-gpg-keypair/internal/tmp_dir"
+	"perfect-gpg-keypair/internal/utils"
+)
+
+// maxFileSize limits the size of a single file when unpacking, key files are far smaller
+const maxFileSize = 16 << 20
+
+// WriteTar writes a tar archive of the manifest and the files, which all end up in the root of the archive
+func WriteTar(w io.Writer, filePaths []string, manifest tmpdir.Manifest) error {
+	archive := tar.NewWriter(w)
+	now := time.Now().UTC().Truncate(time.Second)
+	var manifestContents bytes.Buffer
+	encoder := json.NewEncoder(&manifestContents)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return err
+	}
+	if err := writeTarFile(archive, tmpdir.ManifestFileName, manifestContents.Bytes(), now); err != nil {
+		return err
+	}
+	for _, filePath := range filePaths {
+		contents, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		if err := writeTarFile(archive, filepath.Base(filePath), contents, now); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func writeTarFile(archive *tar.Writer, name string, contents []byte, modTime time.Time) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0600,
+		Size:     int64(len(contents)),
+		ModTime:  modTime,
+	}
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := archive.Write(contents)
+	return err
+}
+
+// Unpack extracts the tar archive of a bundle into dir, which must be empty or not exist, and verifies the files
+// against the manifest of the bundle: all files must be listed with a matching checksum and all keys must belong
+// to the key of the manifest
+func Unpack(tarData []byte, dir string) (tmpdir.Manifest, error) {
+	if err := ensureEmptyDir(dir); err != nil {
+		return tmpdir.Manifest{}, err
+	}
+	archive := tar.NewReader(bytes.NewReader(tarData))
+	names := []string{}
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return tmpdir.Manifest{}, fmt.Errorf("invalid bundle: %w", err)
+		}
+		// only plain files in the root of the archive, so nothing can be written outside of dir
+		if header.Typeflag != tar.TypeReg || header.Name != filepath.Base(header.Name) || header.Name == ".." {
+			return tmpdir.Manifest{}, fmt.Errorf("invalid bundle: unexpected entry '%s'", header.Name)
+		}
+		// a later entry of the same name would silently replace the file that was checked against the manifest
+		if slices.Contains(names, header.Name) {
+			return tmpdir.Manifest{}, fmt.Errorf("invalid bundle: duplicate entry '%s'", header.Name)
+		}
+		if header.Size > maxFileSize {
+			return tmpdir.Manifest{}, fmt.Errorf("invalid bundle: '%s' is too large", header.Name)
+		}
+		contents, err := io.ReadAll(io.LimitReader(archive, maxFileSize))
+		if err != nil {
+			return tmpdir.Manifest{}, fmt.Errorf("invalid bundle: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, header.Name), contents, 0600); err != nil {
+			return tmpdir.Manifest{}, err
+		}
+		names = append(names, header.Name)
+	}
+
+	manifest, err := tmpdir.ReadManifest(dir)
+	if err != nil {
+		return manifest, fmt.Errorf("invalid bundle: could not read manifest: %w", err)
+	}
+	listed := map[string]bool{tmpdir.ManifestFileName: true}
+	for _, file := range manifest.Files {
+		listed[file.Name] = true
+	}
+	for _, name := range names {
+		if !listed[name] {
+			return manifest, fmt.Errorf("invalid bundle: '%s' is not listed in the manifest", name)
+		}
+	}
+	if err := manifest.Verify(dir); err != nil {
+		return manifest, fmt.Errorf("invalid bundle: %w", err)
+	}
+	for _, file := range manifest.Files {
+		if err := verifyFingerprint(filepath.Join(dir, file.Name), manifest.Fingerprint); err != nil {
+			return manifest, fmt.Errorf("invalid bundle: %w", err)
+		}
+	}
+	return manifest, nil
+}
+
+// verifyFingerprint ensures a key file belongs to the key with the fingerprint, other files (e.g. revocation certificates) are skipped
+func verifyFingerprint(filePath string, fingerprint string) error {
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	data, err := openpgp.ReadKeyData(contents)
+	if err != nil {
+		return nil
+	}
+	info, err := openpgp.ReadKeyInfo(data)
+	if err != nil {
+		return nil
+	}
+	if info.FingerprintHex() != fingerprint {
+		return fmt.Errorf("'%s' holds the key '%s' instead of '%s'", filepath.Base(filePath), info.FingerprintHex(), fingerprint)
+	}
+	return nil
+}
+
+// ensureEmptyDir creates dir, or ensures it is empty and can not be accessed by its group or other users
+func ensureEmptyDir(dir string) error {
+	if err := utils.ValidateOutputDir(dir); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return os.MkdirAll(dir, 0700)
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("directory '%s' is not empty", dir)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package backupbundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	keylist "perfect-gpg-keypair/internal/key_list"
+	tmpdir "perfect-gpg-keypair/internal/tmp_dir"
+)
+
+// the fixtures of internal/openpgp: an ed25519 master key with an rsa2048 encryption subkey
+const testFingerprint = "CF3708BE59878656536F3C64293BBA13E2721659"
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "openpgp", "testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	contents []byte
+}
+
+// file is a plain file of the archive
+func file(name string, contents []byte) tarEntry {
+	return tarEntry{name: name, typeflag: tar.TypeReg, contents: contents}
+}
+
+// tarOf writes the entries to a tar archive as given, unlike WriteTar
+func tarOf(t *testing.T, entries ...tarEntry) []byte {
+	t.Helper()
+	var data bytes.Buffer
+	archive := tar.NewWriter(&data)
+	for _, entry := range entries {
+		header := &tar.Header{Typeflag: entry.typeflag, Name: entry.name, Mode: 0600, Size: int64(len(entry.contents))}
+		if entry.typeflag == tar.TypeSymlink {
+			header.Linkname = "/etc/passwd"
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := archive.Write(entry.contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return data.Bytes()
+}
+
+// manifestOf returns the manifest of the key with the fingerprint that lists the files
+func manifestOf(t *testing.T, fingerprint string, files ...tarEntry) tarEntry {
+	t.Helper()
+	dir := t.TempDir()
+	filePaths := []string{}
+	for _, f := range files {
+		filePath := filepath.Join(dir, f.name)
+		if err := os.WriteFile(filePath, f.contents, 0600); err != nil {
+			t.Fatal(err)
+		}
+		filePaths = append(filePaths, filePath)
+	}
+	manifest, err := tmpdir.NewManifest(keylist.Key{Subkey: keylist.Subkey{Fingerprint: fingerprint}}, filePaths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file(tmpdir.ManifestFileName, contents)
+}
+
+func TestWriteTarUnpack(t *testing.T) {
+	dir := t.TempDir()
+	filePaths := []string{}
+	for name, contents := range map[string][]byte{
+		".public-master.gpg":  readFixture(t, "public-key.asc"),
+		".private-master.gpg": readFixture(t, "secret-key.asc"),
+		".revocation.asc":     []byte("not a key, skipped by the fingerprint check\n"),
+	} {
+		filePath := filepath.Join(dir, name)
+		if err := os.WriteFile(filePath, contents, 0600); err != nil {
+			t.Fatal(err)
+		}
+		filePaths = append(filePaths, filePath)
+	}
+	manifest, err := tmpdir.NewManifest(keylist.Key{Subkey: keylist.Subkey{Fingerprint: testFingerprint}}, filePaths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tarData bytes.Buffer
+	if err := WriteTar(&tarData, filePaths, manifest); err != nil {
+		t.Fatalf("WriteTar() returned error: %v", err)
+	}
+
+	unpackDir := filepath.Join(t.TempDir(), "restored")
+	unpacked, err := Unpack(tarData.Bytes(), unpackDir)
+	if err != nil {
+		t.Fatalf("Unpack() returned error: %v", err)
+	}
+	if unpacked.Fingerprint != testFingerprint || len(unpacked.Files) != 3 {
+		t.Errorf("Unpack() returned the manifest of %s with %d files", unpacked.Fingerprint, len(unpacked.Files))
+	}
+	for _, name := range []string{tmpdir.ManifestFileName, ".public-master.gpg", ".private-master.gpg", ".revocation.asc"} {
+		info, err := os.Stat(filepath.Join(unpackDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("%s has permissions %o, want 600", name, info.Mode().Perm())
+		}
+	}
+	if info, err := os.Stat(unpackDir); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("the output directory was created with %v (%v), want permissions 700", info.Mode().Perm(), err)
+	}
+}
+
+func TestUnpackRejectsInvalidBundles(t *testing.T) {
+	publicKey := file(".public-master.gpg", readFixture(t, "public-key.asc"))
+	manifest := manifestOf(t, testFingerprint, publicKey)
+
+	tests := []struct {
+		name    string
+		tarData []byte
+		wantErr string
+	}{
+		{name: "not a tar archive", tarData: []byte("not a tar archive, but longer than a single block of the tar format..." + strings.Repeat(".", 512)), wantErr: "invalid bundle"},
+		{name: "file in a subdirectory", tarData: tarOf(t, manifest, file("keys/.public-master.gpg", publicKey.contents)), wantErr: "unexpected entry 'keys/.public-master.gpg'"},
+		{name: "file outside of the directory", tarData: tarOf(t, manifest, file("../.public-master.gpg", publicKey.contents)), wantErr: "unexpected entry '../.public-master.gpg'"},
+		{name: "parent directory", tarData: tarOf(t, manifest, file("..", publicKey.contents)), wantErr: "unexpected entry '..'"},
+		{name: "symlink", tarData: tarOf(t, manifest, tarEntry{name: ".public-master.gpg", typeflag: tar.TypeSymlink}), wantErr: "unexpected entry '.public-master.gpg'"},
+		{name: "directory", tarData: tarOf(t, manifest, tarEntry{name: "keys", typeflag: tar.TypeDir}), wantErr: "unexpected entry 'keys'"},
+		{
+			name:    "duplicate entry",
+			tarData: tarOf(t, manifest, publicKey, file(".public-master.gpg", readFixture(t, "secret-key.asc"))),
+			wantErr: "duplicate entry '.public-master.gpg'",
+		},
+		{
+			name:    "duplicate manifest",
+			tarData: tarOf(t, manifest, publicKey, manifestOf(t, testFingerprint)),
+			wantErr: "duplicate entry '" + tmpdir.ManifestFileName + "'",
+		},
+		{name: "missing manifest", tarData: tarOf(t, publicKey), wantErr: "could not read manifest"},
+		{name: "file not in the manifest", tarData: tarOf(t, manifest, publicKey, file("notes.txt", []byte("notes\n"))), wantErr: "'notes.txt' is not listed in the manifest"},
+		{name: "file of the manifest missing", tarData: tarOf(t, manifestOf(t, testFingerprint, publicKey)), wantErr: "invalid bundle"},
+		{
+			name:    "checksum mismatch",
+			tarData: tarOf(t, manifest, file(".public-master.gpg", readFixture(t, "secret-key.asc"))),
+			wantErr: "checksum does not match the manifest: .public-master.gpg",
+		},
+		{
+			name:    "key of another fingerprint",
+			tarData: tarOf(t, manifestOf(t, strings.Repeat("0", 40), publicKey), publicKey),
+			wantErr: "'.public-master.gpg' holds the key '" + testFingerprint + "'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unpackDir := filepath.Join(t.TempDir(), "restored")
+			_, err := Unpack(tt.tarData, unpackDir)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Unpack() returned %v, want an error containing %q", err, tt.wantErr)
+			}
+			if _, err := os.Stat(filepath.Join(filepath.Dir(unpackDir), ".public-master.gpg")); err == nil {
+				t.Error("Unpack() wrote a file outside of the output directory")
+			}
+		})
+	}
+}
+
+func TestUnpackChecksOutputDir(t *testing.T) {
+	publicKey := file(".public-master.gpg", readFixture(t, "public-key.asc"))
+	tarData := tarOf(t, manifestOf(t, testFingerprint, publicKey), publicKey)
+
+	tests := []struct {
+		name    string
+		mode    os.FileMode
+		files   []string
+		wantErr string
+	}{
+		{name: "empty", mode: 0700},
+		{name: "not empty", mode: 0700, files: []string{"notes.txt"}, wantErr: "is not empty"},
+		{name: "accessible by others", mode: 0755, wantErr: "is accessible by its group or other users"},
+		{name: "accessible by its group", mode: 0770, wantErr: "is accessible by its group or other users"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "restored")
+			if err := os.Mkdir(dir, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(dir, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := Unpack(tarData, dir)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Unpack() returned error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Unpack() returned %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
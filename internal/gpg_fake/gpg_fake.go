@@ -0,0 +1,162 @@
+package gpgfake
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+
+	"perfect-gpg-keypair/internal/utils"
+)
+
+// Response is the canned result of a command
+type Response struct {
+	// Stdout is written to the file given with --output, or to stdout otherwise (or with '--output -')
+	Stdout string
+	Stderr string
+	// Status is written to stdout or stderr, as given with --status-fd 1 or 2
+	Status string
+	// ExitCode makes the command fail if not 0
+	ExitCode int
+}
+
+// Invocation is a command the runner was given
+type Invocation struct {
+	Program    string
+	Args       []string
+	Passphrase string
+}
+
+// Has reports whether all of the given arguments are among the arguments of the command
+func (invocation Invocation) Has(args ...string) bool {
+	for _, arg := range args {
+		if !slices.Contains(invocation.Args, arg) {
+			return false
+		}
+	}
+	return true
+}
+
+// Option returns the value of the given option, e.g. the path of '--output'
+func (invocation Invocation) Option(option string) (string, bool) {
+	i := slices.Index(invocation.Args, option)
+	if i < 0 || i+1 >= len(invocation.Args) {
+		return "", false
+	}
+	return invocation.Args[i+1], true
+}
+
+// ExitError is returned for responses with an exit code other than 0, like exec.ExitError
+type ExitError struct {
+	ExitCode int
+	Stderr   string
+}
+
+func (err *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", err.ExitCode)
+}
+
+type rule struct {
+	args    []string
+	respond func(invocation Invocation) Response
+}
+
+// Runner is a scriptable utils.GpgRunner for tests. Instead of running gpg it records the commands it is given
+// and answers each with the response of the last rule matching it, or with an empty, successful response.
+type Runner struct {
+	mutex       sync.Mutex
+	rules       []rule
+	invocations []Invocation
+}
+
+func New() *Runner {
+	return &Runner{}
+}
+
+// On answers the commands that have all of the given arguments (e.g. the subcommand) with the response
+func (runner *Runner) On(response Response, args ...string) *Runner {
+	return runner.OnFunc(func(Invocation) Response { return response }, args...)
+}
+
+// OnFunc answers the commands that have all of the given arguments with the response returned by respond,
+// for answers that depend on the command or on earlier commands
+func (runner *Runner) OnFunc(respond func(invocation Invocation) Response, args ...string) *Runner {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	runner.rules = append(runner.rules, rule{args: args, respond: respond})
+	return runner
+}
+
+// Invocations returns the commands the runner was given, in order
+func (runner *Runner) Invocations() []Invocation {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	return slices.Clone(runner.invocations)
+}
+
+// Calls returns the commands the runner was given that have all of the given arguments
+func (runner *Runner) Calls(args ...string) []Invocation {
+	calls := []Invocation{}
+	for _, invocation := range runner.Invocations() {
+		if invocation.Has(args...) {
+			calls = append(calls, invocation)
+		}
+	}
+	return calls
+}
+
+func (runner *Runner) Run(command utils.GpgCommandArgs, stdout io.Writer, stderr io.Writer) error {
+	invocation := Invocation{Program: command.Program(), Args: command.Args(), Passphrase: command.Passphrase()}
+	runner.mutex.Lock()
+	runner.invocations = append(runner.invocations, invocation)
+	var respond func(invocation Invocation) Response
+	for _, rule := range slices.Backward(runner.rules) {
+		if invocation.Has(rule.args...) {
+			respond = rule.respond
+			break
+		}
+	}
+	runner.mutex.Unlock()
+
+	response := Response{}
+	if respond != nil {
+		response = respond(invocation)
+	}
+	if err := writeResponse(invocation, response, stdout, stderr); err != nil {
+		return err
+	}
+	if response.ExitCode != 0 {
+		return &ExitError{ExitCode: response.ExitCode, Stderr: response.Stderr}
+	}
+	return nil
+}
+
+func writeResponse(invocation Invocation, response Response, stdout io.Writer, stderr io.Writer) error {
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	// like gpg, '--output -' writes to stdout
+	if outputFilePath, ok := invocation.Option("--output"); ok && outputFilePath != "-" {
+		if err := os.WriteFile(outputFilePath, []byte(response.Stdout), 0600); err != nil {
+			return err
+		}
+	} else if _, err := io.WriteString(stdout, response.Stdout); err != nil {
+		return err
+	}
+	switch fd, _ := invocation.Option("--status-fd"); fd {
+	case "1":
+		if _, err := io.WriteString(stdout, response.Status); err != nil {
+			return err
+		}
+	case "2":
+		if _, err := io.WriteString(stderr, response.Status); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(stderr, response.Stderr)
+	return err
+}
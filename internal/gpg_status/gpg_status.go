@@ -0,0 +1,210 @@
+package gpgstatus
+
+import (
+	"bufio"
+	"bytes"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Prefix starts every status line gpg writes to the file descriptor given with --status-fd
+const Prefix = "[GNUPG:] "
+
+// The keywords of the status lines that are acted upon, see doc/DETAILS of gnupg for all of them
+const (
+	KeyCreated        = "KEY_CREATED"
+	KeyNotCreated     = "KEY_NOT_CREATED"
+	KeyConsidered     = "KEY_CONSIDERED"
+	ImportOK          = "IMPORT_OK"
+	ImportProblem     = "IMPORT_PROBLEM"
+	ImportRes         = "IMPORT_RES"
+	ExportRes         = "EXPORT_RES"
+	BadPassphrase     = "BAD_PASSPHRASE"
+	MissingPassphrase = "MISSING_PASSPHRASE"
+	PinentryLaunched  = "PINENTRY_LAUNCHED"
+	InvSgnr           = "INV_SGNR"
+	NoSgnr            = "NO_SGNR"
+	DeleteProblem     = "DELETE_PROBLEM"
+	NoData            = "NODATA"
+	Failure           = "FAILURE"
+	Error             = "ERROR"
+)
+
+// The error codes of libgpg-error that are mapped to specific errors
+const (
+	CodeNoPubkey      = 9
+	CodeBadPassphrase = 11
+	CodeNoSeckey      = 17
+	CodeNotFound      = 27
+	CodeNoAgent       = 77
+	CodeAgent         = 78
+	CodeNoPinentry    = 85
+	CodeCanceled      = 99
+	CodeNoPassphrase  = 177
+)
+
+// Event is a status line, e.g. 'KEY_CREATED P <fingerprint>'
+type Event struct {
+	Keyword string
+	Args    []string
+}
+
+// Arg returns the n-th (0-based) argument, or an empty string if there is none
+func (event Event) Arg(n int) string {
+	if n < len(event.Args) {
+		return event.Args[n]
+	}
+	return ""
+}
+
+// Code returns the error code of an ERROR or FAILURE event. gpg reports it along with its source
+// (e.g. 67108875 for a bad passphrase reported by the gpg-agent) or as '<code>_<name>', only the code is returned.
+func (event Event) Code() int {
+	arg := event.Arg(1)
+	if i := strings.IndexByte(arg, '_'); i >= 0 {
+		arg = arg[:i]
+	}
+	code, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0
+	}
+	return code & 0xFFFF
+}
+
+// Location returns where an ERROR or FAILURE event occurred, e.g. 'sign' or 'export_keys.secret'
+func (event Event) Location() string {
+	return event.Arg(0)
+}
+
+// ParseLine parses a status line, reporting false for lines that are not status lines
+func ParseLine(line string) (Event, bool) {
+	if !strings.HasPrefix(line, Prefix) {
+		return Event{}, false
+	}
+	fields := strings.Fields(strings.TrimPrefix(line, Prefix))
+	if len(fields) == 0 {
+		return Event{}, false
+	}
+	return Event{Keyword: fields[0], Args: fields[1:]}, true
+}
+
+// Parse splits the output of gpg run with '--status-fd 2' into the status events and the messages of gpg,
+// which are stripped of their 'gpg: ' prefix
+func Parse(output []byte) (Events, []string) {
+	events := Events{}
+	messages := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if event, ok := ParseLine(line); ok {
+			events = append(events, event)
+		} else if strings.TrimSpace(line) != "" {
+			messages = append(messages, strings.TrimPrefix(line, "gpg: "))
+		}
+	}
+	return events, messages
+}
+
+// Events are the status events of a gpg command, in the order they were reported
+type Events []Event
+
+// Has reports whether an event with the keyword was reported
+func (events Events) Has(keyword string) bool {
+	_, ok := events.Last(keyword)
+	return ok
+}
+
+// Last returns the last event with the keyword
+func (events Events) Last(keyword string) (Event, bool) {
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Keyword == keyword {
+			return events[i], true
+		}
+	}
+	return Event{}, false
+}
+
+// All returns the events with the keyword
+func (events Events) All(keyword string) Events {
+	all := Events{}
+	for _, event := range events {
+		if event.Keyword == keyword {
+			all = append(all, event)
+		}
+	}
+	return all
+}
+
+// CreatedKey returns the fingerprint of the key reported by the last KEY_CREATED event
+func (events Events) CreatedKey() (string, bool) {
+	event, ok := events.Last(KeyCreated)
+	if !ok || len(event.Arg(1)) != 40 {
+		return "", false
+	}
+	return event.Arg(1), true
+}
+
+// ConsideredKey returns the fingerprint of the key reported by the last KEY_CONSIDERED event
+func (events Events) ConsideredKey() (string, bool) {
+	event, ok := events.Last(KeyConsidered)
+	if !ok || event.Arg(0) == "" {
+		return "", false
+	}
+	return event.Arg(0), true
+}
+
+// ImportedKeys returns the fingerprints of the keys reported by IMPORT_OK events, without duplicates
+func (events Events) ImportedKeys() []string {
+	fingerprints := []string{}
+	for _, event := range events.All(ImportOK) {
+		fingerprint := event.Arg(1)
+		if fingerprint != "" && !slices.Contains(fingerprints, fingerprint) {
+			fingerprints = append(fingerprints, fingerprint)
+		}
+	}
+	return fingerprints
+}
+
+// ExportedCount returns the number of keys reported as exported by the EXPORT_RES event, or -1 if there is none
+func (events Events) ExportedCount() int {
+	return events.count(ExportRes, 2)
+}
+
+// ImportedCount returns the number of keys processed by an import as reported by the IMPORT_RES event, or -1 if there is none
+func (events Events) ImportedCount() int {
+	return events.count(ImportRes, 0)
+}
+
+func (events Events) count(keyword string, arg int) int {
+	event, ok := events.Last(keyword)
+	if !ok {
+		return -1
+	}
+	count, err := strconv.Atoi(event.Arg(arg))
+	if err != nil {
+		return -1
+	}
+	return count
+}
+
+// Codes returns the error codes of all ERROR and FAILURE events
+func (events Events) Codes() []int {
+	codes := []int{}
+	for _, event := range events {
+		if event.Keyword == Error || event.Keyword == Failure {
+			codes = append(codes, event.Code())
+		}
+	}
+	return codes
+}
+
+// HasCode reports whether an ERROR or FAILURE event with one of the error codes was reported
+func (events Events) HasCode(codes ...int) bool {
+	for _, code := range events.Codes() {
+		if slices.Contains(codes, code) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package gpgstatus
+
+import (
+	"slices"
+	"testing"
+)
+
+const testFingerprint = "0123456789ABCDEF0123456789ABCDEF01234567"
+
+func TestParseSplitsEventsAndMessages(t *testing.T) {
+	output := "[GNUPG:] KEY_CONSIDERED " + testFingerprint + " 0\n" +
+		"gpg: key 89ABCDEF01234567: public key \"Jane Doe <jane@example.com>\" imported\n" +
+		"[GNUPG:] IMPORT_OK 1 " + testFingerprint + "\n" +
+		"[GNUPG:] IMPORT_OK 17 " + testFingerprint + "\n" +
+		"[GNUPG:] IMPORT_RES 1 0 1 0 0 0 0 0 0 1 1 0 0 0 0\n"
+
+	events, messages := Parse([]byte(output))
+
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got %d: %v", len(events), events)
+	}
+	want := []string{"key 89ABCDEF01234567: public key \"Jane Doe <jane@example.com>\" imported"}
+	if !slices.Equal(messages, want) {
+		t.Errorf("messages:\n got %q\nwant %q", messages, want)
+	}
+	if fingerprint, ok := events.ConsideredKey(); !ok || fingerprint != testFingerprint {
+		t.Errorf("ConsideredKey() = %q, %v, want %q", fingerprint, ok, testFingerprint)
+	}
+	if keys := events.ImportedKeys(); !slices.Equal(keys, []string{testFingerprint}) {
+		t.Errorf("ImportedKeys() = %v, want [%s]", keys, testFingerprint)
+	}
+	if count := events.ImportedCount(); count != 1 {
+		t.Errorf("ImportedCount() = %d, want 1", count)
+	}
+	if count := events.ExportedCount(); count != -1 {
+		t.Errorf("ExportedCount() = %d, want -1 without EXPORT_RES", count)
+	}
+}
+
+func TestCreatedKey(t *testing.T) {
+	tests := map[string]struct {
+		output string
+		want   string
+		ok     bool
+	}{
+		"master key":  {output: "[GNUPG:] KEY_CREATED P " + testFingerprint + "\n", want: testFingerprint, ok: true},
+		"subkey":      {output: "[GNUPG:] KEY_CONSIDERED AAAA 0\n[GNUPG:] KEY_CREATED S " + testFingerprint + "\n", want: testFingerprint, ok: true},
+		"short id":    {output: "[GNUPG:] KEY_CREATED P 89ABCDEF01234567\n"},
+		"not created": {output: "[GNUPG:] KEY_NOT_CREATED\n"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			events, _ := Parse([]byte(test.output))
+			got, ok := events.CreatedKey()
+			if got != test.want || ok != test.ok {
+				t.Errorf("CreatedKey() = %q, %v, want %q, %v", got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
+
+func TestEventCode(t *testing.T) {
+	tests := map[string]int{
+		"[GNUPG:] FAILURE sign 67108875":                              CodeBadPassphrase,
+		"[GNUPG:] ERROR export_keys.secret 67108875":                  CodeBadPassphrase,
+		"[GNUPG:] ERROR symkey_decrypt.maybe_error 11_BAD_PASSPHRASE": CodeBadPassphrase,
+		"[GNUPG:] ERROR keylist.getkey 9":                             CodeNoPubkey,
+		"[GNUPG:] FAILURE sign 17":                                    CodeNoSeckey,
+		"[GNUPG:] FAILURE gpg-exit 33554433":                          1,
+		"[GNUPG:] ERROR somewhere not-a-code":                         0,
+	}
+	for line, want := range tests {
+		event, ok := ParseLine(line)
+		if !ok {
+			t.Fatalf("ParseLine(%q) reported no status line", line)
+		}
+		if got := event.Code(); got != want {
+			t.Errorf("Code() of %q = %d, want %d", line, got, want)
+		}
+	}
+}
+
+func TestExportedCount(t *testing.T) {
+	events, _ := Parse([]byte("gpg: WARNING: nothing exported\n[GNUPG:] EXPORT_RES 0 0 0\n"))
+	if count := events.ExportedCount(); count != 0 {
+		t.Errorf("ExportedCount() = %d, want 0", count)
+	}
+}
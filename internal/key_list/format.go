@@ -0,0 +1,85 @@
+package keylist
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var Formats = []string{"json", "yaml", "table"}
+
+// Write writes the keys to w in the given format ('json', 'yaml' or 'table').
+// longKeyId only affects the table format, which shows full fingerprints instead of short (8 hex digits) key ids.
+func Write(w io.Writer, keys []Key, format string, longKeyId bool) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(keys)
+	case "yaml":
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(keys); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case "table":
+		return writeTable(w, keys, longKeyId)
+	}
+	return fmt.Errorf("unknown output format '%s', must be one of: %s", format, strings.Join(Formats, ", "))
+}
+
+func writeTable(w io.Writer, keys []Key, longKeyId bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tKEY ID\tALGORITHM\tUSAGE\tCREATED\tEXPIRES\tVALIDITY\tUSER ID")
+	for _, key := range keys {
+		writeTableRow(tw, recordType(key.Subkey, "pub", "sec"), key.Subkey, longKeyId)
+		for _, uid := range key.UIDs {
+			fmt.Fprintf(tw, "uid\t\t\t\t\t\t%s\t%s\n", uid.Validity, uid.UserID)
+		}
+		for _, subkey := range key.Subkeys {
+			writeTableRow(tw, recordType(subkey, "sub", "ssb"), subkey, longKeyId)
+		}
+	}
+	return tw.Flush()
+}
+
+func writeTableRow(w io.Writer, recordType string, subkey Subkey, longKeyId bool) {
+	keyId := subkey.Fingerprint
+	if !longKeyId && len(subkey.KeyID) > 8 {
+		keyId = subkey.KeyID[len(subkey.KeyID)-8:]
+	}
+	usage := ""
+	for _, capability := range subkey.Capabilities {
+		usage += strings.ToUpper(string(capability)[:1])
+	}
+	fmt.Fprintf(
+		w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n",
+		recordType, keyId, subkey.Algorithm, usage, formatDate(&subkey.Created), formatDate(subkey.Expires), subkey.Validity,
+	)
+}
+
+// recordType returns the record type as shown by gpg, e.g. 'sec#' for a secret key stub
+func recordType(subkey Subkey, public string, secret string) string {
+	switch subkey.Secret {
+	case SecretNone:
+		return public
+	case SecretStub:
+		return secret + "#"
+	case SecretOnCard:
+		return secret + ">"
+	}
+	return secret
+}
+
+func formatDate(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.Format(time.DateOnly)
+}
@@ -0,0 +1,295 @@
+package keylist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Capability string
+
+const (
+	Sign         Capability = "sign"
+	Certify      Capability = "certify"
+	Encrypt      Capability = "encrypt"
+	Authenticate Capability = "authenticate"
+)
+
+// SecretStatus tells where (and if) the secret part of a key is available
+type SecretStatus string
+
+const (
+	SecretNone      SecretStatus = ""
+	SecretAvailable SecretStatus = "available"
+	// SecretStub means only a stub of the secret key is present, e.g. after the master key was removed ('sec#')
+	SecretStub SecretStatus = "stub"
+	// SecretOnCard means the secret key is stored on a smartcard ('sec>')
+	SecretOnCard SecretStatus = "card"
+)
+
+type UID struct {
+	UserID   string     `json:"user_id" yaml:"user_id"`
+	Validity string     `json:"validity" yaml:"validity"`
+	Created  *time.Time `json:"created,omitempty" yaml:"created,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty" yaml:"expires,omitempty"`
+}
+
+// Subkey holds the fields shared by primary keys and subkeys
+type Subkey struct {
+	Fingerprint  string       `json:"fingerprint" yaml:"fingerprint"`
+	KeyID        string       `json:"key_id" yaml:"key_id"`
+	Keygrip      string       `json:"keygrip,omitempty" yaml:"keygrip,omitempty"`
+	Algorithm    string       `json:"algorithm" yaml:"algorithm"`
+	Length       int          `json:"length" yaml:"length"`
+	Curve        string       `json:"curve,omitempty" yaml:"curve,omitempty"`
+	Validity     string       `json:"validity" yaml:"validity"`
+	Capabilities []Capability `json:"capabilities" yaml:"capabilities"`
+	Disabled     bool         `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	Created      time.Time    `json:"created" yaml:"created"`
+	Expires      *time.Time   `json:"expires,omitempty" yaml:"expires,omitempty"`
+	Secret       SecretStatus `json:"secret,omitempty" yaml:"secret,omitempty"`
+	CardSerial   string       `json:"card_serial,omitempty" yaml:"card_serial,omitempty"`
+}
+
+func (subkey Subkey) HasCapability(capability Capability) bool {
+	for _, c := range subkey.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+func (subkey Subkey) IsRevoked() bool {
+	return subkey.Validity == "revoked"
+}
+
+func (subkey Subkey) IsExpired() bool {
+	return subkey.Validity == "expired"
+}
+
+type Key struct {
+	Subkey     `yaml:",inline"`
+	OwnerTrust string   `json:"owner_trust,omitempty" yaml:"owner_trust,omitempty"`
+	UIDs       []UID    `json:"uids" yaml:"uids"`
+	Subkeys    []Subkey `json:"subkeys" yaml:"subkeys"`
+}
+
+// UserID returns the first user id of the key
+func (key Key) UserID() string {
+	if len(key.UIDs) == 0 {
+		return ""
+	}
+	return key.UIDs[0].UserID
+}
+
+// FindSubkey returns the subkey with the given fingerprint or key id
+func (key Key) FindSubkey(id string) (Subkey, bool) {
+	id = strings.ToUpper(strings.TrimSuffix(id, "!"))
+	for _, subkey := range key.Subkeys {
+		if subkey.Fingerprint == id || subkey.KeyID == id {
+			return subkey, true
+		}
+	}
+	return Subkey{}, false
+}
+
+var validities = map[string]string{
+	"o": "unknown",
+	"i": "invalid",
+	"d": "disabled",
+	"r": "revoked",
+	"e": "expired",
+	"-": "unknown",
+	"q": "undefined",
+	"n": "never",
+	"m": "marginal",
+	"f": "full",
+	"u": "ultimate",
+	"w": "well-known",
+	"s": "special",
+}
+
+var capabilities = map[rune]Capability{
+	's': Sign,
+	'c': Certify,
+	'e': Encrypt,
+	'a': Authenticate,
+}
+
+// Parse parses the output of 'gpg --with-colons --fixed-list-mode --list-keys' or '--list-secret-keys'.
+// See doc/DETAILS in the GnuPG sources for the format.
+func Parse(r io.Reader) ([]Key, error) {
+	keys := []*Key{}
+	var key *Key
+	// last is the primary key or subkey that 'fpr' and 'grp' records belong to
+	var last *Subkey
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		fields := strings.Split(scanner.Text(), ":")
+		switch fields[0] {
+		case "pub", "sec":
+			subkey, err := parseKeyRecord(fields)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			key = &Key{Subkey: subkey, OwnerTrust: validities[field(fields, 9)], UIDs: []UID{}, Subkeys: []Subkey{}}
+			keys = append(keys, key)
+			last = &key.Subkey
+		case "sub", "ssb":
+			if key == nil {
+				return nil, fmt.Errorf("line %d: '%s' record without primary key", lineNumber, fields[0])
+			}
+			subkey, err := parseKeyRecord(fields)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			key.Subkeys = append(key.Subkeys, subkey)
+			last = &key.Subkeys[len(key.Subkeys)-1]
+		case "uid":
+			if key == nil {
+				return nil, fmt.Errorf("line %d: 'uid' record without primary key", lineNumber)
+			}
+			uid := UID{UserID: unescape(field(fields, 10)), Validity: validities[field(fields, 2)]}
+			uid.Created, _ = parseOptionalTime(field(fields, 6))
+			uid.Expires, _ = parseOptionalTime(field(fields, 7))
+			key.UIDs = append(key.UIDs, uid)
+		case "fpr":
+			if last != nil && last.Fingerprint == "" {
+				last.Fingerprint = field(fields, 10)
+			}
+		case "grp":
+			if last != nil && last.Keygrip == "" {
+				last.Keygrip = field(fields, 10)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	parsedKeys := make([]Key, len(keys))
+	for i, key := range keys {
+		parsedKeys[i] = *key
+	}
+	return parsedKeys, nil
+}
+
+func parseKeyRecord(fields []string) (Subkey, error) {
+	if len(fields) < 12 {
+		return Subkey{}, fmt.Errorf("'%s' record has only %d fields", fields[0], len(fields))
+	}
+	length, err := strconv.Atoi(field(fields, 3))
+	if err != nil {
+		return Subkey{}, fmt.Errorf("invalid key length '%s'", field(fields, 3))
+	}
+	created, err := parseTime(field(fields, 6))
+	if err != nil {
+		return Subkey{}, fmt.Errorf("invalid creation date: %w", err)
+	}
+	expires, err := parseOptionalTime(field(fields, 7))
+	if err != nil {
+		return Subkey{}, fmt.Errorf("invalid expiration date: %w", err)
+	}
+	subkey := Subkey{
+		KeyID:        field(fields, 5),
+		Length:       length,
+		Curve:        field(fields, 17),
+		Validity:     validities[field(fields, 2)],
+		Created:      created,
+		Expires:      expires,
+		Capabilities: []Capability{},
+	}
+	subkey.Algorithm = algorithmName(field(fields, 4), length, subkey.Curve)
+	for _, c := range field(fields, 12) {
+		if capability, ok := capabilities[c]; ok {
+			subkey.Capabilities = append(subkey.Capabilities, capability)
+		}
+		if c == 'D' {
+			subkey.Disabled = true
+		}
+	}
+	if fields[0] == "sec" || fields[0] == "ssb" {
+		switch serial := field(fields, 15); serial {
+		// older gpg versions leave the field empty for available secret keys
+		case "+", "":
+			subkey.Secret = SecretAvailable
+		case "#":
+			subkey.Secret = SecretStub
+		default:
+			subkey.Secret = SecretOnCard
+			subkey.CardSerial = serial
+		}
+	}
+	return subkey, nil
+}
+
+// field returns the n-th (1-based, as in doc/DETAILS) field of the record
+func field(fields []string, n int) string {
+	if n > len(fields) {
+		return ""
+	}
+	return fields[n-1]
+}
+
+func algorithmName(id string, length int, curve string) string {
+	switch id {
+	case "1", "2", "3":
+		return fmt.Sprintf("rsa%d", length)
+	case "16", "20":
+		return fmt.Sprintf("elg%d", length)
+	case "17":
+		return fmt.Sprintf("dsa%d", length)
+	case "18", "19", "22":
+		if curve != "" {
+			return curve
+		}
+	}
+	return "unknown"
+}
+
+func parseTime(value string) (time.Time, error) {
+	if strings.Contains(value, "T") {
+		return time.Parse("20060102T150405", value)
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+func parseOptionalTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := parseTime(value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// unescape decodes the C-style '\xHH' escapes gpg uses for special characters in user ids
+func unescape(value string) string {
+	if !strings.Contains(value, `\x`) {
+		return value
+	}
+	var out strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+3 < len(value) && value[i+1] == 'x' {
+			if b, err := strconv.ParseUint(value[i+2:i+4], 16, 8); err == nil {
+				out.WriteByte(byte(b))
+				i += 3
+				continue
+			}
+		}
+		out.WriteByte(value[i])
+	}
+	return out.String()
+}
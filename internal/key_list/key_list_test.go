@@ -0,0 +1,246 @@
+package keylist
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The fixtures in testdata were captured from gpg 2.2 with the flags used by Keyring.GetKeys. The key has a
+// revoked user id whose name contains a colon, an encryption subkey, an expired signing subkey and a revoked
+// authentication subkey; the secret part of the master key was removed, so it is listed as 'sec#'.
+const (
+	testFingerprint = "72E9F593A71D885C31827566204AC40F1091FACA"
+	testKeygrip     = "B34A8C16EADD376E9464C76FE284E00D4DDCFC12"
+)
+
+var testCreated = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func parseFixture(t *testing.T, name string) Key {
+	t.Helper()
+	keys, err := Parse(strings.NewReader(readFixture(t, name)))
+	if err != nil {
+		t.Fatalf("Parse(%s) returned error: %v", name, err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("Parse(%s) returned %d keys, want 1", name, len(keys))
+	}
+	return keys[0]
+}
+
+func TestParsePrimaryKey(t *testing.T) {
+	tests := []struct {
+		fixture    string
+		wantSecret SecretStatus
+	}{
+		{fixture: "list-keys.txt", wantSecret: SecretNone},
+		{fixture: "list-secret-keys.txt", wantSecret: SecretStub},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			key := parseFixture(t, tt.fixture)
+			if key.Fingerprint != testFingerprint || key.KeyID != testFingerprint[24:] || key.Keygrip != testKeygrip {
+				t.Errorf("primary key has fingerprint %s, key id %s and keygrip %s", key.Fingerprint, key.KeyID, key.Keygrip)
+			}
+			if key.Algorithm != "ed25519" || key.Validity != "ultimate" || key.OwnerTrust != "ultimate" {
+				t.Errorf("primary key has algorithm %s, validity %s and owner trust %s", key.Algorithm, key.Validity, key.OwnerTrust)
+			}
+			if !slices.Equal(key.Capabilities, []Capability{Certify}) || !key.Created.Equal(testCreated) || key.Expires != nil {
+				t.Errorf("primary key has capabilities %v, was created %s and expires %v", key.Capabilities, key.Created, key.Expires)
+			}
+			if key.Secret != tt.wantSecret {
+				t.Errorf("primary key has secret status %q, want %q", key.Secret, tt.wantSecret)
+			}
+		})
+	}
+}
+
+func TestParseUIDs(t *testing.T) {
+	key := parseFixture(t, "list-keys.txt")
+	want := []UID{
+		{UserID: "Jane Doe (work: laptop) <jane@example.com>", Validity: "ultimate", Created: &testCreated},
+		{UserID: "Old Name <old@example.com>", Validity: "revoked"},
+	}
+	if len(key.UIDs) != len(want) {
+		t.Fatalf("Parse() returned %d user ids, want %d", len(key.UIDs), len(want))
+	}
+	for i, uid := range key.UIDs {
+		if uid.UserID != want[i].UserID || uid.Validity != want[i].Validity {
+			t.Errorf("user id %d is %q (%s), want %q (%s)", i, uid.UserID, uid.Validity, want[i].UserID, want[i].Validity)
+		}
+		if (uid.Created == nil) != (want[i].Created == nil) || (uid.Created != nil && !uid.Created.Equal(*want[i].Created)) {
+			t.Errorf("user id %d was created %v, want %v", i, uid.Created, want[i].Created)
+		}
+	}
+	if key.UserID() != want[0].UserID {
+		t.Errorf("UserID() = %q, want %q", key.UserID(), want[0].UserID)
+	}
+}
+
+func TestParseSubkeys(t *testing.T) {
+	expires := testCreated.AddDate(0, 0, 1)
+	want := []Subkey{
+		{
+			Fingerprint: "AF7724B2F2A5B59B7BD88AC5D2E8945079BF88C1", Keygrip: "81241C51536C7A545F018EE0AC42488290842398",
+			Algorithm: "cv25519", Validity: "ultimate", Capabilities: []Capability{Encrypt},
+		},
+		{
+			Fingerprint: "B28E9571B713CA352883F629DCCCCF1D3C1BCA28", Keygrip: "0A93E2A438AF3EA8AC956221D5DF9446F3F89DF9",
+			Algorithm: "ed25519", Validity: "expired", Capabilities: []Capability{Sign}, Expires: &expires,
+		},
+		{
+			Fingerprint: "1F5D6EE6DC9F9908B7EC94536D0F721EE0340F69", Keygrip: "AF7D27E30ADFD978AE8E1D9ED6C7E8FF085A1CF0",
+			Algorithm: "rsa2048", Validity: "revoked", Capabilities: []Capability{Authenticate},
+		},
+	}
+	tests := []struct {
+		fixture    string
+		wantSecret SecretStatus
+	}{
+		{fixture: "list-keys.txt", wantSecret: SecretNone},
+		{fixture: "list-secret-keys.txt", wantSecret: SecretAvailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			key := parseFixture(t, tt.fixture)
+			if len(key.Subkeys) != len(want) {
+				t.Fatalf("Parse() returned %d subkeys, want %d", len(key.Subkeys), len(want))
+			}
+			for i, subkey := range key.Subkeys {
+				// the fpr and grp records following a subkey belong to it, not to the primary key
+				if subkey.Fingerprint != want[i].Fingerprint || subkey.KeyID != want[i].Fingerprint[24:] || subkey.Keygrip != want[i].Keygrip {
+					t.Errorf("subkey %d has fingerprint %s, key id %s and keygrip %s", i, subkey.Fingerprint, subkey.KeyID, subkey.Keygrip)
+				}
+				if subkey.Algorithm != want[i].Algorithm || subkey.Validity != want[i].Validity || !slices.Equal(subkey.Capabilities, want[i].Capabilities) {
+					t.Errorf("subkey %d is %s (%s) with capabilities %v", i, subkey.Algorithm, subkey.Validity, subkey.Capabilities)
+				}
+				if (subkey.Expires == nil) != (want[i].Expires == nil) || (subkey.Expires != nil && !subkey.Expires.Equal(*want[i].Expires)) {
+					t.Errorf("subkey %d expires %v, want %v", i, subkey.Expires, want[i].Expires)
+				}
+				if subkey.Secret != tt.wantSecret {
+					t.Errorf("subkey %d has secret status %q, want %q", i, subkey.Secret, tt.wantSecret)
+				}
+			}
+			if !key.Subkeys[1].IsExpired() || key.Subkeys[1].IsRevoked() || !key.Subkeys[2].IsRevoked() || key.Subkeys[0].IsRevoked() {
+				t.Error("IsExpired() or IsRevoked() does not match the validity of the subkeys")
+			}
+			if subkey, ok := key.FindSubkey(strings.ToLower(want[2].Fingerprint[24:]) + "!"); !ok || subkey.Fingerprint != want[2].Fingerprint {
+				t.Errorf("FindSubkey() by key id returned %s, %v", subkey.Fingerprint, ok)
+			}
+		})
+	}
+}
+
+// withSerial sets field 15 of the 'sec' and 'ssb' records, which holds the serial number of the card for keys on a
+// smartcard ('sec>'); a card listing cannot be captured without a card
+func withSerial(listing string, serial string) string {
+	lines := strings.Split(listing, "\n")
+	for i, line := range lines {
+		if fields := strings.Split(line, ":"); fields[0] == "sec" || fields[0] == "ssb" {
+			fields[14] = serial
+			lines[i] = strings.Join(fields, ":")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestParseSecretStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		serial     string
+		wantSecret SecretStatus
+		wantSerial string
+		wantType   string
+	}{
+		{name: "available", serial: "+", wantSecret: SecretAvailable, wantType: "sec"},
+		{name: "available with older gpg", serial: "", wantSecret: SecretAvailable, wantType: "sec"},
+		{name: "stub", serial: "#", wantSecret: SecretStub, wantType: "sec#"},
+		{name: "card", serial: "D2760001240100000006123456780000", wantSecret: SecretOnCard, wantSerial: "D2760001240100000006123456780000", wantType: "sec>"},
+	}
+	listing := readFixture(t, "list-secret-keys.txt")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := Parse(strings.NewReader(withSerial(listing, tt.serial)))
+			if err != nil {
+				t.Fatalf("Parse() returned error: %v", err)
+			}
+			key := keys[0]
+			for _, subkey := range append([]Subkey{key.Subkey}, key.Subkeys...) {
+				if subkey.Secret != tt.wantSecret || subkey.CardSerial != tt.wantSerial {
+					t.Errorf("key %s has secret status %q and card serial %q, want %q and %q", subkey.KeyID, subkey.Secret, subkey.CardSerial, tt.wantSecret, tt.wantSerial)
+				}
+			}
+			if got := recordType(key.Subkey, "pub", "sec"); got != tt.wantType {
+				t.Errorf("recordType() = %s, want %s", got, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestParseMultipleKeys(t *testing.T) {
+	listing := readFixture(t, "list-keys.txt")
+	second := strings.NewReplacer(testFingerprint, strings.Repeat("A", 40), testFingerprint[24:], strings.Repeat("A", 16)).Replace(listing)
+	keys, err := Parse(strings.NewReader(listing + second))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	if len(keys) != 2 || keys[0].Fingerprint != testFingerprint || keys[1].Fingerprint != strings.Repeat("A", 40) {
+		t.Fatalf("Parse() returned %d keys with unexpected fingerprints", len(keys))
+	}
+	if len(keys[0].Subkeys) != 3 || len(keys[1].Subkeys) != 3 || len(keys[0].UIDs) != 2 || len(keys[1].UIDs) != 2 {
+		t.Error("the subkeys or user ids of the second key were attached to the first one")
+	}
+}
+
+func TestParseRejectsInvalidRecords(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{name: "subkey without primary key", text: "ssb:u:255:18:D2E8945079BF88C1:1704067200::::::e:::+::cv25519::", wantErr: "line 1: 'ssb' record without primary key"},
+		{name: "uid without primary key", text: "tru::1:1792306796:0:3:1:5\nuid:u::::::::Jane Doe::::::::::0:", wantErr: "line 2: 'uid' record without primary key"},
+		{name: "truncated record", text: "pub:u:255:22:204AC40F1091FACA:1704067200", wantErr: "line 1: 'pub' record has only 6 fields"},
+		{name: "invalid length", text: "pub:u:x:22:204AC40F1091FACA:1704067200:::u:::cEC:::::ed25519:::0:", wantErr: "invalid key length 'x'"},
+		{name: "invalid creation date", text: "pub:u:255:22:204AC40F1091FACA:yesterday:::u:::cEC:::::ed25519:::0:", wantErr: "invalid creation date"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.text))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() returned %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: `Jane Doe (work\x3a laptop)`, want: "Jane Doe (work: laptop)"},
+		{value: `back\x5cslash\x3a`, want: `back\slash:`},
+		{value: `J\xc3\xa9r\xc3\xb4me`, want: "Jérôme"},
+		{value: `not hex \xZZ`, want: `not hex \xZZ`},
+		{value: `truncated \x3`, want: `truncated \x3`},
+		{value: "plain", want: "plain"},
+	}
+	for _, tt := range tests {
+		if got := unescape(tt.value); got != tt.want {
+			t.Errorf("unescape(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package openpgp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	crc24Init = 0xB704CE
+	crc24Poly = 0x1864CFB
+)
+
+// CRC24 computes the checksum used by ASCII armor (RFC 4880, section 6.1)
+func CRC24(data []byte) uint32 {
+	crc := uint32(crc24Init)
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= crc24Poly
+			}
+		}
+	}
+	return crc & 0xFFFFFF
+}
+
+// ArmorBlock is a decoded ASCII armored block, e.g. 'PGP PRIVATE KEY BLOCK'
+type ArmorBlock struct {
+	Type string
+	Data []byte
+}
+
+// Dearmor decodes the first ASCII armored block in data and verifies its checksum
+func Dearmor(data []byte) (ArmorBlock, error) {
+	var block ArmorBlock
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	inBlock := false
+	inHeaders := false
+	var body strings.Builder
+	checksum := ""
+	for scanner.Scan() {
+		// gpg prefixes the certificates in 'openpgp-revocs.d' with a colon to prevent an accidental import
+		line := strings.TrimPrefix(strings.TrimSpace(scanner.Text()), ":")
+		switch {
+		case !inBlock:
+			if strings.HasPrefix(line, "-----BEGIN ") && strings.HasSuffix(line, "-----") {
+				block.Type = strings.TrimSuffix(strings.TrimPrefix(line, "-----BEGIN "), "-----")
+				inBlock = true
+				inHeaders = true
+			}
+		case strings.HasPrefix(line, "-----END "):
+			decoded, err := base64.StdEncoding.DecodeString(body.String())
+			if err != nil {
+				return block, fmt.Errorf("invalid armor: %w", err)
+			}
+			if checksum != "" {
+				expected, err := base64.StdEncoding.DecodeString(checksum)
+				if err != nil || len(expected) != 3 {
+					return block, fmt.Errorf("invalid armor checksum '%s'", checksum)
+				}
+				if CRC24(decoded) != uint32(expected[0])<<16|uint32(expected[1])<<8|uint32(expected[2]) {
+					return block, fmt.Errorf("armor checksum mismatch, the data is corrupted")
+				}
+			}
+			block.Data = decoded
+			return block, nil
+		case inHeaders:
+			// the headers (e.g. 'Comment: ...') end with an empty line
+			if line == "" {
+				inHeaders = false
+			} else if !strings.Contains(line, ": ") {
+				inHeaders = false
+				body.WriteString(line)
+			}
+		case strings.HasPrefix(line, "=") && len(line) == 5:
+			checksum = line[1:]
+		default:
+			body.WriteString(line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return block, err
+	}
+	if !inBlock {
+		return block, fmt.Errorf("no ASCII armored block found")
+	}
+	return block, fmt.Errorf("ASCII armored block '%s' is not terminated", block.Type)
+}
+
+// Armor writes data as an ASCII armored block of the given type, e.g. 'PGP PRIVATE KEY BLOCK'
+func Armor(w io.Writer, blockType string, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var out strings.Builder
+	fmt.Fprintf(&out, "-----BEGIN %s-----\n\n", blockType)
+	for len(encoded) > 64 {
+		out.WriteString(encoded[:64] + "\n")
+		encoded = encoded[64:]
+	}
+	if encoded != "" {
+		out.WriteString(encoded + "\n")
+	}
+	crc := CRC24(data)
+	fmt.Fprintf(&out, "=%s\n", base64.StdEncoding.EncodeToString([]byte{byte(crc >> 16), byte(crc >> 8), byte(crc)}))
+	fmt.Fprintf(&out, "-----END %s-----\n", blockType)
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// ReadKeyData returns the binary OpenPGP data of an exported key, which may be ASCII armored
+func ReadKeyData(data []byte) ([]byte, error) {
+	if bytes.Contains(data, []byte("-----BEGIN PGP ")) {
+		block, err := Dearmor(data)
+		if err != nil {
+			return nil, err
+		}
+		return block.Data, nil
+	}
+	return data, nil
+}
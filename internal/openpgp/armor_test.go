@@ -0,0 +1,107 @@
+package openpgp
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCRC24(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want uint32
+	}{
+		{data: nil, want: 0xB704CE},
+		{data: []byte{}, want: 0xB704CE},
+		// the check value of CRC-24/OPENPGP
+		{data: []byte("123456789"), want: 0x21CF02},
+	}
+	for _, tt := range tests {
+		if got := CRC24(tt.data); got != tt.want {
+			t.Errorf("CRC24(%q) = %06X, want %06X", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestArmorDearmor(t *testing.T) {
+	for _, length := range []int{0, 1, 47, 48, 49, 200} {
+		data := bytes.Repeat([]byte{0x5A, 0xA5, 0x00}, length)[:length]
+		var armored bytes.Buffer
+		if err := Armor(&armored, "PGP PRIVATE KEY BLOCK", data); err != nil {
+			t.Fatal(err)
+		}
+		block, err := Dearmor(armored.Bytes())
+		if err != nil {
+			t.Fatalf("Dearmor() of %d octets returned error: %v\n%s", length, err, armored.String())
+		}
+		if block.Type != "PGP PRIVATE KEY BLOCK" || !bytes.Equal(block.Data, data) {
+			t.Errorf("Dearmor() of %d octets returned %q with %d octets", length, block.Type, len(block.Data))
+		}
+	}
+}
+
+func TestDearmorFixture(t *testing.T) {
+	armored, err := os.ReadFile(filepath.Join("testdata", "public-key.asc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := Dearmor(armored)
+	if err != nil {
+		t.Fatalf("Dearmor() returned error: %v", err)
+	}
+	if block.Type != "PGP PUBLIC KEY BLOCK" {
+		t.Errorf("Dearmor() returned block type %q", block.Type)
+	}
+	// gpg prefixes the lines of the certificates in 'openpgp-revocs.d' with a colon
+	colonPrefixed := strings.ReplaceAll(string(armored), "\n", "\n:")
+	fromRevocs, err := Dearmor([]byte(":" + colonPrefixed))
+	if err != nil {
+		t.Fatalf("Dearmor() of colon prefixed lines returned error: %v", err)
+	}
+	if !bytes.Equal(fromRevocs.Data, block.Data) {
+		t.Error("Dearmor() of colon prefixed lines returned different data")
+	}
+}
+
+func TestDearmorRejectsCorruptedData(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := Armor(&buffer, "PGP PUBLIC KEY BLOCK", []byte("public key packets")); err != nil {
+		t.Fatal(err)
+	}
+	armored := buffer.String()
+	lines := strings.Split(armored, "\n")
+	checksumLine := lines[len(lines)-3]
+	if !strings.HasPrefix(checksumLine, "=") {
+		t.Fatalf("unexpected armor:\n%s", armored)
+	}
+
+	tests := []struct {
+		name    string
+		armored string
+		wantErr string
+	}{
+		{name: "bad checksum", armored: strings.Replace(armored, checksumLine, "=AAAA", 1), wantErr: "checksum mismatch"},
+		{name: "corrupted data", armored: strings.Replace(armored, lines[2], "Q"+lines[2][1:], 1), wantErr: "checksum mismatch"},
+		{name: "invalid checksum", armored: strings.Replace(armored, checksumLine, "=!!!!", 1), wantErr: "invalid armor checksum"},
+		{name: "not terminated", armored: strings.Join(lines[:len(lines)-2], "\n"), wantErr: "not terminated"},
+		{name: "no block", armored: "just text\n", wantErr: "no ASCII armored block"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Dearmor([]byte(tt.armored))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Dearmor() returned %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadKeyDataPassesBinaryThrough(t *testing.T) {
+	binary := []byte{0x99, 0x00, 0x01, 0x04}
+	data, err := ReadKeyData(binary)
+	if err != nil || !bytes.Equal(data, binary) {
+		t.Errorf("ReadKeyData() of binary data returned %v, %v", data, err)
+	}
+}
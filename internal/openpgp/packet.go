@@ -0,0 +1,195 @@
+package openpgp
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+// Packet tags (RFC 4880, section 4.3)
+const (
+	TagSignature    = 2
+	TagSecretKey    = 5
+	TagPublicKey    = 6
+	TagSecretSubkey = 7
+	TagUserID       = 13
+	TagPublicSubkey = 14
+)
+
+type Packet struct {
+	Tag  int
+	Body []byte
+}
+
+// ReadPackets splits binary OpenPGP data into its packets
+func ReadPackets(data []byte) ([]Packet, error) {
+	packets := []Packet{}
+	for len(data) > 0 {
+		header := data[0]
+		if header&0x80 == 0 {
+			return nil, fmt.Errorf("invalid packet header 0x%02x", header)
+		}
+		var tag, offset, length int
+		if header&0x40 != 0 {
+			// new format
+			tag = int(header & 0x3F)
+			if len(data) < 2 {
+				return nil, fmt.Errorf("truncated packet header")
+			}
+			switch first := int(data[1]); {
+			case first < 192:
+				offset, length = 2, first
+			case first < 224:
+				if len(data) < 3 {
+					return nil, fmt.Errorf("truncated packet header")
+				}
+				offset, length = 3, (first-192)<<8+int(data[2])+192
+			case first == 255:
+				if len(data) < 6 {
+					return nil, fmt.Errorf("truncated packet header")
+				}
+				offset, length = 6, int(binary.BigEndian.Uint32(data[2:6]))
+			default:
+				return nil, fmt.Errorf("partial body lengths are not supported in key packets")
+			}
+		} else {
+			// old format
+			tag = int(header>>2) & 0x0F
+			switch header & 0x03 {
+			case 0:
+				if len(data) < 2 {
+					return nil, fmt.Errorf("truncated packet header")
+				}
+				offset, length = 2, int(data[1])
+			case 1:
+				if len(data) < 3 {
+					return nil, fmt.Errorf("truncated packet header")
+				}
+				offset, length = 3, int(binary.BigEndian.Uint16(data[1:3]))
+			case 2:
+				if len(data) < 5 {
+					return nil, fmt.Errorf("truncated packet header")
+				}
+				offset, length = 5, int(binary.BigEndian.Uint32(data[1:5]))
+			default:
+				offset, length = 1, len(data)-1
+			}
+		}
+		if offset+length > len(data) {
+			return nil, fmt.Errorf("truncated packet (tag %d)", tag)
+		}
+		packets = append(packets, Packet{Tag: tag, Body: data[offset : offset+length]})
+		data = data[offset+length:]
+	}
+	return packets, nil
+}
+
+// Serialize returns the packet with a new format header
+func (packet Packet) Serialize() []byte {
+	out := []byte{0xC0 | byte(packet.Tag)}
+	length := len(packet.Body)
+	switch {
+	case length < 192:
+		out = append(out, byte(length))
+	case length < 8384:
+		length -= 192
+		out = append(out, byte(length>>8+192), byte(length))
+	default:
+		out = append(out, 255)
+		out = binary.BigEndian.AppendUint32(out, uint32(length))
+	}
+	return append(out, packet.Body...)
+}
+
+// publicKeyLength returns the length of the public key fields at the start of a version 4 (secret) key packet body
+func publicKeyLength(body []byte) (int, error) {
+	if len(body) < 6 {
+		return 0, fmt.Errorf("key packet is too short")
+	}
+	if body[0] != 4 {
+		return 0, fmt.Errorf("only version 4 keys are supported, found version %d", body[0])
+	}
+	offset := 6
+	mpis := func(n int) error {
+		for i := 0; i < n; i++ {
+			if offset+2 > len(body) {
+				return fmt.Errorf("truncated key material")
+			}
+			bits := int(binary.BigEndian.Uint16(body[offset : offset+2]))
+			offset += 2 + (bits+7)/8
+		}
+		if offset > len(body) {
+			return fmt.Errorf("truncated key material")
+		}
+		return nil
+	}
+	// skipOctetString skips a field that is prefixed by its length in one octet, e.g. a curve OID
+	skipOctetString := func() error {
+		if offset >= len(body) {
+			return fmt.Errorf("truncated key material")
+		}
+		offset += 1 + int(body[offset])
+		if offset > len(body) {
+			return fmt.Errorf("truncated key material")
+		}
+		return nil
+	}
+
+	var err error
+	switch algorithm := body[5]; algorithm {
+	case 1, 2, 3: // RSA
+		err = mpis(2)
+	case 16: // Elgamal
+		err = mpis(3)
+	case 17: // DSA
+		err = mpis(4)
+	case 19, 22: // ECDSA, EdDSA
+		if err = skipOctetString(); err == nil {
+			err = mpis(1)
+		}
+	case 18: // ECDH
+		if err = skipOctetString(); err == nil {
+			if err = mpis(1); err == nil {
+				err = skipOctetString()
+			}
+		}
+	default:
+		err = fmt.Errorf("unsupported public key algorithm %d", algorithm)
+	}
+	return offset, err
+}
+
+// curveNames maps the hex encoded OIDs of the curves (RFC 6637 and RFC 4880bis) to their names in gpg
+var curveNames = map[string]string{
+	"2b06010401da470f01":   "ed25519",
+	"2b060104019755010501": "cv25519",
+	"2a8648ce3d030107":     "nistp256",
+	"2b81040022":           "nistp384",
+	"2b81040023":           "nistp521",
+	"2b2403030208010107":   "brainpoolP256r1",
+	"2b240303020801010b":   "brainpoolP384r1",
+	"2b240303020801010d":   "brainpoolP512r1",
+}
+
+// algorithmName returns the algorithm of a key packet body that passed publicKeyLength as listed by gpg,
+// e.g. 'rsa4096' or 'ed25519', or 'unknown'
+func algorithmName(body []byte) string {
+	switch body[5] {
+	case 1, 2, 3:
+		return fmt.Sprintf("rsa%d", binary.BigEndian.Uint16(body[6:8]))
+	case 18, 19, 22:
+		if name, ok := curveNames[hex.EncodeToString(body[7:7+int(body[6])])]; ok {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// Fingerprint returns the version 4 fingerprint of the public key fields of a key packet
+func Fingerprint(publicKey []byte) []byte {
+	hash := sha1.New()
+	hash.Write([]byte{0x99, byte(len(publicKey) >> 8), byte(len(publicKey))})
+	hash.Write(publicKey)
+	return hash.Sum(nil)
+}
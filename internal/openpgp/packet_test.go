@@ -0,0 +1,56 @@
+package openpgp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPacketSerializeReadPackets(t *testing.T) {
+	// one-octet, two-octet and five-octet lengths and their boundaries
+	for _, length := range []int{0, 191, 192, 1000, 8383, 8384, 70000} {
+		packet := Packet{Tag: TagSecretSubkey, Body: bytes.Repeat([]byte{0x42}, length)}
+		packets, err := ReadPackets(packet.Serialize())
+		if err != nil {
+			t.Fatalf("ReadPackets() of a %d octet packet returned error: %v", length, err)
+		}
+		if len(packets) != 1 || packets[0].Tag != TagSecretSubkey || !bytes.Equal(packets[0].Body, packet.Body) {
+			t.Errorf("ReadPackets() did not return the serialized %d octet packet", length)
+		}
+	}
+}
+
+func TestReadPacketsOldFormat(t *testing.T) {
+	data := []byte{
+		0xB4, 0x02, 'i', 'd', // user id, one-octet length
+		0x9D, 0x00, 0x03, 1, 2, 3, // secret subkey, two-octet length
+		0x8A, 0x00, 0x00, 0x00, 0x01, 9, // signature, four-octet length
+	}
+	packets, err := ReadPackets(data)
+	if err != nil {
+		t.Fatalf("ReadPackets() returned error: %v", err)
+	}
+	want := []Packet{{Tag: TagUserID, Body: []byte("id")}, {Tag: TagSecretSubkey, Body: []byte{1, 2, 3}}, {Tag: TagSignature, Body: []byte{9}}}
+	if len(packets) != len(want) {
+		t.Fatalf("ReadPackets() returned %d packets, want %d", len(packets), len(want))
+	}
+	for i := range want {
+		if packets[i].Tag != want[i].Tag || !bytes.Equal(packets[i].Body, want[i].Body) {
+			t.Errorf("packet %d: got tag %d %v, want tag %d %v", i, packets[i].Tag, packets[i].Body, want[i].Tag, want[i].Body)
+		}
+	}
+}
+
+func TestReadPacketsRejectsInvalidData(t *testing.T) {
+	tests := map[string][]byte{
+		"no packet header":     {0x00, 0x01},
+		"truncated header":     {0xC5},
+		"truncated two-octet":  {0xC5, 0xC0},
+		"truncated packet":     {0xC5, 0x05, 1, 2},
+		"partial body lengths": {0xC5, 0xE0, 1},
+	}
+	for name, data := range tests {
+		if _, err := ReadPackets(data); err == nil {
+			t.Errorf("ReadPackets() of %s returned no error", name)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package openpgp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// paperBytesPerLine keeps the lines short enough to be typed in without losing track
+const paperBytesPerLine = 16
+
+// EncodePaperText renders data as numbered lines of hex octets, each followed by the CRC24 of the line,
+// and a last line with the CRC24 of all data, so typos can be found when typing it in again
+func EncodePaperText(data []byte) string {
+	var out strings.Builder
+	line := 1
+	for offset := 0; offset < len(data); offset += paperBytesPerLine {
+		chunk := data[offset:min(offset+paperBytesPerLine, len(data))]
+		octets := make([]string, len(chunk))
+		for i, b := range chunk {
+			octets[i] = fmt.Sprintf("%02X", b)
+		}
+		fmt.Fprintf(&out, "%3d: %s %06X\n", line, strings.Join(octets, " "), CRC24(chunk))
+		line++
+	}
+	fmt.Fprintf(&out, "%3d: %06X\n", line, CRC24(data))
+	return out.String()
+}
+
+// DecodePaperText parses the output of EncodePaperText, ignoring empty lines and comments starting with '#'
+func DecodePaperText(text string) ([]byte, error) {
+	data := []byte{}
+	expectedLine := 1
+	for _, rawLine := range strings.Split(text, "\n") {
+		line := strings.TrimSpace(rawLine)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		number, rest, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("line %d: missing line number", expectedLine)
+		}
+		lineNumber, err := strconv.Atoi(strings.TrimSpace(number))
+		if err != nil || lineNumber != expectedLine {
+			return nil, fmt.Errorf("line %d: unexpected line number '%s'", expectedLine, strings.TrimSpace(number))
+		}
+		fields := strings.Fields(strings.ToUpper(rest))
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("line %d: missing data", lineNumber)
+		}
+		checksum, err := parseChecksum(fields[len(fields)-1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if len(fields) == 1 {
+			if CRC24(data) != checksum {
+				return nil, fmt.Errorf("line %d: checksum of all data does not match, a line may be missing", lineNumber)
+			}
+			return data, nil
+		}
+		chunk, err := hex.DecodeString(strings.Join(fields[:len(fields)-1], ""))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid hex data", lineNumber)
+		}
+		if CRC24(chunk) != checksum {
+			return nil, fmt.Errorf("line %d: checksum does not match, check the line for typos", lineNumber)
+		}
+		data = append(data, chunk...)
+		expectedLine++
+	}
+	return nil, fmt.Errorf("line %d: missing final checksum line", expectedLine)
+}
+
+func parseChecksum(field string) (uint32, error) {
+	if len(field) != 6 {
+		return 0, fmt.Errorf("invalid checksum '%s'", field)
+	}
+	checksum, err := strconv.ParseUint(field, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid checksum '%s'", field)
+	}
+	return uint32(checksum), nil
+}
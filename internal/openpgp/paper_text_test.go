@@ -0,0 +1,79 @@
+package openpgp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testPaperData(length int) []byte {
+	data := make([]byte, length)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+func TestPaperTextRoundTrip(t *testing.T) {
+	for _, length := range []int{0, 1, 15, 16, 17, 100} {
+		data := testPaperData(length)
+		decoded, err := DecodePaperText(EncodePaperText(data))
+		if err != nil {
+			t.Fatalf("DecodePaperText() of %d octets returned error: %v", length, err)
+		}
+		if !bytes.Equal(decoded, data) {
+			t.Errorf("DecodePaperText() of %d octets returned different data", length)
+		}
+	}
+}
+
+func TestDecodePaperTextIgnoresCommentsAndCase(t *testing.T) {
+	data := testPaperData(40)
+	text := "# Secret key of Jane Doe\n\n" + strings.ToLower(EncodePaperText(data)) + "\n"
+	decoded, err := DecodePaperText(text)
+	if err != nil {
+		t.Fatalf("DecodePaperText() returned error: %v", err)
+	}
+	if !bytes.Equal(decoded, data) {
+		t.Error("DecodePaperText() returned different data")
+	}
+}
+
+func TestDecodePaperTextDetectsErrors(t *testing.T) {
+	// 40 octets are 3 lines of data and the final checksum line
+	lines := strings.Split(strings.TrimSuffix(EncodePaperText(testPaperData(40)), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("unexpected paper text:\n%s", strings.Join(lines, "\n"))
+	}
+	typo := func(line string) string {
+		// the first octet follows the line number, e.g. '  2: 70 77 ...'
+		i := strings.Index(line, ": ") + 2
+		replacement := "F"
+		if line[i] == 'F' {
+			replacement = "E"
+		}
+		return line[:i] + replacement + line[i+1:]
+	}
+	renumberedFinal := strings.Replace(lines[3], "  4:", "  3:", 1)
+
+	tests := []struct {
+		name    string
+		lines   []string
+		wantErr string
+	}{
+		{name: "typo", lines: []string{lines[0], typo(lines[1]), lines[2], lines[3]}, wantErr: "line 2: checksum does not match"},
+		{name: "missing line", lines: []string{lines[0], lines[2], lines[3]}, wantErr: "line 2: unexpected line number"},
+		{name: "missing last data line", lines: []string{lines[0], lines[1], renumberedFinal}, wantErr: "a line may be missing"},
+		{name: "missing final checksum", lines: lines[:3], wantErr: "missing final checksum line"},
+		{name: "missing line number", lines: []string{"70 77 7E"}, wantErr: "missing line number"},
+		{name: "invalid checksum", lines: []string{"  1: 00 01 XYZ"}, wantErr: "invalid checksum"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodePaperText(strings.Join(tt.lines, "\n"))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("DecodePaperText() returned %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package openpgp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// paperkeyVersion is the first octet of encoded secrets, to be able to change the format later on
+const paperkeyVersion = 0
+
+// SecretKey holds the secret fields of a (sub)key packet, identified by the fingerprint of its public key.
+// The secret fields stay protected by the passphrase of the key.
+type SecretKey struct {
+	Fingerprint []byte
+	Secret      []byte
+}
+
+// KeyInfo describes the primary key of a transferable key
+type KeyInfo struct {
+	Fingerprint []byte
+	// Algorithm is named as in the key listing of gpg, e.g. 'rsa4096' or 'ed25519'
+	Algorithm string
+	Created   time.Time
+	UserIDs   []string
+}
+
+func (info KeyInfo) FingerprintHex() string {
+	return strings.ToUpper(hex.EncodeToString(info.Fingerprint))
+}
+
+// ReadKeyInfo returns the fingerprint, algorithm, creation date and user ids of the primary key
+func ReadKeyInfo(data []byte) (KeyInfo, error) {
+	packets, err := ReadPackets(data)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	var info KeyInfo
+	for _, packet := range packets {
+		switch packet.Tag {
+		case TagPublicKey, TagSecretKey:
+			if info.Fingerprint != nil {
+				return info, fmt.Errorf("only a single primary key is supported")
+			}
+			length, err := publicKeyLength(packet.Body)
+			if err != nil {
+				return info, err
+			}
+			info.Fingerprint = Fingerprint(packet.Body[:length])
+			info.Algorithm = algorithmName(packet.Body)
+			info.Created = time.Unix(int64(binary.BigEndian.Uint32(packet.Body[1:5])), 0).UTC()
+		case TagUserID:
+			info.UserIDs = append(info.UserIDs, string(packet.Body))
+		}
+	}
+	if info.Fingerprint == nil {
+		return info, fmt.Errorf("no primary key found")
+	}
+	return info, nil
+}
+
+// ExtractSecrets returns the secret fields of the primary key and all subkeys of an exported secret key,
+// which are all that is needed to restore the secret key along with the public key (as paperkey does)
+func ExtractSecrets(data []byte) ([]SecretKey, error) {
+	packets, err := ReadPackets(data)
+	if err != nil {
+		return nil, err
+	}
+	secrets := []SecretKey{}
+	for _, packet := range packets {
+		if packet.Tag != TagSecretKey && packet.Tag != TagSecretSubkey {
+			continue
+		}
+		length, err := publicKeyLength(packet.Body)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, SecretKey{
+			Fingerprint: Fingerprint(packet.Body[:length]),
+			Secret:      packet.Body[length:],
+		})
+	}
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("no secret keys found")
+	}
+	return secrets, nil
+}
+
+// EncodeSecrets serializes the secrets as a version octet followed by the fingerprint,
+// the length (2 octets) and the secret fields of each key
+func EncodeSecrets(secrets []SecretKey) []byte {
+	out := []byte{paperkeyVersion}
+	for _, secret := range secrets {
+		out = append(out, secret.Fingerprint...)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(secret.Secret)))
+		out = append(out, secret.Secret...)
+	}
+	return out
+}
+
+func DecodeSecrets(data []byte) ([]SecretKey, error) {
+	if len(data) == 0 || data[0] != paperkeyVersion {
+		return nil, fmt.Errorf("unsupported secrets format")
+	}
+	data = data[1:]
+	secrets := []SecretKey{}
+	for len(data) > 0 {
+		if len(data) < 22 {
+			return nil, fmt.Errorf("truncated secrets")
+		}
+		length := int(binary.BigEndian.Uint16(data[20:22]))
+		if len(data) < 22+length {
+			return nil, fmt.Errorf("truncated secrets")
+		}
+		secrets = append(secrets, SecretKey{Fingerprint: data[:20], Secret: data[22 : 22+length]})
+		data = data[22+length:]
+	}
+	return secrets, nil
+}
+
+// RestoreSecretKey combines an exported public key with the secret fields of its keys into a secret key
+// that can be imported with 'gpg --import'. Subkeys without secret fields are left out.
+func RestoreSecretKey(publicKeyData []byte, secrets []SecretKey) ([]byte, error) {
+	packets, err := ReadPackets(publicKeyData)
+	if err != nil {
+		return nil, err
+	}
+	findSecret := func(body []byte) ([]byte, bool, error) {
+		length, err := publicKeyLength(body)
+		if err != nil {
+			return nil, false, err
+		}
+		fingerprint := Fingerprint(body[:length])
+		for _, secret := range secrets {
+			if bytes.Equal(secret.Fingerprint, fingerprint) {
+				return append(append([]byte{}, body[:length]...), secret.Secret...), true, nil
+			}
+		}
+		return nil, false, nil
+	}
+
+	var out bytes.Buffer
+	hasPrimary := false
+	// skipping leaves out a subkey without secret fields along with its binding signature
+	skipping := false
+	for _, packet := range packets {
+		switch packet.Tag {
+		case TagPublicKey:
+			if hasPrimary {
+				return nil, fmt.Errorf("only a single primary key is supported")
+			}
+			body, ok, err := findSecret(packet.Body)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, fmt.Errorf("the secrets do not belong to the public key")
+			}
+			hasPrimary = true
+			out.Write(Packet{Tag: TagSecretKey, Body: body}.Serialize())
+		case TagPublicSubkey:
+			body, ok, err := findSecret(packet.Body)
+			if err != nil {
+				return nil, err
+			}
+			skipping = !ok
+			if ok {
+				out.Write(Packet{Tag: TagSecretSubkey, Body: body}.Serialize())
+			}
+		case TagSignature:
+			if !skipping {
+				out.Write(packet.Serialize())
+			}
+		case 12: // trust packets are local to a keyring
+		default:
+			skipping = false
+			out.Write(packet.Serialize())
+		}
+	}
+	if !hasPrimary {
+		return nil, fmt.Errorf("no public key found")
+	}
+	return out.Bytes(), nil
+}
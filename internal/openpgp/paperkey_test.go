@@ -0,0 +1,155 @@
+package openpgp
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testFingerprint is the fingerprint of the key in testdata: an ed25519 master key (certify only)
+// with an rsa2048 encryption subkey, whose secret packet needs a two-octet length
+const testFingerprint = "CF3708BE59878656536F3C64293BBA13E2721659"
+
+// readFixture returns the binary OpenPGP data of an armored export in testdata
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	armored, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ReadKeyData(armored)
+	if err != nil {
+		t.Fatalf("ReadKeyData(%s) returned error: %v", name, err)
+	}
+	return data
+}
+
+func TestPaperBackupRoundTrip(t *testing.T) {
+	secretKeyData := readFixture(t, "secret-key.asc")
+	publicKeyData := readFixture(t, "public-key.asc")
+
+	secrets, err := ExtractSecrets(secretKeyData)
+	if err != nil {
+		t.Fatalf("ExtractSecrets() returned error: %v", err)
+	}
+	if len(secrets) != 2 {
+		t.Fatalf("ExtractSecrets() returned %d secrets, want the master key and the subkey", len(secrets))
+	}
+	if len(secrets[1].Secret) < 192 {
+		t.Fatalf("the secret of the RSA subkey has %d octets, the fixture should need a two-octet length", len(secrets[1].Secret))
+	}
+
+	encoded := EncodeSecrets(secrets)
+	text := EncodePaperText(encoded)
+	decoded, err := DecodePaperText(text)
+	if err != nil {
+		t.Fatalf("DecodePaperText() returned error: %v", err)
+	}
+	if !bytes.Equal(decoded, encoded) {
+		t.Fatal("DecodePaperText() did not return the encoded secrets")
+	}
+	decodedSecrets, err := DecodeSecrets(decoded)
+	if err != nil {
+		t.Fatalf("DecodeSecrets() returned error: %v", err)
+	}
+	restored, err := RestoreSecretKey(publicKeyData, decodedSecrets)
+	if err != nil {
+		t.Fatalf("RestoreSecretKey() returned error: %v", err)
+	}
+
+	// gpg writes old format packet headers, RestoreSecretKey new format ones, so the packets are compared
+	want, err := ReadPackets(secretKeyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadPackets(restored)
+	if err != nil {
+		t.Fatalf("ReadPackets() of the restored key returned error: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("restored key has %d packets, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Tag != want[i].Tag || !bytes.Equal(got[i].Body, want[i].Body) {
+			t.Errorf("restored packet %d (tag %d) differs from the exported packet (tag %d)", i, got[i].Tag, want[i].Tag)
+		}
+	}
+}
+
+func TestReadKeyInfo(t *testing.T) {
+	for _, name := range []string{"secret-key.asc", "public-key.asc"} {
+		info, err := ReadKeyInfo(readFixture(t, name))
+		if err != nil {
+			t.Fatalf("ReadKeyInfo(%s) returned error: %v", name, err)
+		}
+		if info.FingerprintHex() != testFingerprint {
+			t.Errorf("ReadKeyInfo(%s) returned fingerprint %s, want %s", name, info.FingerprintHex(), testFingerprint)
+		}
+		if info.Algorithm != "ed25519" {
+			t.Errorf("ReadKeyInfo(%s) returned algorithm %s, want ed25519", name, info.Algorithm)
+		}
+		if want := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC); !info.Created.Equal(want) {
+			t.Errorf("ReadKeyInfo(%s) returned creation date %s, want %s", name, info.Created, want)
+		}
+		if len(info.UserIDs) != 1 || info.UserIDs[0] != "Jane Doe <jane@example.com>" {
+			t.Errorf("ReadKeyInfo(%s) returned user ids %q", name, info.UserIDs)
+		}
+	}
+}
+
+func TestExtractSecretsRejectsPublicKey(t *testing.T) {
+	if _, err := ExtractSecrets(readFixture(t, "public-key.asc")); err == nil {
+		t.Error("ExtractSecrets() of a public key returned no error")
+	}
+}
+
+func TestRestoreSecretKeyLeavesOutSubkeysWithoutSecrets(t *testing.T) {
+	secrets, err := ExtractSecrets(readFixture(t, "secret-key.asc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := RestoreSecretKey(readFixture(t, "public-key.asc"), secrets[:1])
+	if err != nil {
+		t.Fatalf("RestoreSecretKey() returned error: %v", err)
+	}
+	packets, err := ReadPackets(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := []int{}
+	for _, packet := range packets {
+		tags = append(tags, packet.Tag)
+	}
+	if want := []int{TagSecretKey, TagUserID, TagSignature}; !slices.Equal(tags, want) {
+		t.Errorf("restored key has packets %v, want %v", tags, want)
+	}
+}
+
+func TestRestoreSecretKeyRejectsSecretsOfOtherKey(t *testing.T) {
+	secrets, err := ExtractSecrets(readFixture(t, "secret-key.asc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := []SecretKey{{Fingerprint: bytes.Repeat([]byte{0xAB}, 20), Secret: secrets[0].Secret}}
+	if _, err := RestoreSecretKey(readFixture(t, "public-key.asc"), other); err == nil {
+		t.Error("RestoreSecretKey() with the secrets of another key returned no error")
+	}
+}
+
+func TestDecodeSecretsRejectsInvalidData(t *testing.T) {
+	encoded := EncodeSecrets([]SecretKey{{Fingerprint: bytes.Repeat([]byte{1}, 20), Secret: []byte("secret")}})
+	tests := map[string][]byte{
+		"empty":               {},
+		"unsupported version": append([]byte{1}, encoded[1:]...),
+		"truncated header":    encoded[:10],
+		"truncated secret":    encoded[:len(encoded)-1],
+	}
+	for name, data := range tests {
+		if _, err := DecodeSecrets(data); err == nil {
+			t.Errorf("DecodeSecrets() of %s data returned no error", name)
+		}
+	}
+}
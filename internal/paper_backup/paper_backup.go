@@ -0,0 +1,157 @@
+package paperbackup
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	openpgp "perfect-gpg-keypair/internal/openpgp"
+)
+
+// restoreInstructions explains how to get the secret key back from the paper backup
+const restoreInstructions = `To restore the secret key:
+ 1. Type the numbered lines below into a text file (the checksum at the end of each line catches typos).
+ 2. Get the public key, e.g. the '.public-master.gpg' backup or from a keyserver.
+ 3. Run: perfect-gpg-keypair restore --from-paper <text file> --public-key <public key>
+ 4. Import the restored key with: gpg --import <restored key>
+The secret key is still protected by its passphrase, which is needed to use it.`
+
+// PaperBackup is the secret part of a master key, ready to be printed
+type PaperBackup struct {
+	Key  openpgp.KeyInfo
+	Text string
+}
+
+// New extracts the secret fields of all keys of an exported secret key (e.g. '.private-master.gpg')
+func New(privateKeyData []byte) (PaperBackup, error) {
+	data, err := openpgp.ReadKeyData(privateKeyData)
+	if err != nil {
+		return PaperBackup{}, err
+	}
+	info, err := openpgp.ReadKeyInfo(data)
+	if err != nil {
+		return PaperBackup{}, err
+	}
+	secrets, err := openpgp.ExtractSecrets(data)
+	if err != nil {
+		return PaperBackup{}, err
+	}
+	return PaperBackup{Key: info, Text: openpgp.EncodePaperText(openpgp.EncodeSecrets(secrets))}, nil
+}
+
+// Create writes the paper backup of the exported secret key as text and as a printable HTML sheet
+func Create(privateKeyFilePath string, textFilePath string, htmlFilePath string) error {
+	privateKeyData, err := os.ReadFile(privateKeyFilePath)
+	if err != nil {
+		return err
+	}
+	paperBackup, err := New(privateKeyData)
+	if err != nil {
+		return fmt.Errorf("could not extract secret key: %w", err)
+	}
+	var text bytes.Buffer
+	if err := paperBackup.WriteText(&text); err != nil {
+		return err
+	}
+	if err := os.WriteFile(textFilePath, text.Bytes(), 0600); err != nil {
+		return err
+	}
+	var html bytes.Buffer
+	if err := paperBackup.WriteHTML(&html); err != nil {
+		return err
+	}
+	return os.WriteFile(htmlFilePath, html.Bytes(), 0600)
+}
+
+func (paperBackup PaperBackup) header() string {
+	lines := []string{
+		"Secret key of " + paperBackup.Key.FingerprintHex(),
+		"Created: " + paperBackup.Key.Created.Format(time.DateOnly),
+	}
+	for _, userID := range paperBackup.Key.UserIDs {
+		lines = append(lines, "User ID: "+userID)
+	}
+	return strings.Join(append(lines, "", restoreInstructions), "\n")
+}
+
+// WriteText writes the paper backup as plain text, all lines but the data are comments starting with '#'
+func (paperBackup PaperBackup) WriteText(w io.Writer) error {
+	var out strings.Builder
+	for _, line := range strings.Split(paperBackup.header(), "\n") {
+		out.WriteString(strings.TrimRight("# "+line, " ") + "\n")
+	}
+	out.WriteString("\n" + paperBackup.Text)
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+var sheetTemplate = template.Must(template.New("sheet").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Paper backup of {{.Key.FingerprintHex}}</title>
+<style>
+  body { font-family: sans-serif; margin: 2em; }
+  pre { font-family: "Courier New", monospace; font-size: 11pt; line-height: 1.4; }
+  table { border-collapse: collapse; }
+  td { padding: 0.2em 1em 0.2em 0; vertical-align: top; }
+  .instructions { white-space: pre-wrap; border: 1px solid #999; padding: 1em; }
+  @media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>Paper backup of a GPG secret key</h1>
+<table>
+  <tr><td>Fingerprint</td><td><code>{{.Key.FingerprintHex}}</code></td></tr>
+  <tr><td>Created</td><td>{{.Key.Created.Format "2006-01-02"}}</td></tr>
+  {{range .Key.UserIDs}}<tr><td>User ID</td><td>{{.}}</td></tr>
+  {{end}}
+</table>
+<p class="instructions">{{.Instructions}}</p>
+<pre>{{.Text}}</pre>
+</body>
+</html>
+`))
+
+// WriteHTML writes the paper backup as a self-contained HTML sheet to print
+func (paperBackup PaperBackup) WriteHTML(w io.Writer) error {
+	return sheetTemplate.Execute(w, struct {
+		PaperBackup
+		Instructions string
+	}{paperBackup, restoreInstructions})
+}
+
+// Restore combines the text of a paper backup with the public key into a secret key that can be imported with 'gpg --import'.
+// The restored key is written ASCII armored to w.
+func Restore(paperText string, publicKeyData []byte, w io.Writer) (openpgp.KeyInfo, error) {
+	encodedSecrets, err := openpgp.DecodePaperText(paperText)
+	if err != nil {
+		return openpgp.KeyInfo{}, fmt.Errorf("invalid paper backup: %w", err)
+	}
+	return RestoreSecrets(encodedSecrets, publicKeyData, w)
+}
+
+// RestoreSecrets is Restore for secrets that have already been decoded from the paper text (e.g. from QR codes)
+func RestoreSecrets(encodedSecrets []byte, publicKeyData []byte, w io.Writer) (openpgp.KeyInfo, error) {
+	secrets, err := openpgp.DecodeSecrets(encodedSecrets)
+	if err != nil {
+		return openpgp.KeyInfo{}, fmt.Errorf("invalid paper backup: %w", err)
+	}
+	publicKey, err := openpgp.ReadKeyData(publicKeyData)
+	if err != nil {
+		return openpgp.KeyInfo{}, fmt.Errorf("invalid public key: %w", err)
+	}
+	info, err := openpgp.ReadKeyInfo(publicKey)
+	if err != nil {
+		return info, fmt.Errorf("invalid public key: %w", err)
+	}
+	secretKey, err := openpgp.RestoreSecretKey(publicKey, secrets)
+	if err != nil {
+		return info, err
+	}
+	return info, openpgp.Armor(w, "PGP PRIVATE KEY BLOCK", secretKey)
+}
@@ -0,0 +1,167 @@
+package qrbackup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	openpgp "perfect-gpg-keypair/internal/openpgp"
+)
+
+// chunkMagic starts the text of every QR code, to be able to change the format later on
+const chunkMagic = "PGKQR1"
+
+// chunkDataSize is the number of payload octets per QR code. Larger codes hold more, but are harder to scan.
+const chunkDataSize = 600
+
+// maxChunks limits the number of chunks of a payload. Even an armored rsa4096 key with three subkeys needs
+// less than a hundred codes, so a much larger total can only come from a damaged or forged code.
+const maxChunks = 1000
+
+// validName keeps the names of payloads usable as file names
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// Chunk is the part of a payload held by a single QR code. Its text is a single line:
+//
+//	PGKQR1 <name> <index>/<total> <SHA-256 of the payload> <CRC24 of the data> <base64 data>
+type Chunk struct {
+	Name   string
+	Index  int
+	Total  int
+	SHA256 string
+	Data   []byte
+}
+
+func (chunk Chunk) String() string {
+	return fmt.Sprintf("%s %s %d/%d %s %06X %s",
+		chunkMagic, chunk.Name, chunk.Index, chunk.Total, chunk.SHA256, openpgp.CRC24(chunk.Data),
+		base64.StdEncoding.EncodeToString(chunk.Data),
+	)
+}
+
+// Split splits the payload into numbered chunks, each small enough for a single QR code
+func Split(name string, payload []byte) []Chunk {
+	sum := sha256.Sum256(payload)
+	total := (len(payload) + chunkDataSize - 1) / chunkDataSize
+	chunks := make([]Chunk, 0, total)
+	for index := 1; index <= total; index++ {
+		offset := (index - 1) * chunkDataSize
+		chunks = append(chunks, Chunk{
+			Name:   name,
+			Index:  index,
+			Total:  total,
+			SHA256: hex.EncodeToString(sum[:]),
+			Data:   payload[offset:min(offset+chunkDataSize, len(payload))],
+		})
+	}
+	return chunks
+}
+
+// ParseChunk parses the text of a single QR code and checks the CRC24 of its data
+func ParseChunk(text string) (Chunk, error) {
+	fields := strings.Fields(text)
+	if len(fields) != 6 || fields[0] != chunkMagic {
+		return Chunk{}, fmt.Errorf("not a QR backup chunk")
+	}
+	var chunk Chunk
+	chunk.Name = fields[1]
+	if !validName.MatchString(chunk.Name) {
+		return chunk, fmt.Errorf("invalid name '%s'", chunk.Name)
+	}
+	index, total, found := strings.Cut(fields[2], "/")
+	var indexErr, totalErr error
+	chunk.Index, indexErr = strconv.Atoi(index)
+	chunk.Total, totalErr = strconv.Atoi(total)
+	if !found || indexErr != nil || totalErr != nil || chunk.Index < 1 || chunk.Index > chunk.Total {
+		return chunk, fmt.Errorf("invalid chunk number '%s'", fields[2])
+	}
+	if chunk.Total > maxChunks {
+		return chunk, fmt.Errorf("invalid chunk number '%s', a backup has at most %d chunks", fields[2], maxChunks)
+	}
+	if _, err := hex.DecodeString(fields[3]); err != nil || len(fields[3]) != 2*sha256.Size {
+		return chunk, fmt.Errorf("%s %s: invalid checksum", chunk.Name, fields[2])
+	}
+	chunk.SHA256 = strings.ToLower(fields[3])
+	data, err := base64.StdEncoding.DecodeString(fields[5])
+	if err != nil {
+		return chunk, fmt.Errorf("%s %s: invalid data", chunk.Name, fields[2])
+	}
+	if fmt.Sprintf("%06X", openpgp.CRC24(data)) != strings.ToUpper(fields[4]) {
+		return chunk, fmt.Errorf("%s %s: checksum does not match", chunk.Name, fields[2])
+	}
+	chunk.Data = data
+	return chunk, nil
+}
+
+// ParseChunks parses the decoded text of any number of QR codes, one per line.
+// Empty lines and a 'QR-Code:' prefix (as printed by zbarimg) are ignored.
+func ParseChunks(text string) ([]Chunk, error) {
+	chunks := []Chunk{}
+	for number, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "QR-Code:"))
+		if line == "" {
+			continue
+		}
+		chunk, err := ParseChunk(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", number+1, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+
+// Assemble reassembles the payloads of the chunks by name. All chunks of a payload must be present
+// (duplicates are fine, e.g. when a code is scanned twice) and the SHA-256 of the payload must match.
+func Assemble(chunks []Chunk) (map[string][]byte, error) {
+	byName := map[string]map[int]Chunk{}
+	for _, chunk := range chunks {
+		if byName[chunk.Name] == nil {
+			byName[chunk.Name] = map[int]Chunk{}
+		}
+		if other, ok := byName[chunk.Name][chunk.Index]; ok && !bytes.Equal(other.Data, chunk.Data) {
+			return nil, fmt.Errorf("%s %d/%d: found twice with different data", chunk.Name, chunk.Index, chunk.Total)
+		}
+		byName[chunk.Name][chunk.Index] = chunk
+	}
+
+	payloads := map[string][]byte{}
+	for name, indexed := range byName {
+		indices := make([]int, 0, len(indexed))
+		for index := range indexed {
+			indices = append(indices, index)
+		}
+		sort.Ints(indices)
+		first := indexed[indices[0]]
+		for _, index := range indices {
+			if chunk := indexed[index]; chunk.Total != first.Total || chunk.SHA256 != first.SHA256 {
+				return nil, fmt.Errorf("%s %d/%d: belongs to a different backup", name, chunk.Index, chunk.Total)
+			}
+		}
+		var payload []byte
+		missing := []string{}
+		for index := 1; index <= first.Total; index++ {
+			chunk, ok := indexed[index]
+			if !ok {
+				missing = append(missing, strconv.Itoa(index))
+				continue
+			}
+			payload = append(payload, chunk.Data...)
+		}
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("%s: missing chunk(s) %s of %d", name, strings.Join(missing, ", "), first.Total)
+		}
+		sum := sha256.Sum256(payload)
+		if hex.EncodeToString(sum[:]) != first.SHA256 {
+			return nil, fmt.Errorf("%s: checksum of the reassembled data does not match", name)
+		}
+		payloads[name] = payload
+	}
+	return payloads, nil
+}
@@ -0,0 +1,170 @@
+package qrbackup
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testPayload(length int) []byte {
+	payload := make([]byte, length)
+	for i := range payload {
+		payload[i] = byte(i * 13)
+	}
+	return payload
+}
+
+// chunkLines returns the texts of the chunks, one per line, as read from the scanned QR codes
+func chunkLines(chunks []Chunk) []string {
+	lines := []string{}
+	for _, chunk := range chunks {
+		lines = append(lines, chunk.String())
+	}
+	return lines
+}
+
+func TestSplitAssembleRoundTrip(t *testing.T) {
+	payloads := map[string][]byte{
+		"private-master":         testPayload(2*chunkDataSize + 17),
+		"revocation-compromised": testPayload(chunkDataSize),
+		"revocation-superseded":  testPayload(1),
+	}
+	lines := []string{}
+	for name, payload := range payloads {
+		chunks := Split(name, payload)
+		if want := (len(payload) + chunkDataSize - 1) / chunkDataSize; len(chunks) != want {
+			t.Fatalf("Split() of %d octets returned %d chunks, want %d", len(payload), len(chunks), want)
+		}
+		lines = append(lines, chunkLines(chunks)...)
+	}
+	// the codes may be scanned in any order
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+
+	chunks, err := ParseChunks(strings.Join(lines, "\n"))
+	if err != nil {
+		t.Fatalf("ParseChunks() returned error: %v", err)
+	}
+	assembled, err := Assemble(chunks)
+	if err != nil {
+		t.Fatalf("Assemble() returned error: %v", err)
+	}
+	if len(assembled) != len(payloads) {
+		t.Errorf("Assemble() returned %d payloads, want %d", len(assembled), len(payloads))
+	}
+	for name, payload := range payloads {
+		if !bytes.Equal(assembled[name], payload) {
+			t.Errorf("Assemble() returned a different payload for %s", name)
+		}
+	}
+}
+
+func TestParseChunksIgnoresZbarimgPrefixAndEmptyLines(t *testing.T) {
+	payload := testPayload(chunkDataSize + 1)
+	lines := chunkLines(Split("private-master", payload))
+	text := "QR-Code:" + lines[0] + "\n\n  QR-Code: " + lines[1] + "  \n"
+
+	chunks, err := ParseChunks(text)
+	if err != nil {
+		t.Fatalf("ParseChunks() returned error: %v", err)
+	}
+	assembled, err := Assemble(chunks)
+	if err != nil {
+		t.Fatalf("Assemble() returned error: %v", err)
+	}
+	if !bytes.Equal(assembled["private-master"], payload) {
+		t.Error("Assemble() returned a different payload")
+	}
+}
+
+func TestAssembleAcceptsChunkScannedTwice(t *testing.T) {
+	payload := testPayload(2 * chunkDataSize)
+	chunks := Split("private-master", payload)
+	assembled, err := Assemble(append(chunks, chunks[1]))
+	if err != nil {
+		t.Fatalf("Assemble() returned error: %v", err)
+	}
+	if !bytes.Equal(assembled["private-master"], payload) {
+		t.Error("Assemble() returned a different payload")
+	}
+}
+
+func TestAssembleDetectsErrors(t *testing.T) {
+	chunks := Split("private-master", testPayload(3*chunkDataSize))
+	otherBackup := Split("private-master", testPayload(3*chunkDataSize+1))
+
+	differentData := chunks[1]
+	differentData.Data = testPayload(len(chunks[1].Data))
+	differentData.Data[0] ^= 0xFF
+	// a chunk with consistent CRC24 and SHA-256 fields whose data does not belong to the payload
+	tampered := []Chunk{chunks[0], differentData, chunks[2]}
+
+	tests := []struct {
+		name    string
+		chunks  []Chunk
+		wantErr string
+	}{
+		{name: "missing chunk", chunks: []Chunk{chunks[0], chunks[2]}, wantErr: "missing chunk(s) 2 of 3"},
+		{name: "duplicate with different data", chunks: []Chunk{chunks[0], chunks[1], differentData, chunks[2]}, wantErr: "found twice with different data"},
+		{name: "different backup", chunks: []Chunk{chunks[0], chunks[1], otherBackup[2]}, wantErr: "belongs to a different backup"},
+		{name: "tampered data", chunks: tampered, wantErr: "checksum of the reassembled data does not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Assemble(tt.chunks)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Assemble() returned %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseChunkDetectsErrors(t *testing.T) {
+	line := Split("private-master", testPayload(100))[0].String()
+	fields := strings.Fields(line)
+	replaceField := func(index int, value string) string {
+		changed := append([]string{}, fields...)
+		changed[index] = value
+		return strings.Join(changed, " ")
+	}
+	corruptedData := []byte(fields[5])
+	if corruptedData[0] == 'A' {
+		corruptedData[0] = 'B'
+	} else {
+		corruptedData[0] = 'A'
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{name: "crc mismatch", text: replaceField(5, string(corruptedData)), wantErr: "checksum does not match"},
+		{name: "wrong crc", text: replaceField(4, "000000"), wantErr: "checksum does not match"},
+		{name: "other magic", text: replaceField(0, "PGKQR2"), wantErr: "not a QR backup chunk"},
+		{name: "missing field", text: strings.Join(fields[:5], " "), wantErr: "not a QR backup chunk"},
+		{name: "invalid name", text: replaceField(1, "../etc"), wantErr: "invalid name"},
+		{name: "index beyond total", text: replaceField(2, "2/1"), wantErr: "invalid chunk number"},
+		{name: "index zero", text: replaceField(2, "0/1"), wantErr: "invalid chunk number"},
+		{name: "total beyond maximum", text: replaceField(2, "1/999999999"), wantErr: "at most 1000 chunks"},
+		{name: "invalid sha256", text: replaceField(3, "abc"), wantErr: "invalid checksum"},
+		{name: "invalid base64", text: replaceField(5, "!!!"), wantErr: "invalid data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseChunk(tt.text)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseChunk() returned %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseChunksReportsLineNumber(t *testing.T) {
+	lines := chunkLines(Split("private-master", testPayload(chunkDataSize+1)))
+	_, err := ParseChunks(lines[0] + "\n\nQR-Code:garbage\n")
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("ParseChunks() returned %v, want an error for line 3", err)
+	}
+}
@@ -0,0 +1,177 @@
+package qrbackup
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+
+	openpgp "perfect-gpg-keypair/internal/openpgp"
+)
+
+// Content is what the QR codes of the master secret hold
+type Content string
+
+const (
+	// NoQRBackup disables the QR backup
+	NoQRBackup Content = ""
+	// Armored is the ASCII armored export of the master secret key, which can be imported as is
+	Armored Content = "armored"
+	// Paperkey is only the secret parts of the keys (see internal/openpgp), which need the public key to be restored
+	Paperkey Content = "paperkey"
+)
+
+var Contents = []Content{Armored, Paperkey}
+
+// Format is the image format of the QR codes
+type Format string
+
+const (
+	PNG Format = "png"
+	SVG Format = "svg"
+)
+
+var Formats = []Format{PNG, SVG}
+
+// DefaultFormat is used if no format is set
+const DefaultFormat = PNG
+
+// Payload names of the master secret, the revocation certificates are named after their file
+const (
+	PrivateMasterKeyName = "private-master"
+	PaperkeyName         = "paperkey"
+)
+
+// pngSize is the width and height of PNG images in pixels
+const pngSize = 768
+
+// svgModuleSize is the width and height of a single QR module in SVG images
+const svgModuleSize = 8
+
+type Options struct {
+	Content Content
+	Format  Format
+}
+
+// ParseOptions validates the content and format of a QR backup, an empty format defaults to DefaultFormat
+func ParseOptions(content string, format string) (Options, error) {
+	options := Options{Content: Content(content), Format: Format(format)}
+	if options.Format == "" {
+		options.Format = DefaultFormat
+	}
+	if options.Content != NoQRBackup && !slices.Contains(Contents, options.Content) {
+		return options, fmt.Errorf("invalid QR backup '%s', must be one of %s", content, joinValues(Contents))
+	}
+	if !slices.Contains(Formats, options.Format) {
+		return options, fmt.Errorf("invalid QR image format '%s', must be one of %s", format, joinValues(Formats))
+	}
+	return options, nil
+}
+
+func (options Options) Enabled() bool {
+	return options.Content != NoQRBackup
+}
+
+func joinValues[T ~string](values []T) string {
+	names := make([]string, len(values))
+	for i, value := range values {
+		names[i] = string(value)
+	}
+	return strings.Join(names, ", ")
+}
+
+// PayloadName names the payload of a file after its base name, e.g. '.revocation-certification.asc' is 'revocation-certification'
+func PayloadName(filePath string) string {
+	name := strings.TrimPrefix(filepath.Base(filePath), ".")
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// Create writes the QR codes of the master secret (as set by options) and of the revocation certificates to dir
+// and returns the paths of the images
+func Create(options Options, privateKeyFilePath string, revocationCertFilePaths []string, dir string) ([]string, error) {
+	privateKeyData, err := os.ReadFile(privateKeyFilePath)
+	if err != nil {
+		return nil, err
+	}
+	payloads := map[string][]byte{}
+	switch options.Content {
+	case Armored:
+		payloads[PrivateMasterKeyName] = privateKeyData
+	case Paperkey:
+		data, err := openpgp.ReadKeyData(privateKeyData)
+		if err != nil {
+			return nil, err
+		}
+		secrets, err := openpgp.ExtractSecrets(data)
+		if err != nil {
+			return nil, fmt.Errorf("could not extract secret key: %w", err)
+		}
+		payloads[PaperkeyName] = openpgp.EncodeSecrets(secrets)
+	}
+	for _, path := range revocationCertFilePaths {
+		certificate, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		payloads[PayloadName(path)] = certificate
+	}
+
+	paths := []string{}
+	for name, payload := range payloads {
+		chunks := Split(name, payload)
+		if len(chunks) > maxChunks {
+			return nil, fmt.Errorf("%s is too large for a QR backup (%d octets)", name, len(payload))
+		}
+		for _, chunk := range chunks {
+			path := filepath.Join(dir, fmt.Sprintf(".qr-%s-%02d-of-%02d.%s", chunk.Name, chunk.Index, chunk.Total, options.Format))
+			if err := writeImage(chunk.String(), options.Format, path); err != nil {
+				return nil, fmt.Errorf("could not write QR code %s %d/%d: %w", chunk.Name, chunk.Index, chunk.Total, err)
+			}
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+func writeImage(text string, format Format, path string) error {
+	code, err := qrcode.New(text, qrcode.Medium)
+	if err != nil {
+		return err
+	}
+	var image []byte
+	if format == SVG {
+		image = svgImage(code.Bitmap())
+	} else if image, err = code.PNG(pngSize); err != nil {
+		return err
+	}
+	return os.WriteFile(path, image, 0600)
+}
+
+// svgImage draws the dark modules of the bitmap (including the quiet zone) as rectangles
+func svgImage(bitmap [][]bool) []byte {
+	size := len(bitmap) * svgModuleSize
+	var out bytes.Buffer
+	fmt.Fprintf(&out, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n", size, size, size, size)
+	fmt.Fprintf(&out, `<rect width="%d" height="%d" fill="#ffffff"/>`+"\n", size, size)
+	out.WriteString(`<path fill="#000000" d="`)
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			// a run of dark modules is drawn as a single rectangle
+			width := 1
+			for x+width < len(row) && row[x+width] {
+				width++
+			}
+			fmt.Fprintf(&out, "M%d %dh%dv%dh-%dz", x*svgModuleSize, y*svgModuleSize, width*svgModuleSize, svgModuleSize, width*svgModuleSize)
+			x += width - 1
+		}
+	}
+	out.WriteString("\"/>\n</svg>\n")
+	return out.Bytes()
+}
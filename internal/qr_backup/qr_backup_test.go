@@ -0,0 +1,124 @@
+package qrbackup
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		content string
+		format  string
+		want    Options
+		wantErr string
+	}{
+		{content: "", format: "", want: Options{Content: NoQRBackup, Format: DefaultFormat}},
+		{content: "armored", format: "", want: Options{Content: Armored, Format: PNG}},
+		{content: "paperkey", format: "svg", want: Options{Content: Paperkey, Format: SVG}},
+		{content: "binary", format: "png", wantErr: "invalid QR backup 'binary', must be one of armored, paperkey"},
+		{content: "armored", format: "jpg", wantErr: "invalid QR image format 'jpg', must be one of png, svg"},
+	}
+	for _, tt := range tests {
+		options, err := ParseOptions(tt.content, tt.format)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("ParseOptions(%q, %q) returned %v, want %q", tt.content, tt.format, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || options != tt.want {
+			t.Errorf("ParseOptions(%q, %q) = %v, %v, want %v", tt.content, tt.format, options, err, tt.want)
+		}
+		if options.Enabled() != (tt.content != "") {
+			t.Errorf("ParseOptions(%q, %q).Enabled() = %v", tt.content, tt.format, options.Enabled())
+		}
+	}
+}
+
+func TestPayloadName(t *testing.T) {
+	tests := map[string]string{
+		"/tmp/keys/.revocation-certification.asc":        "revocation-certification",
+		"/tmp/keys/.revocation-certification-0-none.asc": "revocation-certification-0-none",
+		"private-master.gpg":                             "private-master",
+	}
+	for path, want := range tests {
+		if got := PayloadName(path); got != want {
+			t.Errorf("PayloadName(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	privateKeyFilePath := filepath.Join("..", "openpgp", "testdata", "secret-key.asc")
+	revocationCertFilePath := filepath.Join(t.TempDir(), ".revocation-certification.asc")
+	if err := os.WriteFile(revocationCertFilePath, testPayload(700), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		options    Options
+		wantPrefix []byte
+		// wantPrivateMaster is the name of the payload of the master secret
+		wantPrivateMaster string
+	}{
+		{options: Options{Content: Armored, Format: PNG}, wantPrefix: []byte("\x89PNG"), wantPrivateMaster: PrivateMasterKeyName},
+		{options: Options{Content: Paperkey, Format: SVG}, wantPrefix: []byte("<svg "), wantPrivateMaster: PaperkeyName},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.options.Content), func(t *testing.T) {
+			dir := t.TempDir()
+			paths, err := Create(tt.options, privateKeyFilePath, []string{revocationCertFilePath}, dir)
+			if err != nil {
+				t.Fatalf("Create() returned error: %v", err)
+			}
+			names := []string{}
+			for _, path := range paths {
+				names = append(names, filepath.Base(path))
+				image, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.HasPrefix(image, tt.wantPrefix) {
+					t.Errorf("%s is not a %s image", filepath.Base(path), tt.options.Format)
+				}
+				if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+					t.Errorf("%s has permissions %v, want 600", filepath.Base(path), info.Mode().Perm())
+				}
+			}
+			// the certificate of 700 octets needs two QR codes
+			wantRevocation := []string{
+				".qr-revocation-certification-01-of-02." + string(tt.options.Format),
+				".qr-revocation-certification-02-of-02." + string(tt.options.Format),
+			}
+			for _, name := range wantRevocation {
+				if !slices.Contains(names, name) {
+					t.Errorf("Create() did not write %s, wrote %v", name, names)
+				}
+			}
+			if !slices.ContainsFunc(names, func(name string) bool { return strings.HasPrefix(name, ".qr-"+tt.wantPrivateMaster+"-01-of-") }) {
+				t.Errorf("Create() did not write the QR codes of the master secret, wrote %v", names)
+			}
+		})
+	}
+}
+
+func TestSVGImage(t *testing.T) {
+	bitmap := [][]bool{
+		{true, true, false},
+		{false, true, true},
+		{true, false, true},
+	}
+	svg := string(svgImage(bitmap))
+	if !strings.Contains(svg, `width="24" height="24" viewBox="0 0 24 24"`) {
+		t.Errorf("svgImage() has the wrong size:\n%s", svg)
+	}
+	// each run of dark modules in a row is a single rectangle
+	wantPath := `d="M0 0h16v8h-16zM8 8h16v8h-16zM0 16h8v8h-8zM16 16h8v8h-8z"`
+	if !strings.Contains(svg, wantPath) {
+		t.Errorf("svgImage() does not contain %s:\n%s", wantPath, svg)
+	}
+}
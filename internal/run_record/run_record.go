@@ -0,0 +1,145 @@
+package runrecord
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// recordVersion is written to every record, to be able to change the format later on
+const recordVersion = 1
+
+// Stage is how far a run of generate got, it is only advanced after the step completed
+type Stage string
+
+const (
+	// Started means no key has been generated yet
+	Started Stage = "started"
+	// MasterGenerated means the master key exists (with its secret part) in the keyring of the run
+	MasterGenerated Stage = "master-generated"
+	// BackedUp means the exported keys have been backed up and the backup was verified or confirmed
+	BackedUp Stage = "backed-up"
+	// MasterRemoved means the secret master key is being removed and the subkeys are reimported
+	MasterRemoved Stage = "master-removed"
+)
+
+// Record is the progress of a run of generate. It is kept outside of the temporary directory, so that it survives
+// the run being killed and the next run can detect what was left behind.
+type Record struct {
+	Version int       `yaml:"version"`
+	PID     int       `yaml:"pid"`
+	Started time.Time `yaml:"started"`
+	TmpDir  string    `yaml:"tmp_dir"`
+	// GnupgHome is the throwaway keyring inside TmpDir of isolated runs, empty if the keys are generated in the default keyring
+	GnupgHome   string `yaml:"gnupg_home,omitempty"`
+	Fingerprint string `yaml:"fingerprint,omitempty"`
+	OutputDir   string `yaml:"output_dir,omitempty"`
+	Stage       Stage  `yaml:"stage"`
+}
+
+func New(tmpDir string, gnupgHome string) Record {
+	return Record{
+		Version:   recordVersion,
+		PID:       os.Getpid(),
+		Started:   time.Now().Truncate(time.Second),
+		TmpDir:    tmpDir,
+		GnupgHome: gnupgHome,
+		Stage:     Started,
+	}
+}
+
+// Path returns the location of the record: $XDG_STATE_HOME/perfect-gpg-keypair/generate-run.yaml
+func Path() (string, error) {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateHome, "perfect-gpg-keypair", "generate-run.yaml"), nil
+}
+
+// Load reads the record left by a previous run, if any
+func Load() (Record, bool, error) {
+	var record Record
+	path, err := Path()
+	if err != nil {
+		return record, false, err
+	}
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return record, false, nil
+	}
+	if err != nil {
+		return record, false, err
+	}
+	if err := yaml.Unmarshal(contents, &record); err != nil {
+		return record, false, fmt.Errorf("could not parse run record '%s': %w", path, err)
+	}
+	if record.Version != recordVersion {
+		return record, false, fmt.Errorf("run record '%s' has unsupported version %d", path, record.Version)
+	}
+	return record, true, nil
+}
+
+// Save writes the record, replacing the previous one atomically
+func (record Record) Save() error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	contents, err := yaml.Marshal(record)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, contents, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Remove deletes the record, after the run completed or what it left behind was dealt with
+func Remove() error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// IsRunning reports whether the process of the run is still alive, i.e. the run was not aborted but is in progress
+func (record Record) IsRunning() bool {
+	if record.PID <= 0 || record.PID == os.Getpid() {
+		return false
+	}
+	process, err := os.FindProcess(record.PID)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// Isolated reports whether the run generated the keys in a throwaway keyring, which is gone along with TmpDir
+func (record Record) Isolated() bool {
+	return record.GnupgHome != ""
+}
+
+// NeedsRecovery reports whether the run may have left the master key behind in the default keyring
+func (record Record) NeedsRecovery() bool {
+	return !record.Isolated() && record.Fingerprint != "" && record.Stage != Started
+}
@@ -0,0 +1,141 @@
+package runrecord
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveLoadRemove(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	if _, found, err := Load(); found || err != nil {
+		t.Fatalf("Load() without a record returned %v, %v", found, err)
+	}
+
+	record := New("/tmp/perfect-gpg-keypair-123", "/tmp/perfect-gpg-keypair-123/gnupg")
+	record.Fingerprint = "0123456789ABCDEF0123456789ABCDEF01234567"
+	record.OutputDir = "/mnt/backup"
+	record.Stage = BackedUp
+	if err := record.Save(); err != nil {
+		t.Fatalf("Save() returned error: %v", err)
+	}
+	path, err := Path()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("the record has permissions %o, want 600", info.Mode().Perm())
+	}
+	loaded, found, err := Load()
+	if err != nil || !found {
+		t.Fatalf("Load() returned %v, %v", found, err)
+	}
+	if !loaded.Started.Equal(record.Started) {
+		t.Errorf("Load() returned the start %s, want %s", loaded.Started, record.Started)
+	}
+	loaded.Started = record.Started
+	if loaded != record {
+		t.Errorf("Load() = %+v, want %+v", loaded, record)
+	}
+
+	if err := Remove(); err != nil {
+		t.Fatalf("Remove() returned error: %v", err)
+	}
+	if _, found, err := Load(); found || err != nil {
+		t.Errorf("Load() after Remove() returned %v, %v", found, err)
+	}
+	if err := Remove(); err != nil {
+		t.Errorf("Remove() without a record returned error: %v", err)
+	}
+}
+
+func TestLoadRejectsInvalidRecords(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		wantErr  string
+	}{
+		{name: "not yaml", contents: "version: [1\n", wantErr: "could not parse run record"},
+		{name: "unsupported version", contents: "version: 2\npid: 123\nstage: started\n", wantErr: "unsupported version 2"},
+		{name: "no version", contents: "pid: 123\nstage: started\n", wantErr: "unsupported version 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_STATE_HOME", t.TempDir())
+			path, err := Path()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(tt.contents), 0600); err != nil {
+				t.Fatal(err)
+			}
+			_, found, err := Load()
+			if found || err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() returned %v, %v, want an error containing %q", found, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsRunning(t *testing.T) {
+	running := exec.Command("sleep", "60")
+	if err := running.Start(); err != nil {
+		t.Skipf("could not start a process: %v", err)
+	}
+	t.Cleanup(func() {
+		running.Process.Kill()
+		running.Wait()
+	})
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Skipf("could not run a process: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		pid  int
+		want bool
+	}{
+		{name: "running process", pid: running.Process.Pid, want: true},
+		{name: "exited process", pid: exited.Process.Pid, want: false},
+		{name: "this process", pid: os.Getpid(), want: false},
+		{name: "no process", pid: 0, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Record{PID: tt.pid}).IsRunning(); got != tt.want {
+				t.Errorf("IsRunning() of pid %d = %v, want %v", tt.pid, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNeedsRecovery(t *testing.T) {
+	const fingerprint = "0123456789ABCDEF0123456789ABCDEF01234567"
+	tests := []struct {
+		name   string
+		record Record
+		want   bool
+	}{
+		{name: "no key generated yet", record: Record{Stage: Started}, want: false},
+		{name: "master key generated", record: Record{Fingerprint: fingerprint, Stage: MasterGenerated}, want: true},
+		{name: "master key being removed", record: Record{Fingerprint: fingerprint, Stage: MasterRemoved}, want: true},
+		{name: "isolated run", record: Record{GnupgHome: "/tmp/run/gnupg", Fingerprint: fingerprint, Stage: BackedUp}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.record.NeedsRecovery(); got != tt.want {
+				t.Errorf("NeedsRecovery() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package shamir
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// MaxShares is the number of distinct non-zero x coordinates in GF(256)
+const MaxShares = 255
+
+// exp and log are the tables of powers of the generator 3 in GF(256) with the AES polynomial x^8 + x^4 + x^3 + x + 1
+var exp, log = func() ([510]byte, [256]byte) {
+	var exp [510]byte
+	var log [256]byte
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i] = x
+		exp[i+255] = x
+		log[x] = byte(i)
+		// multiply by 3, i.e. x*2 + x
+		doubled := x << 1
+		if x&0x80 != 0 {
+			doubled ^= 0x1b
+		}
+		x ^= doubled
+	}
+	return exp, log
+}()
+
+func mul(a byte, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return exp[int(log[a])+int(log[b])]
+}
+
+func div(a byte, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return exp[int(log[a])+255-int(log[b])]
+}
+
+// Share is a point of the polynomials of all secret octets at x = Index
+type Share struct {
+	Index byte
+	Data  []byte
+}
+
+// Split splits the secret into n shares, of which any threshold recover it
+func Split(secret []byte, n int, threshold int) ([]Share, error) {
+	if threshold < 2 || threshold > n || n > MaxShares {
+		return nil, fmt.Errorf("invalid number of shares %d with threshold %d: need 2 <= threshold <= shares <= %d", n, threshold, MaxShares)
+	}
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i] = Share{Index: byte(i + 1), Data: make([]byte, len(secret))}
+	}
+	coefficients := make([]byte, threshold)
+	for position, octet := range secret {
+		// random polynomial of degree threshold-1 with the secret octet as constant term
+		coefficients[0] = octet
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+		for i := range shares {
+			// Horner's method
+			x := shares[i].Index
+			y := byte(0)
+			for c := threshold - 1; c >= 0; c-- {
+				y = mul(y, x) ^ coefficients[c]
+			}
+			shares[i].Data[position] = y
+		}
+	}
+	clear(coefficients)
+	return shares, nil
+}
+
+// Combine recovers the secret from at least threshold shares by Lagrange interpolation at x = 0.
+// Fewer shares silently give a wrong result, which has to be detected by the caller.
+func Combine(shares []Share) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, fmt.Errorf("at least 2 shares are needed")
+	}
+	length := len(shares[0].Data)
+	seen := map[byte]bool{}
+	for _, share := range shares {
+		if share.Index == 0 || seen[share.Index] {
+			return nil, fmt.Errorf("invalid or duplicate share index %d", share.Index)
+		}
+		if len(share.Data) != length {
+			return nil, fmt.Errorf("shares have different lengths")
+		}
+		seen[share.Index] = true
+	}
+
+	secret := make([]byte, length)
+	for i, share := range shares {
+		// Lagrange basis polynomial of share i at x = 0, subtraction is xor in GF(256)
+		basis := byte(1)
+		for j, other := range shares {
+			if i != j {
+				basis = mul(basis, div(other.Index, other.Index^share.Index))
+			}
+		}
+		for position, y := range share.Data {
+			secret[position] ^= mul(basis, y)
+		}
+	}
+	return secret, nil
+}
@@ -0,0 +1,121 @@
+package shamir
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func testSecret(t *testing.T, length int) []byte {
+	t.Helper()
+	secret := make([]byte, length)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+// subsets returns all subsets of size k of the shares, in order
+func subsets(shares []Share, k int) [][]Share {
+	if k == 0 {
+		return [][]Share{{}}
+	}
+	if len(shares) < k {
+		return nil
+	}
+	result := [][]Share{}
+	for _, rest := range subsets(shares[1:], k-1) {
+		result = append(result, append([]Share{shares[0]}, rest...))
+	}
+	return append(result, subsets(shares[1:], k)...)
+}
+
+func TestSplitCombine(t *testing.T) {
+	tests := []struct {
+		shares    int
+		threshold int
+	}{
+		{shares: 2, threshold: 2},
+		{shares: 3, threshold: 2},
+		{shares: 5, threshold: 3},
+		{shares: 5, threshold: 5},
+		{shares: 7, threshold: 4},
+	}
+	for _, tt := range tests {
+		secret := testSecret(t, 48)
+		shares, err := Split(secret, tt.shares, tt.threshold)
+		if err != nil {
+			t.Fatalf("Split(%d, %d) returned error: %v", tt.shares, tt.threshold, err)
+		}
+		if len(shares) != tt.shares {
+			t.Fatalf("Split(%d, %d) returned %d shares", tt.shares, tt.threshold, len(shares))
+		}
+		for k := tt.threshold; k <= tt.shares; k++ {
+			for _, subset := range subsets(shares, k) {
+				combined, err := Combine(subset)
+				if err != nil {
+					t.Fatalf("%d-of-%d: Combine() of %d shares returned error: %v", tt.threshold, tt.shares, k, err)
+				}
+				if !bytes.Equal(combined, secret) {
+					t.Errorf("%d-of-%d: Combine() of shares %v did not recover the secret", tt.threshold, tt.shares, indices(subset))
+				}
+			}
+		}
+	}
+}
+
+func TestCombineFewerSharesThanThreshold(t *testing.T) {
+	secret := testSecret(t, 48)
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, subset := range subsets(shares, 2) {
+		combined, err := Combine(subset)
+		if err != nil {
+			t.Fatalf("Combine() returned error: %v", err)
+		}
+		if bytes.Equal(combined, secret) {
+			t.Errorf("Combine() of shares %v recovered the secret below the threshold", indices(subset))
+		}
+	}
+}
+
+func TestCombineRejectsInvalidShares(t *testing.T) {
+	shares, err := Split(testSecret(t, 16), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		shares []Share
+	}{
+		{name: "single share", shares: shares[:1]},
+		{name: "duplicate index", shares: []Share{shares[0], shares[1], {Index: shares[0].Index, Data: shares[2].Data}}},
+		{name: "zero index", shares: []Share{shares[0], {Index: 0, Data: shares[1].Data}}},
+		{name: "different lengths", shares: []Share{shares[0], {Index: shares[1].Index, Data: shares[1].Data[:8]}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Combine(tt.shares); err == nil {
+				t.Error("Combine() returned no error")
+			}
+		})
+	}
+}
+
+func TestSplitRejectsInvalidThreshold(t *testing.T) {
+	for _, tt := range []struct{ shares, threshold int }{{3, 1}, {3, 4}, {256, 2}} {
+		if _, err := Split([]byte("secret"), tt.shares, tt.threshold); err == nil {
+			t.Errorf("Split() with %d shares and threshold %d returned no error", tt.shares, tt.threshold)
+		}
+	}
+}
+
+func indices(shares []Share) []byte {
+	result := []byte{}
+	for _, share := range shares {
+		result = append(result, share.Index)
+	}
+	return result
+}
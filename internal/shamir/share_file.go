@@ -0,0 +1,211 @@
+package shamir
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// shareFileVersion is written to every share file, to be able to change the format later on
+const shareFileVersion = 1
+
+// Secret is what is split into shares
+type Secret string
+
+const (
+	// PrivateMaster is the ASCII armored export of the master secret key
+	PrivateMaster Secret = "private-master"
+	// Passphrase is the passphrase of the master key, e.g. to split it while the key is kept in a single vault
+	Passphrase Secret = "passphrase"
+)
+
+var Secrets = []Secret{PrivateMaster, Passphrase}
+
+// DefaultSecret is split if no secret is set
+const DefaultSecret = PrivateMaster
+
+type Options struct {
+	Shares    int
+	Threshold int
+	Secret    Secret
+}
+
+// ParseOptions validates the options of splitting a secret. No shares disable splitting.
+func ParseOptions(shares int, threshold int, secret string) (Options, error) {
+	options := Options{Shares: shares, Threshold: threshold, Secret: Secret(secret)}
+	if options.Secret == "" {
+		options.Secret = DefaultSecret
+	}
+	if shares == 0 && threshold == 0 {
+		return options, nil
+	}
+	if threshold < 2 || threshold > shares || shares > MaxShares {
+		return options, fmt.Errorf("invalid number of shares %d with threshold %d: need 2 <= threshold <= shares <= %d", shares, threshold, MaxShares)
+	}
+	if !slices.Contains(Secrets, options.Secret) {
+		names := make([]string, len(Secrets))
+		for i, secret := range Secrets {
+			names[i] = string(secret)
+		}
+		return options, fmt.Errorf("invalid secret to split '%s', must be one of %s", secret, strings.Join(names, ", "))
+	}
+	return options, nil
+}
+
+func (options Options) Enabled() bool {
+	return options.Shares > 0
+}
+
+// ShareFile is a single share along with what is needed to recombine it with the other shares
+type ShareFile struct {
+	Version     int    `yaml:"version"`
+	Fingerprint string `yaml:"fingerprint"`
+	Secret      Secret `yaml:"secret"`
+	Index       int    `yaml:"index"`
+	Threshold   int    `yaml:"threshold"`
+	Shares      int    `yaml:"shares"`
+	// ID is random and the same for all shares of a split, to tell the shares of different splits apart
+	ID string `yaml:"id"`
+	// Data is the share of the secret followed by its SHA-256, so that the checksum does not give away anything about
+	// the secret (e.g. a weak passphrase) and wrong or too few shares are detected when recombining
+	Data string `yaml:"data"`
+}
+
+// FileName returns the name of the share file, e.g. '.share-private-master-2-of-5.yaml'
+func (shareFile ShareFile) FileName() string {
+	return fmt.Sprintf(".share-%s-%d-of-%d.yaml", shareFile.Secret, shareFile.Index, shareFile.Shares)
+}
+
+// DirName returns the name of the directory the share file is written to, e.g. 'share-2-of-5',
+// so that each share can be handed out on its own
+func (shareFile ShareFile) DirName() string {
+	return fmt.Sprintf("share-%d-of-%d", shareFile.Index, shareFile.Shares)
+}
+
+// CreateShareFiles splits the secret as set by options and writes each share to its own directory in dir.
+// It returns the paths of the share files.
+func CreateShareFiles(options Options, secret []byte, fingerprint string, dir string) ([]string, error) {
+	sum := sha256.Sum256(secret)
+	shares, err := Split(append(append([]byte{}, secret...), sum[:]...), options.Shares, options.Threshold)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, share := range shares {
+		shareFile := ShareFile{
+			Version:     shareFileVersion,
+			Fingerprint: fingerprint,
+			Secret:      options.Secret,
+			Index:       int(share.Index),
+			Threshold:   options.Threshold,
+			Shares:      options.Shares,
+			ID:          hex.EncodeToString(id),
+			Data:        base64.StdEncoding.EncodeToString(share.Data),
+		}
+		shareDir := filepath.Join(dir, shareFile.DirName())
+		if err := os.MkdirAll(shareDir, 0700); err != nil {
+			return nil, err
+		}
+		path := filepath.Join(shareDir, shareFile.FileName())
+		if err := shareFile.Write(path); err != nil {
+			return nil, fmt.Errorf("could not write share %d: %w", share.Index, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func (shareFile ShareFile) Write(path string) error {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "# Share %d of %d of the %s of %s, any %d of the shares recover it with:\n",
+		shareFile.Index, shareFile.Shares, shareFile.Secret, shareFile.Fingerprint, shareFile.Threshold,
+	)
+	out.WriteString("#   perfect-gpg-keypair recover <share file> <share file> ...\n")
+	encoder := yaml.NewEncoder(&out)
+	if err := encoder.Encode(shareFile); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, out.Bytes(), 0600)
+}
+
+func ReadShareFile(path string) (ShareFile, error) {
+	var shareFile ShareFile
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return shareFile, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&shareFile); err != nil {
+		return shareFile, fmt.Errorf("could not parse share file '%s': %w", path, err)
+	}
+	if shareFile.Version != shareFileVersion {
+		return shareFile, fmt.Errorf("share file '%s' has unsupported version %d", path, shareFile.Version)
+	}
+	return shareFile, nil
+}
+
+// Recover recombines the secret from the share files, which must all belong to the same secret
+func Recover(shareFiles []ShareFile) ([]byte, error) {
+	if len(shareFiles) == 0 {
+		return nil, fmt.Errorf("no shares given")
+	}
+	first := shareFiles[0]
+	shares := []Share{}
+	seen := map[int]string{}
+	for _, shareFile := range shareFiles {
+		if shareFile.Fingerprint != first.Fingerprint || shareFile.Secret != first.Secret ||
+			shareFile.Threshold != first.Threshold || shareFile.Shares != first.Shares || shareFile.ID != first.ID {
+			return nil, fmt.Errorf("share %d (%s of %s) does not belong to the same split as share %d (%s of %s)",
+				shareFile.Index, shareFile.Secret, shareFile.Fingerprint, first.Index, first.Secret, first.Fingerprint,
+			)
+		}
+		if shareFile.Index < 1 || shareFile.Index > shareFile.Shares {
+			return nil, fmt.Errorf("invalid share index %d", shareFile.Index)
+		}
+		if data, ok := seen[shareFile.Index]; ok {
+			if data != shareFile.Data {
+				return nil, fmt.Errorf("share %d is given twice with different data", shareFile.Index)
+			}
+			// the same share given twice does not count towards the threshold
+			continue
+		}
+		seen[shareFile.Index] = shareFile.Data
+		data, err := base64.StdEncoding.DecodeString(shareFile.Data)
+		if err != nil {
+			return nil, fmt.Errorf("share %d: invalid data", shareFile.Index)
+		}
+		shares = append(shares, Share{Index: byte(shareFile.Index), Data: data})
+	}
+	if len(shares) < first.Threshold {
+		return nil, fmt.Errorf("%d of %d shares are needed, only %d given", first.Threshold, first.Shares, len(shares))
+	}
+	combined, err := Combine(shares)
+	if err != nil {
+		return nil, err
+	}
+	if len(combined) < sha256.Size {
+		return nil, fmt.Errorf("shares are too short")
+	}
+	secret, checksum := combined[:len(combined)-sha256.Size], combined[len(combined)-sha256.Size:]
+	if sum := sha256.Sum256(secret); !bytes.Equal(sum[:], checksum) {
+		return nil, fmt.Errorf("checksum of the recovered secret does not match, at least one share is damaged")
+	}
+	return secret, nil
+}
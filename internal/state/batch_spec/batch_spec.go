@@ -0,0 +1,236 @@
+package batchspec
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	qrbackup "perfect-gpg-keypair/internal/qr_backup"
+	shamir "perfect-gpg-keypair/internal/shamir"
+	keyalgorithm "perfect-gpg-keypair/internal/state/key_algorithm"
+	utils "perfect-gpg-keypair/internal/utils"
+)
+
+// BatchSpec holds everything needed to run 'generate' without any user interaction.
+// It can be read from a YAML spec file and/or be set by flags.
+type BatchSpec struct {
+	Name           string `yaml:"name"`
+	Email          string `yaml:"email"`
+	Expiry         string `yaml:"expiry"`
+	Algorithm      string `yaml:"algorithm"`
+	OutputDir      string `yaml:"output_dir"`
+	PassphraseFile string `yaml:"passphrase_file"`
+	PassphraseEnv  string `yaml:"passphrase_env"`
+	PaperBackup    bool   `yaml:"paper_backup"`
+	// QRBackup is the content of the QR codes of the master secret (empty for none), QRFormat their image format
+	QRBackup string `yaml:"qr_backup"`
+	QRFormat string `yaml:"qr_format"`
+	// ShamirShares is the number of shares the ShamirSecret is split into (0 for none), any ShamirThreshold of them recover it
+	ShamirShares    int    `yaml:"shamir_shares"`
+	ShamirThreshold int    `yaml:"shamir_threshold"`
+	ShamirSecret    string `yaml:"shamir_secret"`
+	// ShamirDir is the directory the shares are saved to, one directory per share, apart from OutputDir
+	ShamirDir string `yaml:"shamir_dir"`
+	// Bundle additionally packs the exported keys into a single archive, encrypted with a separate bundle passphrase
+	Bundle               bool   `yaml:"bundle"`
+	BundlePassphraseFile string `yaml:"bundle_passphrase_file"`
+	BundlePassphraseEnv  string `yaml:"bundle_passphrase_env"`
+	// subkeys default to the algorithm profile and the master key expiry
+	SigningAlgorithm        string `yaml:"signing_algorithm"`
+	SigningExpiry           string `yaml:"signing_expiry"`
+	EncryptionAlgorithm     string `yaml:"encryption_algorithm"`
+	EncryptionExpiry        string `yaml:"encryption_expiry"`
+	AuthenticationSubkey    bool   `yaml:"authentication_subkey"`
+	AuthenticationAlgorithm string `yaml:"authentication_algorithm"`
+	AuthenticationExpiry    string `yaml:"authentication_expiry"`
+	// the revocation certificate defaults to reason 'compromised' without a description
+	RevocationReason      string `yaml:"revocation_reason"`
+	RevocationDescription string `yaml:"revocation_description"`
+	AllRevocationReasons  bool   `yaml:"all_revocation_reasons"`
+}
+
+func Load(path string) (BatchSpec, error) {
+	var spec BatchSpec
+	f, err := os.Open(path)
+	if err != nil {
+		return spec, err
+	}
+	defer f.Close()
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&spec); err != nil && err != io.EOF {
+		return spec, fmt.Errorf("could not parse spec file '%s': %w", path, err)
+	}
+	return spec, nil
+}
+
+// Override replaces the values of the spec with the values of other whose flag is set according to isSet,
+// e.g. '--paper-backup=false' turns off 'paper_backup: true' of the spec file. The flags are named after
+// the YAML keys, with dashes instead of underscores.
+func (spec BatchSpec) Override(other BatchSpec, isSet func(flag string) bool) BatchSpec {
+	override := func(flag string, value *string, otherValue string) {
+		if isSet(flag) {
+			*value = otherValue
+		}
+	}
+	overrideInt := func(flag string, value *int, otherValue int) {
+		if isSet(flag) {
+			*value = otherValue
+		}
+	}
+	overrideBool := func(flag string, value *bool, otherValue bool) {
+		if isSet(flag) {
+			*value = otherValue
+		}
+	}
+	override("name", &spec.Name, other.Name)
+	override("email", &spec.Email, other.Email)
+	override("expiry", &spec.Expiry, other.Expiry)
+	override("algorithm", &spec.Algorithm, other.Algorithm)
+	override("output-dir", &spec.OutputDir, other.OutputDir)
+	override("passphrase-file", &spec.PassphraseFile, other.PassphraseFile)
+	override("passphrase-env", &spec.PassphraseEnv, other.PassphraseEnv)
+	override("signing-algorithm", &spec.SigningAlgorithm, other.SigningAlgorithm)
+	override("signing-expiry", &spec.SigningExpiry, other.SigningExpiry)
+	override("encryption-algorithm", &spec.EncryptionAlgorithm, other.EncryptionAlgorithm)
+	override("encryption-expiry", &spec.EncryptionExpiry, other.EncryptionExpiry)
+	override("authentication-algorithm", &spec.AuthenticationAlgorithm, other.AuthenticationAlgorithm)
+	override("authentication-expiry", &spec.AuthenticationExpiry, other.AuthenticationExpiry)
+	override("revocation-reason", &spec.RevocationReason, other.RevocationReason)
+	override("revocation-description", &spec.RevocationDescription, other.RevocationDescription)
+	override("qr-backup", &spec.QRBackup, other.QRBackup)
+	override("qr-format", &spec.QRFormat, other.QRFormat)
+	override("shamir-secret", &spec.ShamirSecret, other.ShamirSecret)
+	override("shamir-dir", &spec.ShamirDir, other.ShamirDir)
+	override("bundle-passphrase-file", &spec.BundlePassphraseFile, other.BundlePassphraseFile)
+	override("bundle-passphrase-env", &spec.BundlePassphraseEnv, other.BundlePassphraseEnv)
+	overrideInt("shamir-shares", &spec.ShamirShares, other.ShamirShares)
+	overrideInt("shamir-threshold", &spec.ShamirThreshold, other.ShamirThreshold)
+	overrideBool("authentication-subkey", &spec.AuthenticationSubkey, other.AuthenticationSubkey)
+	overrideBool("all-revocation-reasons", &spec.AllRevocationReasons, other.AllRevocationReasons)
+	overrideBool("paper-backup", &spec.PaperBackup, other.PaperBackup)
+	overrideBool("bundle", &spec.Bundle, other.Bundle)
+	return spec
+}
+
+// Subkey returns pointers to the algorithm and expiry of the subkey with the given usage
+func (spec *BatchSpec) Subkey(usage keyalgorithm.Usage) (algorithm *string, expiry *string) {
+	switch usage {
+	case keyalgorithm.Encrypt:
+		return &spec.EncryptionAlgorithm, &spec.EncryptionExpiry
+	case keyalgorithm.Authenticate:
+		return &spec.AuthenticationAlgorithm, &spec.AuthenticationExpiry
+	}
+	return &spec.SigningAlgorithm, &spec.SigningExpiry
+}
+
+// SubkeyUsages returns the usages of all subkeys to generate
+func (spec BatchSpec) SubkeyUsages() []keyalgorithm.Usage {
+	usages := []keyalgorithm.Usage{keyalgorithm.Sign, keyalgorithm.Encrypt}
+	if spec.AuthenticationSubkey {
+		usages = append(usages, keyalgorithm.Authenticate)
+	}
+	return usages
+}
+
+func (spec BatchSpec) Validate() error {
+	if err := utils.ValidateName(spec.Name); err != nil {
+		return err
+	}
+	if err := utils.ValidateEmail(spec.Email); err != nil {
+		return err
+	}
+	if err := utils.ValidateExpiry(spec.Expiry); err != nil {
+		return err
+	}
+	return spec.ValidateBackup()
+}
+
+// ValidateBackup validates the output directory and passphrase source,
+// which are all that is needed to work with an existing key in batch mode
+func (spec BatchSpec) ValidateBackup() error {
+	if spec.OutputDir == "" {
+		return utils.InvalidOutputDirError("must be set in batch mode")
+	}
+	if err := utils.ValidateOutputDir(spec.OutputDir); err != nil {
+		return err
+	}
+	if _, err := spec.QROptions(); err != nil {
+		return err
+	}
+	shamirOptions, err := spec.ShamirOptions()
+	if err != nil {
+		return err
+	}
+	if shamirOptions.Enabled() {
+		if spec.ShamirDir == "" {
+			return utils.InvalidShamirDirError("must be set in batch mode when splitting into shares")
+		}
+		if err := utils.ValidateShamirDir(spec.ShamirDir, spec.OutputDir); err != nil {
+			return err
+		}
+	}
+	if spec.Bundle && (spec.BundlePassphraseFile == "") == (spec.BundlePassphraseEnv == "") {
+		return utils.InvalidPassphraseError("exactly one of bundle passphrase file or bundle passphrase environment variable must be set in batch mode")
+	}
+	return spec.ValidatePassphraseSource()
+}
+
+// ValidatePassphraseSource ensures exactly one of passphrase file or environment variable is set
+func (spec BatchSpec) ValidatePassphraseSource() error {
+	if (spec.PassphraseFile == "") == (spec.PassphraseEnv == "") {
+		return utils.InvalidPassphraseError("exactly one of passphrase file or passphrase environment variable must be set in batch mode")
+	}
+	return nil
+}
+
+// QROptions returns the validated options of the QR backup
+func (spec BatchSpec) QROptions() (qrbackup.Options, error) {
+	return qrbackup.ParseOptions(spec.QRBackup, spec.QRFormat)
+}
+
+// ShamirOptions returns the validated options of splitting the master secret or passphrase into shares
+func (spec BatchSpec) ShamirOptions() (shamir.Options, error) {
+	return shamir.ParseOptions(spec.ShamirShares, spec.ShamirThreshold, spec.ShamirSecret)
+}
+
+// ReadPassphrase reads the passphrase from the configured file or environment variable
+func (spec BatchSpec) ReadPassphrase() (string, error) {
+	return readPassphrase(spec.PassphraseFile, spec.PassphraseEnv)
+}
+
+// ReadBundlePassphrase reads the passphrase of the backup bundle, which must differ from the passphrase of the key
+func (spec BatchSpec) ReadBundlePassphrase() (string, error) {
+	bundlePassphrase, err := readPassphrase(spec.BundlePassphraseFile, spec.BundlePassphraseEnv)
+	if err != nil {
+		return "", fmt.Errorf("bundle passphrase: %w", err)
+	}
+	return bundlePassphrase, nil
+}
+
+func readPassphrase(passphraseFile string, passphraseEnv string) (string, error) {
+	var passphrase string
+	if passphraseFile != "" {
+		contents, err := os.ReadFile(passphraseFile)
+		if err != nil {
+			return "", fmt.Errorf("could not read passphrase file: %w", err)
+		}
+		passphrase = strings.TrimRight(string(contents), "\r\n")
+	} else {
+		value, ok := os.LookupEnv(passphraseEnv)
+		if !ok {
+			return "", utils.InvalidPassphraseError(fmt.Sprintf("environment variable '%s' is not set", passphraseEnv))
+		}
+		passphrase = value
+	}
+	if passphrase == "" {
+		return "", utils.InvalidPassphraseError("can not be empty")
+	}
+	if err := utils.ValidatePassphrase(passphrase); err != nil {
+		return "", err
+	}
+	return passphrase, nil
+}
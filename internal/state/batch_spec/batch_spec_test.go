@@ -0,0 +1,63 @@
+package batchspec
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestOverride(t *testing.T) {
+	spec := BatchSpec{
+		Name:         "Jane Doe",
+		Expiry:       "1y",
+		OutputDir:    "/mnt/backup",
+		PaperBackup:  true,
+		Bundle:       true,
+		ShamirShares: 5,
+	}
+	tests := []struct {
+		name  string
+		flags BatchSpec
+		set   []string
+		want  BatchSpec
+	}{
+		{
+			name:  "no flags set",
+			flags: BatchSpec{Name: "ignored, the flag was not set"},
+			want:  spec,
+		},
+		{
+			name:  "flags set",
+			flags: BatchSpec{Name: "John Doe", OutputDir: "/mnt/other", ShamirShares: 3},
+			set:   []string{"name", "output-dir", "shamir-shares"},
+			want:  BatchSpec{Name: "John Doe", Expiry: "1y", OutputDir: "/mnt/other", PaperBackup: true, Bundle: true, ShamirShares: 3},
+		},
+		{
+			name:  "flags set to false or zero",
+			flags: BatchSpec{},
+			set:   []string{"paper-backup", "bundle", "shamir-shares"},
+			want:  BatchSpec{Name: "Jane Doe", Expiry: "1y", OutputDir: "/mnt/backup"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isSet := func(flag string) bool { return slices.Contains(tt.set, flag) }
+			if got := spec.Override(tt.flags, isSet); got != tt.want {
+				t.Errorf("Override() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	for _, contents := range []string{"paper_backups: true\n", "backup_dir: /mnt/backup\n"} {
+		path := filepath.Join(t.TempDir(), "spec.yaml")
+		if err := os.WriteFile(path, []byte("name: Jane Doe\n"+contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("Load() of a spec file with %q returned no error", contents)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"perfect-gpg-keypair/internal/utils"
+
+	tea "github.com/charmbracelet/bubbletea"
+	logger "github.com/sirupsen/logrus"
+
+	backupbundle "perfect-gpg-keypair/internal/backup_bundle"
+	batchspec "perfect-gpg-keypair/internal/state/batch_spec"
+	keyalgorithm "perfect-gpg-keypair/internal/state/key_algorithm"
+	tmpdir "perfect-gpg-keypair/internal/tmp_dir"
+	"perfect-gpg-keypair/internal/wipe"
+	spinner "perfect-gpg-keypair/ui/spinner"
+)
+
+// setBundleFromBatchSpec reads the bundle passphrase if a bundle is asked for, which must differ from the passphrase of the key
+func (state *State) setBundleFromBatchSpec(spec batchspec.BatchSpec, passphrase string) error {
+	state.Bundle = spec.Bundle
+	if !spec.Bundle {
+		return nil
+	}
+	return state.setBundlePassphrase(spec, passphrase)
+}
+
+// setBundlePassphrase reads the passphrase of the backup bundle, which must differ from the passphrase of the key
+func (state *State) setBundlePassphrase(spec batchspec.BatchSpec, passphrase string) error {
+	bundlePassphrase, err := spec.ReadBundlePassphrase()
+	if err != nil {
+		return err
+	}
+	if bundlePassphrase == passphrase {
+		return utils.InvalidPassphraseError("the passphrase of the backup bundle must differ from the passphrase of the key")
+	}
+	state.bundlePassphrase = bundlePassphrase
+	return nil
+}
+
+// bundleExportedKeys packs the exported keys into a single archive, encrypted with a separate bundle passphrase,
+// if a bundle is asked for
+func (state State) bundleExportedKeys(passphrase string, masterFingerprint string) error {
+	if !state.Bundle {
+		return nil
+	}
+	bundlePassphrase := state.bundlePassphrase
+	if !state.Batch {
+		utils.InfoPrint("The backup bundle will be protected by a separate passphrase")
+		var err error
+		bundlePassphrase, err = GetBundlePassphrase(passphrase)
+		if err != nil {
+			return err
+		}
+	}
+	logger.Debugf("creating backup bundle at: %s\n", state.TmpDir.BundleFilePath())
+	_, err := state.runStep("Creating encrypted backup bundle ...", createBundle(state, bundlePassphrase, masterFingerprint))
+	return err
+}
+
+// bundledFilePaths returns the paths of the exported master key, public key, subkeys and revocation certificates
+func bundledFilePaths(state State) []string {
+	paths := []string{state.TmpDir.PrivateMasterKeyFilePath(), state.TmpDir.PublicMasterKeyFilePath()}
+	for _, usage := range []keyalgorithm.Usage{keyalgorithm.Sign, keyalgorithm.Encrypt, keyalgorithm.Authenticate} {
+		if _, err := os.Stat(state.TmpDir.SubkeyFilePath(usage)); err == nil {
+			paths = append(paths, state.TmpDir.SubkeyFilePath(usage))
+		}
+	}
+	return append(paths, existingRevocationCertFilePaths(state)...)
+}
+
+func createBundle(state State, bundlePassphrase string, masterFingerprint string) tea.Cmd {
+	return func() tea.Msg {
+		keys, err := state.Keyring.GetKeys(false, masterFingerprint)
+		if err != nil || len(keys) != 1 {
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not read key '%s' for the manifest", masterFingerprint))
+		}
+		filePaths := bundledFilePaths(state)
+		manifest, err := tmpdir.NewManifest(keys[0], filePaths)
+		if err != nil {
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not create manifest: %w", err))
+		}
+
+		tarFile, err := os.OpenFile(state.TmpDir.BundleTarFilePath(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return spinner.SpinnerErrMsg(err)
+		}
+		defer func() {
+			if err := wipe.File(state.TmpDir.BundleTarFilePath()); err != nil {
+				logger.Debugf("could not wipe unencrypted bundle archive: %s\n", err)
+			}
+		}()
+		err = backupbundle.WriteTar(tarFile, filePaths, manifest)
+		if closeErr := tarFile.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not create archive: %w", err))
+		}
+
+		err = state.Keyring.EncryptSymmetric(bundlePassphrase, state.TmpDir.BundleTarFilePath(), state.TmpDir.BundleFilePath())
+		if err != nil {
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not encrypt backup bundle: %w", err))
+		}
+		return spinner.ActionCompleteSpinnerMsg("")
+	}
+}
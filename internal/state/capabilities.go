@@ -0,0 +1,56 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+
+	keyalgorithm "perfect-gpg-keypair/internal/state/key_algorithm"
+	"perfect-gpg-keypair/internal/utils"
+)
+
+// CheckGpg probes the installed gpg and fails early if it lacks a feature that is needed, including the algorithms
+// of the keys to generate if they are already set. The keyring falls back where gpg lacks an optional feature.
+func (state *State) CheckGpg() error {
+	keyring, err := state.Keyring.WithCapabilities()
+	if err != nil {
+		return err
+	}
+	state.Keyring = keyring
+	capabilities := *keyring.Capabilities
+	if state.UserInfo.Algorithm.Name == "" {
+		return nil
+	}
+	if !state.UserInfo.Algorithm.SupportedBy(capabilities) {
+		return unsupportedAlgorithmError(state.UserInfo.Algorithm.Name, capabilities)
+	}
+	for _, subkey := range state.UserInfo.Subkeys {
+		if !subkey.Algorithm.SupportedBy(capabilities) {
+			return unsupportedAlgorithmError(subkey.Algorithm.Name(), capabilities)
+		}
+		if subkey.Usage == keyalgorithm.Authenticate {
+			if err := capabilities.CheckExportSSHKey(); err != nil {
+				utils.WarningPrint(fmt.Sprintf("%s. The authentication subkey is generated anyway, upgrade gpg to use it for SSH.", err))
+			}
+		}
+	}
+	return nil
+}
+
+// CheckSubkeyAlgorithm fails if the installed gpg, as probed by CheckGpg, does not support the algorithm
+func (state State) CheckSubkeyAlgorithm(spec keyalgorithm.KeySpec) error {
+	if state.Keyring.Capabilities != nil && !spec.SupportedBy(*state.Keyring.Capabilities) {
+		return unsupportedAlgorithmError(spec.Name(), *state.Keyring.Capabilities)
+	}
+	return nil
+}
+
+func unsupportedAlgorithmError(name string, capabilities utils.GpgCapabilities) error {
+	supported := []string{}
+	for _, profile := range keyalgorithm.SupportedProfiles(&capabilities) {
+		supported = append(supported, profile.Name)
+	}
+	return &utils.GpgUnsupportedError{
+		Feature: fmt.Sprintf("the algorithm '%s'", name),
+		Reason:  fmt.Sprintf("'%s' (version %s) supports: %s", capabilities.Path, capabilities.Version, strings.Join(supported, ", ")),
+	}
+}
@@ -0,0 +1,47 @@
+package state
+
+import (
+	"errors"
+	"testing"
+
+	gpgfake "perfect-gpg-keypair/internal/gpg_fake"
+	"perfect-gpg-keypair/internal/utils"
+)
+
+// withGpgVersion makes the runner answer the capability probe as a gpg of the given version
+// that supports the public key algorithms (as listed by 'gpg --version')
+func withGpgVersion(runner *gpgfake.Runner, version string, pubkeys string) *gpgfake.Runner {
+	return runner.
+		On(gpgfake.Response{Stdout: "gpg:OpenPGP:/usr/bin/gpg\n"}, "--list-components").
+		On(gpgfake.Response{Stdout: "gpg (GnuPG) " + version + "\nPubkey: " + pubkeys + "\n"}, "--version").
+		On(gpgfake.Response{Stdout: "cfg:curve:cv25519;ed25519;nistp384\n"}, "--list-config").
+		On(gpgfake.Response{Stdout: "--sign\n--export-ssh-key\n--version\n"}, "--dump-options").
+		On(gpgfake.Response{Stdout: "no-allow-loopback-pinentry:8:2:disallow caller to override the pinentry:0:0::::\n"}, "--list-options", "gpg-agent")
+}
+
+func TestCheckGpgKeepsCapabilities(t *testing.T) {
+	state := newTestState(t, withGpgVersion(newTestRunner(), "2.2.40", "RSA, ELG, DSA, ECDH, ECDSA, EDDSA"))
+
+	if err := state.CheckGpg(); err != nil {
+		t.Fatalf("CheckGpg() returned error: %v", err)
+	}
+	if state.Keyring.Capabilities == nil || state.Keyring.Capabilities.Version != "2.2.40" {
+		t.Fatalf("expected the capabilities of gpg 2.2.40 to be kept, got %+v", state.Keyring.Capabilities)
+	}
+	if err := state.CreateIsolatedKeyring(); err != nil {
+		t.Fatal(err)
+	}
+	if state.Keyring.Capabilities == nil {
+		t.Error("expected the isolated keyring to keep the capabilities")
+	}
+}
+
+func TestCheckGpgRejectsUnsupportedAlgorithm(t *testing.T) {
+	state := newTestState(t, withGpgVersion(newTestRunner(), "2.2.40", "RSA, ELG, DSA"))
+
+	err := state.CheckGpg()
+	var unsupported *utils.GpgUnsupportedError
+	if !errors.As(err, &unsupported) {
+		t.Fatalf("CheckGpg() returned %v for ed25519 without EDDSA, want a GpgUnsupportedError", err)
+	}
+}
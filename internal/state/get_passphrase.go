@@ -1,13 +1,34 @@
 package state
 
 import (
+	"fmt"
+
 	utils "perfect-gpg-keypair/internal/utils"
 	userinput "perfect-gpg-keypair/ui/user_input"
 )
 
 func GetPassphrase() (string, error) {
+	return getNewPassphrase("Please enter a passphrase:")
+}
+
+// GetBundlePassphrase asks for the passphrase of a new backup bundle, which must differ from the passphrase of the key
+func GetBundlePassphrase(keyPassphrase string) (string, error) {
+	for {
+		bundlePassphrase, err := getNewPassphrase("Please enter a separate passphrase for the backup bundle:")
+		if err != nil {
+			return "", err
+		}
+		if bundlePassphrase == keyPassphrase {
+			utils.ErrorPrint("The passphrase of the backup bundle must differ from the passphrase of the key!")
+		} else {
+			return bundlePassphrase, nil
+		}
+	}
+}
+
+func getNewPassphrase(prompt string) (string, error) {
 	for {
-		firstPassphraseInputModel := userinput.NewPassphraseInputModel("Please enter a passphrase:")
+		firstPassphraseInputModel := userinput.NewPassphraseInputModel(prompt)
 		if err := userinput.GetUserInput(&firstPassphraseInputModel); err != nil {
 			return "", err
 		}
@@ -25,3 +46,21 @@ func GetPassphrase() (string, error) {
 		}
 	}
 }
+
+// GetExistingPassphrase asks for the passphrase of an existing key, which needs no confirmation
+func GetExistingPassphrase() (string, error) {
+	return getExistingPassphrase("master key")
+}
+
+// GetExistingBundlePassphrase asks for the passphrase of an existing backup bundle
+func GetExistingBundlePassphrase() (string, error) {
+	return getExistingPassphrase("backup bundle")
+}
+
+func getExistingPassphrase(description string) (string, error) {
+	passphraseInputModel := userinput.NewPassphraseInputModel(fmt.Sprintf("Please enter the passphrase of the %s:", description))
+	if err := userinput.GetUserInput(&passphraseInputModel); err != nil {
+		return "", err
+	}
+	return passphraseInputModel.Value(), nil
+}
@@ -0,0 +1,292 @@
+package keyalgorithm
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	utils "perfect-gpg-keypair/internal/utils"
+)
+
+const DefaultProfileName = "rsa4096"
+
+type KeyType string
+
+const (
+	RSA   KeyType = "RSA"
+	EdDSA KeyType = "EDDSA"
+	ECDSA KeyType = "ECDSA"
+	ECDH  KeyType = "ECDH"
+)
+
+// Usage is the capability of a subkey as understood by 'gpg --quick-add-key'
+type Usage string
+
+const (
+	Sign         Usage = "sign"
+	Encrypt      Usage = "encr"
+	Authenticate Usage = "auth"
+)
+
+var SubkeyUsages = []Usage{Sign, Encrypt, Authenticate}
+
+func (usage Usage) Description() string {
+	switch usage {
+	case Sign:
+		return "signing"
+	case Encrypt:
+		return "encryption"
+	case Authenticate:
+		return "authentication"
+	}
+	return string(usage)
+}
+
+// KeySpec describes the algorithm of a single (sub)key
+type KeySpec struct {
+	Type   KeyType
+	Length int
+	Curve  string
+}
+
+func (spec KeySpec) CanSign() bool {
+	return spec.Type == RSA || spec.Type == EdDSA || spec.Type == ECDSA
+}
+
+func (spec KeySpec) CanEncrypt() bool {
+	return spec.Type == RSA || spec.Type == ECDH
+}
+
+func (spec KeySpec) Supports(usage Usage) bool {
+	if usage == Encrypt {
+		return spec.CanEncrypt()
+	}
+	return spec.CanSign()
+}
+
+// Name returns the algorithm as understood by 'gpg --quick-add-key', e.g. 'rsa4096' or 'ed25519'
+func (spec KeySpec) Name() string {
+	if spec.Type == RSA {
+		return fmt.Sprintf("rsa%d", spec.Length)
+	}
+	return spec.Curve
+}
+
+// SupportedBy reports whether the installed gpg supports the algorithm
+func (spec KeySpec) SupportedBy(capabilities utils.GpgCapabilities) bool {
+	return capabilities.SupportsAlgorithm(string(spec.Type), spec.Curve)
+}
+
+// family groups algorithms that belong together, e.g. ed25519 and cv25519
+func (spec KeySpec) family() string {
+	if spec.Type == RSA {
+		return "rsa"
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(spec.Curve, "ed"), "cv")
+}
+
+// ParameterLines returns the lines describing the key in a gpg batch parameters file,
+// prefix is either 'Key' or 'Subkey'
+func (spec KeySpec) ParameterLines(prefix string) string {
+	if spec.Type == RSA {
+		return fmt.Sprintf("%s-Type: %s\n%s-Length: %d\n", prefix, spec.Type, prefix, spec.Length)
+	}
+	return fmt.Sprintf("%s-Type: %s\n%s-Curve: %s\n", prefix, spec.Type, prefix, spec.Curve)
+}
+
+func (spec KeySpec) validate() error {
+	switch spec.Type {
+	case RSA:
+		if spec.Length != 3072 && spec.Length != 4096 {
+			return utils.InvalidAlgorithmError(fmt.Sprintf("unsupported RSA key length %d", spec.Length))
+		}
+	case EdDSA, ECDSA, ECDH:
+		if spec.Curve == "" {
+			return utils.InvalidAlgorithmError(fmt.Sprintf("%s key requires a curve", spec.Type))
+		}
+	default:
+		return utils.InvalidAlgorithmError(fmt.Sprintf("unknown key type '%s'", spec.Type))
+	}
+	return nil
+}
+
+// Profile is a coherent combination of algorithms for the master key and its subkeys
+type Profile struct {
+	Name           string
+	Description    string
+	Master         KeySpec
+	Signing        KeySpec
+	Encryption     KeySpec
+	Authentication KeySpec
+}
+
+func (profile Profile) String() string {
+	return fmt.Sprintf("%s (%s)", profile.Name, profile.Description)
+}
+
+// Subkey returns the default algorithm of the profile for a subkey with the given usage
+func (profile Profile) Subkey(usage Usage) KeySpec {
+	switch usage {
+	case Encrypt:
+		return profile.Encryption
+	case Authenticate:
+		return profile.Authentication
+	}
+	return profile.Signing
+}
+
+// SupportedBy reports whether the installed gpg supports the algorithms of the master key and all subkeys
+func (profile Profile) SupportedBy(capabilities utils.GpgCapabilities) bool {
+	for _, spec := range []KeySpec{profile.Master, profile.Signing, profile.Encryption, profile.Authentication} {
+		if !spec.SupportedBy(capabilities) {
+			return false
+		}
+	}
+	return true
+}
+
+func (profile Profile) Validate() error {
+	for _, spec := range []KeySpec{profile.Master, profile.Signing, profile.Encryption, profile.Authentication} {
+		if err := spec.validate(); err != nil {
+			return err
+		}
+	}
+	if !profile.Master.CanSign() {
+		return utils.InvalidAlgorithmError(fmt.Sprintf("master key algorithm '%s' can not certify", profile.Master.Name()))
+	}
+	for _, usage := range SubkeyUsages {
+		if err := profile.ValidateSubkey(usage, profile.Subkey(usage)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateSubkey checks that the algorithm can be used for a subkey with the given usage of the profile's master key
+func (profile Profile) ValidateSubkey(usage Usage, spec KeySpec) error {
+	if err := spec.validate(); err != nil {
+		return err
+	}
+	if !spec.Supports(usage) {
+		return utils.InvalidAlgorithmError(fmt.Sprintf(
+			"%s subkey algorithm '%s' can not be used for %s", usage.Description(), spec.Name(), usage.Description(),
+		))
+	}
+	if spec.family() != profile.Master.family() {
+		return utils.InvalidAlgorithmError(fmt.Sprintf(
+			"%s subkey algorithm '%s' does not match master key algorithm '%s'",
+			usage.Description(), spec.Name(), profile.Master.Name(),
+		))
+	}
+	return nil
+}
+
+// SubkeyAlgorithmNames returns the names of the algorithms that can be used for a subkey with the given usage of the profile's master key
+func (profile Profile) SubkeyAlgorithmNames(usage Usage) []string {
+	names := []string{}
+	for _, name := range SubkeyAlgorithmNames(usage) {
+		spec, err := ParseKeySpec(name, usage)
+		if err == nil && profile.ValidateSubkey(usage, spec) == nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+var profiles = []Profile{
+	{
+		Name:           "ed25519",
+		Description:    "Ed25519 signing keys with a Cv25519 encryption subkey",
+		Master:         KeySpec{Type: EdDSA, Curve: "ed25519"},
+		Signing:        KeySpec{Type: EdDSA, Curve: "ed25519"},
+		Encryption:     KeySpec{Type: ECDH, Curve: "cv25519"},
+		Authentication: KeySpec{Type: EdDSA, Curve: "ed25519"},
+	},
+	{
+		Name:           "rsa4096",
+		Description:    "RSA keys with 4096 bit size",
+		Master:         KeySpec{Type: RSA, Length: 4096},
+		Signing:        KeySpec{Type: RSA, Length: 4096},
+		Encryption:     KeySpec{Type: RSA, Length: 4096},
+		Authentication: KeySpec{Type: RSA, Length: 4096},
+	},
+	{
+		Name:           "rsa3072",
+		Description:    "RSA keys with 3072 bit size",
+		Master:         KeySpec{Type: RSA, Length: 3072},
+		Signing:        KeySpec{Type: RSA, Length: 3072},
+		Encryption:     KeySpec{Type: RSA, Length: 3072},
+		Authentication: KeySpec{Type: RSA, Length: 3072},
+	},
+	{
+		Name:           "nistp384",
+		Description:    "ECDSA keys on the NIST P-384 curve with an ECDH encryption subkey",
+		Master:         KeySpec{Type: ECDSA, Curve: "nistp384"},
+		Signing:        KeySpec{Type: ECDSA, Curve: "nistp384"},
+		Encryption:     KeySpec{Type: ECDH, Curve: "nistp384"},
+		Authentication: KeySpec{Type: ECDSA, Curve: "nistp384"},
+	},
+}
+
+func Profiles() []Profile {
+	return profiles
+}
+
+// SupportedProfiles returns the profiles the installed gpg supports, or all profiles if it was not probed
+func SupportedProfiles(capabilities *utils.GpgCapabilities) []Profile {
+	if capabilities == nil {
+		return profiles
+	}
+	supported := []Profile{}
+	for _, profile := range profiles {
+		if profile.SupportedBy(*capabilities) {
+			supported = append(supported, profile)
+		}
+	}
+	return supported
+}
+
+func ProfileNames() []string {
+	names := make([]string, len(profiles))
+	for i, profile := range profiles {
+		names[i] = profile.Name
+	}
+	return names
+}
+
+// SubkeyAlgorithmNames returns the names of all algorithms that can be used for a subkey with the given usage
+func SubkeyAlgorithmNames(usage Usage) []string {
+	names := []string{}
+	for _, profile := range profiles {
+		name := profile.Subkey(usage).Name()
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ParseKeySpec parses an algorithm name as understood by 'gpg --quick-add-key' for a subkey with the given usage
+func ParseKeySpec(name string, usage Usage) (KeySpec, error) {
+	for _, profile := range profiles {
+		spec := profile.Subkey(usage)
+		if spec.Name() == strings.ToLower(name) {
+			return spec, nil
+		}
+	}
+	return KeySpec{}, utils.InvalidAlgorithmError(fmt.Sprintf(
+		"unknown %s subkey algorithm '%s', must be one of: %s",
+		usage.Description(), name, strings.Join(SubkeyAlgorithmNames(usage), ", "),
+	))
+}
+
+func GetProfile(name string) (Profile, error) {
+	for _, profile := range profiles {
+		if profile.Name == strings.ToLower(name) {
+			return profile, profile.Validate()
+		}
+	}
+	return Profile{}, utils.InvalidAlgorithmError(
+		fmt.Sprintf("unknown algorithm '%s', must be one of: %s", name, strings.Join(ProfileNames(), ", ")),
+	)
+}
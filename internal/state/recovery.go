@@ -0,0 +1,275 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	logger "github.com/sirupsen/logrus"
+
+	keylist "perfect-gpg-keypair/internal/key_list"
+	runrecord "perfect-gpg-keypair/internal/run_record"
+	keyalgorithm "perfect-gpg-keypair/internal/state/key_algorithm"
+	userinfo "perfect-gpg-keypair/internal/state/user_info"
+	tmpdir "perfect-gpg-keypair/internal/tmp_dir"
+	"perfect-gpg-keypair/internal/utils"
+	"perfect-gpg-keypair/internal/wipe"
+	selection "perfect-gpg-keypair/ui/selection"
+	spinner "perfect-gpg-keypair/ui/spinner"
+)
+
+// RecoveryAction is what is done with a master key an aborted run left in the default keyring
+type RecoveryAction string
+
+const (
+	// Finish exports and backs up the key, then removes the secret master key and reimports the subkeys
+	Finish RecoveryAction = "finish"
+	// RollBack deletes the key from the keyring
+	RollBack RecoveryAction = "rollback"
+	// Resume continues the run from its temporary directory, see ResumeGeneration
+	Resume RecoveryAction = "resume"
+)
+
+var RecoveryActions = []RecoveryAction{Resume, Finish, RollBack}
+
+func ParseRecoveryAction(action string) (RecoveryAction, error) {
+	if action == "" || slices.Contains(RecoveryActions, RecoveryAction(action)) {
+		return RecoveryAction(action), nil
+	}
+	names := make([]string, len(RecoveryActions))
+	for i, recoveryAction := range RecoveryActions {
+		names[i] = string(recoveryAction)
+	}
+	return "", utils.InvalidRecoveryActionError(fmt.Sprintf("'%s', must be one of %s", action, strings.Join(names, ", ")))
+}
+
+// RecoverAbortedRun deals with what an aborted run of generate left behind, as set by action or asked for:
+// a run whose temporary directory is left can be resumed, a master key left in the default keyring can be finished or rolled back.
+// Unless the run is resumed, its temporary directory is wiped. Returns the action taken, if any.
+func (state *State) RecoverAbortedRun(record runrecord.Record, action RecoveryAction) (RecoveryAction, error) {
+	utils.WarningPrint(fmt.Sprintf(
+		"A previous run of generate (started %s) was aborted after stage '%s'", record.Started.Format(time.DateTime), record.Stage,
+	))
+	tmpDir, err := tmpdir.OpenTmpDir(record.TmpDir)
+	canResume := err == nil && CanResume(tmpDir)
+	master, masterLeft := state.leftoverMasterKey(record)
+	if !canResume && !masterLeft {
+		state.wipeAbortedRunTmpDir(record)
+		explainAbortedRun(record)
+		return "", runrecord.Remove()
+	}
+
+	if masterLeft {
+		utils.WarningPrint(fmt.Sprintf("The secret master key '%s' (%s) is still in your keyring!", master.Fingerprint, master.UserID()))
+	}
+	if canResume {
+		utils.InfoPrint(fmt.Sprintf("The aborted run can be resumed from '%s'", record.TmpDir))
+	}
+	// without subkeys nothing would be left in the keyring after removing the master key
+	canFinish := masterLeft && len(currentSubkeyFingerprints(master)) > 0
+	if action == "" {
+		if state.Batch {
+			return "", fmt.Errorf("choose what to do with the aborted run with --aborted-run %s", availableRecoveryActions(canResume, canFinish))
+		}
+		if action, err = chooseRecoveryAction(canResume, canFinish, masterLeft); err != nil {
+			return "", err
+		}
+	}
+	switch action {
+	case Resume:
+		if !canResume {
+			return "", fmt.Errorf("the aborted run can not be resumed, use --aborted-run %s", availableRecoveryActions(canResume, canFinish))
+		}
+		return Resume, nil
+	case Finish:
+		if !canFinish {
+			return "", fmt.Errorf("the aborted run can not be finished, use --aborted-run %s", availableRecoveryActions(canResume, canFinish))
+		}
+		state.wipeAbortedRunTmpDir(record)
+		if err := state.finishAbortedRun(record, master); err != nil {
+			return "", err
+		}
+		return Finish, runrecord.Remove()
+	case RollBack:
+		state.wipeAbortedRunTmpDir(record)
+		if masterLeft {
+			if err := state.rollBackAbortedRun(master); err != nil {
+				return "", err
+			}
+		}
+		return RollBack, runrecord.Remove()
+	}
+	return "", fmt.Errorf("invalid action for an aborted run '%s'", action)
+}
+
+// leftoverMasterKey returns the master key of the aborted run, if its secret part is still in the default keyring
+func (state State) leftoverMasterKey(record runrecord.Record) (keylist.Key, bool) {
+	if !record.NeedsRecovery() {
+		return keylist.Key{}, false
+	}
+	keys, err := state.defaultKeyring().GetKeys(true, record.Fingerprint)
+	if err != nil || len(keys) != 1 || keys[0].Secret != keylist.SecretAvailable {
+		return keylist.Key{}, false
+	}
+	return keys[0], true
+}
+
+// explainAbortedRun tells what is left of an aborted run that can neither be resumed nor has left its master key behind
+func explainAbortedRun(record runrecord.Record) {
+	switch {
+	case record.Isolated() && record.Stage == runrecord.BackedUp:
+		utils.WarningPrint(fmt.Sprintf(
+			"The key '%s' was generated in a throwaway keyring and only exists in its backup.\n"+
+				"Import its subkeys with 'gpg --import' or delete the backup.", record.Fingerprint,
+		))
+	case record.NeedsRecovery() && record.Stage == runrecord.MasterRemoved:
+		outputDir := record.OutputDir
+		if outputDir == "" {
+			outputDir = "your backup"
+		}
+		utils.WarningPrint(fmt.Sprintf(
+			"The master key '%s' has already been removed from your keyring, but the subkeys may not have been reimported.\n"+
+				"Check with 'gpg -K %s' and if needed import them from %s with 'gpg --import <subkey file>'.",
+			record.Fingerprint, record.Fingerprint, outputDir,
+		))
+	case record.NeedsRecovery():
+		utils.InfoPrint(fmt.Sprintf("The master key '%s' is no longer in your keyring, nothing to recover", record.Fingerprint))
+	}
+}
+
+func availableRecoveryActions(canResume bool, canFinish bool) string {
+	actions := []string{}
+	if canResume {
+		actions = append(actions, string(Resume))
+	}
+	if canFinish {
+		actions = append(actions, string(Finish))
+	}
+	return strings.Join(append(actions, string(RollBack)), "|")
+}
+
+func chooseRecoveryAction(canResume bool, canFinish bool, masterLeft bool) (RecoveryAction, error) {
+	options := []selection.Option{}
+	if canResume {
+		options = append(options, selection.Option{Label: "Resume: continue the aborted run where it stopped", Value: string(Resume)})
+	}
+	if canFinish {
+		options = append(options, selection.Option{Label: "Finish: back up the key, then remove the master key and keep the subkeys", Value: string(Finish)})
+	}
+	rollBackLabel := "Discard: wipe the aborted run and start over"
+	if masterLeft {
+		rollBackLabel = "Roll back: delete the key from the keyring and start over"
+	}
+	options = append(options,
+		selection.Option{Label: rollBackLabel, Value: string(RollBack)},
+		selection.Option{Label: "Quit and decide later", Value: ""},
+	)
+	choice, err := selection.Select("What should be done with it?", options, options[0].Value)
+	if err != nil {
+		return "", err
+	}
+	if choice == "" {
+		return "", &utils.UserInterrupt{}
+	}
+	return RecoveryAction(choice), nil
+}
+
+// wipeAbortedRunTmpDir stops the gpg-agent of the throwaway keyring and wipes the temporary directory of the aborted run,
+// which is only left if the run was killed before it could clean up
+func (state State) wipeAbortedRunTmpDir(record runrecord.Record) {
+	if _, err := os.Stat(record.TmpDir); err != nil {
+		return
+	}
+	if record.Isolated() {
+		if err := state.Keyring.WithHomeDir(record.GnupgHome).KillAgent(); err != nil {
+			logger.Debugf("could not stop gpg-agent of the aborted run: %s\n", err)
+		}
+	}
+	logger.Debugf("wiping temporary directory of the aborted run: %s\n", record.TmpDir)
+	if report := wipe.Dir(record.TmpDir); !report.OK() {
+		utils.WarningPrint(fmt.Sprintf("Could not wipe the temporary files of the aborted run:\n%s", report.Error()))
+		return
+	}
+	utils.InfoPrint(fmt.Sprintf("Wiped the temporary files of the aborted run at '%s'", record.TmpDir))
+}
+
+// finishAbortedRun runs the remaining steps of generate for a master key in the default keyring:
+// a new revocation certificate, export and backup of the keys, then removal of the master key
+func (state *State) finishAbortedRun(record runrecord.Record, master keylist.Key) error {
+	if !state.Batch {
+		passphrase, err := GetExistingPassphrase()
+		if err != nil {
+			return err
+		}
+		state.passphrase = passphrase
+	}
+	if err := state.TmpDir.Create(); err != nil {
+		return fmt.Errorf("could not create temporary directory: %w", err)
+	}
+	// in batch mode the revocation is set from the spec, interactively the information of the new key has not been asked for yet
+	if !state.Batch {
+		state.UserInfo.Revocation = userinfo.Revocation{Reason: userinfo.DefaultRevocationReason}
+	}
+	subkeyFingerprints := currentSubkeyFingerprints(master)
+	state.UserInfo.Subkeys = []userinfo.Subkey{}
+	for _, usage := range []keyalgorithm.Usage{keyalgorithm.Sign, keyalgorithm.Encrypt, keyalgorithm.Authenticate} {
+		if _, ok := subkeyFingerprints[usage]; ok {
+			state.UserInfo.Subkeys = append(state.UserInfo.Subkeys, userinfo.Subkey{Usage: usage})
+		}
+	}
+	record.PID = os.Getpid()
+	record.TmpDir = state.TmpDir.Path()
+	record.OutputDir = state.OutputDir
+	state.Progress = &record
+
+	revocationCertFilePaths := state.TmpDir.RevocationCertFilePaths(state.UserInfo.Revocation)
+	for _, reason := range state.UserInfo.Revocation.Reasons() {
+		_, err := state.runStep(
+			fmt.Sprintf("Creating revocation certificate (%s) ...", reason.Description()),
+			createRevocationCertificate(*state, state.passphrase, master.Fingerprint, reason, revocationCertFilePaths[reason]),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if err := state.exportAndBackUpKeys(master.Fingerprint); err != nil {
+		return err
+	}
+	state.recordProgress(runrecord.MasterRemoved, master.Fingerprint)
+	if _, err := state.runStep("Removing master keypair ...", removeMasterKey(*state, state.passphrase, master.Fingerprint)); err != nil {
+		return err
+	}
+	if _, err := state.runStep("Reimporting subkeys ...", reimportSubkeys(*state, state.passphrase)); err != nil {
+		return err
+	}
+
+	utils.InfoPrint("\nYour GPG keypair is:")
+	state.defaultKeyring().ListKeys(true, "long", master.Fingerprint)
+	utils.InfoPrint(fmt.Sprintf("Ensure that the key with SC attributes and the fingerprint '%s' is prepended by 'sec#'\n", master.Fingerprint))
+	return nil
+}
+
+// rollBackAbortedRun deletes the key of the aborted run from the default keyring
+func (state *State) rollBackAbortedRun(master keylist.Key) error {
+	_, err := state.runStep(
+		fmt.Sprintf("Deleting key '%s' from your keyring ...", master.Fingerprint),
+		deleteKey(state.defaultKeyring(), master.Fingerprint),
+	)
+	if err != nil {
+		return err
+	}
+	utils.InfoPrint(fmt.Sprintf("Deleted the key '%s' of the aborted run from your keyring", master.Fingerprint))
+	return nil
+}
+
+func deleteKey(keyring utils.Keyring, fingerprint string) tea.Cmd {
+	return func() tea.Msg {
+		if err := keyring.DeleteEntireKey(fingerprint); err != nil {
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not delete key: %w", err))
+		}
+		return spinner.ActionCompleteSpinnerMsg("")
+	}
+}
@@ -0,0 +1,115 @@
+package state
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gpgfake "perfect-gpg-keypair/internal/gpg_fake"
+	runrecord "perfect-gpg-keypair/internal/run_record"
+)
+
+func TestRecoverAbortedRun(t *testing.T) {
+	masterOnly := strings.Join(strings.Split(testKeyListing(true), "\n")[:3], "\n") + "\n"
+
+	tests := []struct {
+		name    string
+		listing string
+		action  RecoveryAction
+		want    RecoveryAction
+		wantErr string
+		// the gpg commands that must (or with a count of 0 must not) have been run
+		wantCalls map[string]int
+		wiped     bool
+	}{
+		{
+			name:      "no action chosen",
+			listing:   testKeyListing(true),
+			wantErr:   "--aborted-run finish|rollback",
+			wantCalls: map[string]int{"--delete-secret-and-public-keys": 0, "--delete-secret-keys": 0},
+		},
+		{
+			name:      "roll back",
+			listing:   testKeyListing(true),
+			action:    RollBack,
+			want:      RollBack,
+			wantCalls: map[string]int{"--delete-secret-and-public-keys": 1, "--delete-secret-keys": 0},
+			wiped:     true,
+		},
+		{
+			name:      "finish",
+			listing:   testKeyListing(true),
+			action:    Finish,
+			want:      Finish,
+			wantCalls: map[string]int{"--delete-secret-and-public-keys": 0, "--gen-revoke": 1, "--export-secret-subkeys": 2, "--delete-secret-keys": 1},
+			wiped:     true,
+		},
+		{
+			name:      "finish without subkeys",
+			listing:   masterOnly,
+			action:    Finish,
+			wantErr:   "can not be finished, use --aborted-run rollback",
+			wantCalls: map[string]int{"--delete-secret-and-public-keys": 0, "--delete-secret-keys": 0},
+		},
+		{
+			name:      "resume without journal",
+			listing:   testKeyListing(true),
+			action:    Resume,
+			wantErr:   "can not be resumed, use --aborted-run finish|rollback",
+			wantCalls: map[string]int{"--delete-secret-and-public-keys": 0, "--delete-secret-keys": 0},
+		},
+		{
+			name:      "master key no longer in the keyring",
+			listing:   "",
+			action:    Finish,
+			wantCalls: map[string]int{"--delete-secret-and-public-keys": 0, "--delete-secret-keys": 0},
+			wiped:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_STATE_HOME", t.TempDir())
+			runner := newTestRunner().On(gpgfake.Response{Stdout: tt.listing}, "--list-secret-keys", testMasterFingerprint)
+			state := newTestState(t, runner)
+			abortedTmpDir := filepath.Join(t.TempDir(), "aborted")
+			if err := os.MkdirAll(filepath.Join(abortedTmpDir, "keys"), 0700); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(abortedTmpDir, "keys", ".private-master.gpg"), []byte("private master key\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			record := runrecord.New(abortedTmpDir, "")
+			record.PID = 0
+			record.Fingerprint = testMasterFingerprint
+			record.Stage = runrecord.MasterGenerated
+			if err := record.Save(); err != nil {
+				t.Fatal(err)
+			}
+
+			action, err := state.RecoverAbortedRun(record, tt.action)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("RecoverAbortedRun() returned %v, want an error containing %q", err, tt.wantErr)
+				}
+			} else if err != nil || action != tt.want {
+				t.Errorf("RecoverAbortedRun() = %q, %v, want %q", action, err, tt.want)
+			}
+			for command, want := range tt.wantCalls {
+				if calls := runner.Calls(command); len(calls) != want {
+					t.Errorf("gpg %s was run %d times, want %d", command, len(calls), want)
+				}
+			}
+			_, err = os.Stat(abortedTmpDir)
+			if wiped := errors.Is(err, fs.ErrNotExist); wiped != tt.wiped {
+				t.Errorf("the temporary directory of the aborted run was wiped: %v, want %v", wiped, tt.wiped)
+			}
+			// the record is kept until the aborted run was dealt with
+			if _, found, err := runrecord.Load(); err != nil || found != (tt.wantErr != "") {
+				t.Errorf("the record is left: %v (%v), want %v", found, err, tt.wantErr != "")
+			}
+		})
+	}
+}
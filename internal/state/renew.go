@@ -0,0 +1,238 @@
+package state
+
+import (
+	"fmt"
+	"perfect-gpg-keypair/internal/utils"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	logger "github.com/sirupsen/logrus"
+
+	keylist "perfect-gpg-keypair/internal/key_list"
+	batchspec "perfect-gpg-keypair/internal/state/batch_spec"
+	keyalgorithm "perfect-gpg-keypair/internal/state/key_algorithm"
+	spinner "perfect-gpg-keypair/ui/spinner"
+)
+
+// SetBackupFromBatchSpec sets up the state for working with an existing master key backup without any user interaction
+func (state *State) SetBackupFromBatchSpec(spec batchspec.BatchSpec) error {
+	if err := spec.ValidateBackup(); err != nil {
+		return err
+	}
+	passphrase, err := spec.ReadPassphrase()
+	if err != nil {
+		return err
+	}
+	qrBackup, err := spec.QROptions()
+	if err != nil {
+		return err
+	}
+	shamirOptions, err := spec.ShamirOptions()
+	if err != nil {
+		return err
+	}
+	if err := state.setBundleFromBatchSpec(spec, passphrase); err != nil {
+		return err
+	}
+	state.Batch = true
+	state.OutputDir = spec.OutputDir
+	state.PaperBackup = spec.PaperBackup
+	state.QRBackup = qrBackup
+	state.Shamir = shamirOptions
+	state.ShamirDir = spec.ShamirDir
+	state.passphrase = passphrase
+	return nil
+}
+
+// SetPassphraseFromBatchSpec sets up the state for only reading an existing master key backup without any user interaction
+func (state *State) SetPassphraseFromBatchSpec(spec batchspec.BatchSpec) error {
+	if err := spec.ValidatePassphraseSource(); err != nil {
+		return err
+	}
+	passphrase, err := spec.ReadPassphrase()
+	if err != nil {
+		return err
+	}
+	state.Batch = true
+	state.passphrase = passphrase
+	return nil
+}
+
+// OpenMasterBackup imports the backup of the master key into a throwaway keyring inside the temporary directory,
+// so that the master secret never touches the default keyring, and returns the imported key
+func (state *State) OpenMasterBackup(backupFilePath string) (keylist.Key, error) {
+	if !state.Batch {
+		passphrase, err := GetExistingPassphrase()
+		if err != nil {
+			return keylist.Key{}, err
+		}
+		state.passphrase = passphrase
+	}
+	if err := state.CreateIsolatedKeyring(); err != nil {
+		return keylist.Key{}, fmt.Errorf("could not create temporary keyring: %w", err)
+	}
+
+	logger.Debugf("importing master key backup '%s' into temporary keyring\n", backupFilePath)
+	_, err := state.runStep("Importing master key backup ...", importMasterBackup(*state, backupFilePath))
+	if err != nil {
+		return keylist.Key{}, err
+	}
+	keys, err := state.Keyring.GetKeys(true, "")
+	if err != nil {
+		return keylist.Key{}, fmt.Errorf("could not list imported keys: %w", err)
+	}
+	if len(keys) != 1 {
+		return keylist.Key{}, fmt.Errorf("backup file must contain exactly one secret key, found %d", len(keys))
+	}
+	if keys[0].Secret != keylist.SecretAvailable {
+		return keylist.Key{}, fmt.Errorf("backup file does not contain the secret master key")
+	}
+	logger.Debugf("imported master key with fingerprint: %s\n", keys[0].Fingerprint)
+	return keys[0], nil
+}
+
+// RenewKeys extends the expiry of the master key and the given subkeys (all subkeys that are not revoked if none are given),
+// backs up the updated keys and refreshes the public key in the default keyring
+func (state State) RenewKeys(master keylist.Key, expiry string, subkeyIds []string) error {
+	subkeys, err := selectSubkeys(master, subkeyIds)
+	if err != nil {
+		return err
+	}
+	subkeyFingerprints := make([]string, len(subkeys))
+	for i, subkey := range subkeys {
+		subkeyFingerprints[i] = subkey.Fingerprint
+	}
+
+	logger.Debugf("setting expiry of %s and subkeys [%s] to %s\n", master.Fingerprint, strings.Join(subkeyFingerprints, ", "), expiry)
+	_, err = state.runStep(
+		fmt.Sprintf("Extending expiry of master key and %d subkey(s) to %s ...", len(subkeys), expiry),
+		setExpiry(state, master.Fingerprint, expiry, subkeyFingerprints),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := state.exportAndBackUpKeys(master.Fingerprint); err != nil {
+		return err
+	}
+
+	logger.Debugf("importing updated public key into the default keyring\n")
+	_, err = state.runStep("Updating public key in your keyring ...", importPublicKeyIntoDefaultKeyring(state))
+	if err != nil {
+		return err
+	}
+
+	utils.InfoPrint("\nYour renewed GPG keypair is:")
+	state.defaultKeyring().ListKeys(false, "long", master.Fingerprint)
+	utils.InfoPrint("Remember to publish the updated public key (e.g. to GitHub or a keyserver)\n")
+	return nil
+}
+
+// exportAndBackUpKeys exports the master key and its current subkeys from the keyring and ensures they are backed up
+func (state State) exportAndBackUpKeys(masterFingerprint string) error {
+	keys, err := state.Keyring.GetKeys(true, masterFingerprint)
+	if err != nil {
+		return fmt.Errorf("could not read updated key: %w", err)
+	}
+	if len(keys) != 1 {
+		return fmt.Errorf("could not find updated key '%s'", masterFingerprint)
+	}
+
+	logger.Debugf("exporting gpg keys to: %s\n", state.TmpDir.ExportedKeysDirPath())
+	_, err = state.runStep(
+		"Exporting gpg keys ...",
+		exportGpgKeys(state, state.passphrase, masterFingerprint, currentSubkeyFingerprints(keys[0])),
+	)
+	if err != nil {
+		return err
+	}
+	if err := state.bundleExportedKeys(state.passphrase, masterFingerprint); err != nil {
+		return err
+	}
+	return state.backUpExportedKeys(state.passphrase, masterFingerprint)
+}
+
+// selectSubkeys returns the subkeys with the given fingerprints or key ids,
+// or all subkeys that are not revoked if none are given
+func selectSubkeys(master keylist.Key, subkeyIds []string) ([]keylist.Subkey, error) {
+	subkeys := []keylist.Subkey{}
+	if len(subkeyIds) == 0 {
+		for _, subkey := range master.Subkeys {
+			if !subkey.IsRevoked() {
+				subkeys = append(subkeys, subkey)
+			}
+		}
+		return subkeys, nil
+	}
+	for _, id := range subkeyIds {
+		subkey, ok := master.FindSubkey(id)
+		if !ok {
+			return nil, fmt.Errorf("key '%s' has no subkey '%s'", master.Fingerprint, id)
+		}
+		if subkey.IsRevoked() {
+			return nil, fmt.Errorf("subkey '%s' is revoked", id)
+		}
+		subkeys = append(subkeys, subkey)
+	}
+	return subkeys, nil
+}
+
+// currentSubkeyFingerprints returns the fingerprint of the newest usable subkey for each usage
+func currentSubkeyFingerprints(master keylist.Key) map[keyalgorithm.Usage]string {
+	fingerprints := map[keyalgorithm.Usage]string{}
+	newest := map[keyalgorithm.Usage]keylist.Subkey{}
+	for _, subkey := range master.Subkeys {
+		if subkey.IsRevoked() || subkey.IsExpired() {
+			continue
+		}
+		usage, ok := subkeyUsage(subkey)
+		if !ok {
+			continue
+		}
+		if current, exists := newest[usage]; !exists || subkey.Created.After(current.Created) {
+			newest[usage] = subkey
+			fingerprints[usage] = subkey.Fingerprint
+		}
+	}
+	return fingerprints
+}
+
+// subkeyUsage maps the capabilities of an existing subkey to the usage it was generated with
+func subkeyUsage(subkey keylist.Subkey) (keyalgorithm.Usage, bool) {
+	switch {
+	case subkey.HasCapability(keylist.Encrypt):
+		return keyalgorithm.Encrypt, true
+	case subkey.HasCapability(keylist.Authenticate):
+		return keyalgorithm.Authenticate, true
+	case subkey.HasCapability(keylist.Sign):
+		return keyalgorithm.Sign, true
+	}
+	return "", false
+}
+
+func importMasterBackup(state State, backupFilePath string) tea.Cmd {
+	return func() tea.Msg {
+		if err := state.Keyring.ImportKey(state.passphrase, backupFilePath); err != nil {
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not import master key backup: %w", err))
+		}
+		return spinner.ActionCompleteSpinnerMsg("")
+	}
+}
+
+func setExpiry(state State, masterFingerprint string, expiry string, subkeyFingerprints []string) tea.Cmd {
+	return func() tea.Msg {
+		if err := state.Keyring.SetExpiry(state.passphrase, masterFingerprint, expiry, subkeyFingerprints...); err != nil {
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not set expiry: %w", err))
+		}
+		return spinner.ActionCompleteSpinnerMsg("")
+	}
+}
+
+func importPublicKeyIntoDefaultKeyring(state State) tea.Cmd {
+	return func() tea.Msg {
+		if err := state.defaultKeyring().ImportPublicKey(state.TmpDir.PublicMasterKeyFilePath()); err != nil {
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not import updated public key: %w", err))
+		}
+		return spinner.ActionCompleteSpinnerMsg("")
+	}
+}
@@ -0,0 +1,85 @@
+package state
+
+import (
+	"perfect-gpg-keypair/internal/utils"
+
+	batchspec "perfect-gpg-keypair/internal/state/batch_spec"
+	userinfo "perfect-gpg-keypair/internal/state/user_info"
+	selection "perfect-gpg-keypair/ui/selection"
+	userinput "perfect-gpg-keypair/ui/user_input"
+)
+
+// allRevocationReasons is the selection value for creating one revocation certificate per reason
+const allRevocationReasons = "all"
+
+// revocationFromSpec returns the revocation certificate(s) to create, by default one for a compromised key
+func revocationFromSpec(spec batchspec.BatchSpec) (userinfo.Revocation, error) {
+	revocation := userinfo.Revocation{
+		Reason:      userinfo.DefaultRevocationReason,
+		Description: spec.RevocationDescription,
+		AllReasons:  spec.AllRevocationReasons,
+	}
+	if spec.RevocationReason != "" {
+		reason, err := utils.ParseRevocationReason(spec.RevocationReason)
+		if err != nil {
+			return revocation, err
+		}
+		revocation.Reason = reason
+	}
+	return revocation, nil
+}
+
+// getRevocationFromInput asks the user about the revocation certificate(s) to create,
+// skipping everything that is already set in flags
+func getRevocationFromInput(flags batchspec.BatchSpec) (userinfo.Revocation, error) {
+	if flags.RevocationReason == "" && !flags.AllRevocationReasons {
+		options := []selection.Option{}
+		for _, reason := range utils.RevocationReasons {
+			options = append(options, selection.Option{Label: reason.Description(), Value: reason.String()})
+		}
+		options = append(options, selection.Option{Label: "One certificate per reason", Value: allRevocationReasons})
+		choice, err := selection.Select(
+			"Please choose the reason of the revocation certificate (to publish when the key is compromised or no longer used):",
+			options,
+			userinfo.DefaultRevocationReason.String(),
+		)
+		if err != nil {
+			return userinfo.Revocation{}, err
+		}
+		if choice == allRevocationReasons {
+			flags.AllRevocationReasons = true
+		} else {
+			flags.RevocationReason = choice
+		}
+	}
+	if flags.RevocationDescription == "" {
+		descriptionInputModel := userinput.NewRevocationDescriptionInputModel()
+		if err := userinput.GetUserInput(&descriptionInputModel); err != nil {
+			return userinfo.Revocation{}, err
+		}
+		flags.RevocationDescription = descriptionInputModel.Value()
+	}
+	return revocationFromSpec(flags)
+}
+
+// GetRevocationReason asks for the reason and an optional description of a revocation
+func GetRevocationReason() (utils.RevocationReason, string, error) {
+	options := []selection.Option{}
+	for _, reason := range utils.RevocationReasons {
+		options = append(options, selection.Option{Label: reason.Description(), Value: reason.String()})
+	}
+	choice, err := selection.Select("Please choose the reason of the revocation:", options, utils.RevocationNoReason.String())
+	if err != nil {
+		return utils.RevocationNoReason, "", err
+	}
+	reason, err := utils.ParseRevocationReason(choice)
+	if err != nil {
+		return utils.RevocationNoReason, "", err
+	}
+
+	descriptionInputModel := userinput.NewRevocationDescriptionInputModel()
+	if err := userinput.GetUserInput(&descriptionInputModel); err != nil {
+		return utils.RevocationNoReason, "", err
+	}
+	return reason, descriptionInputModel.Value(), nil
+}
@@ -0,0 +1,122 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"perfect-gpg-keypair/internal/utils"
+
+	tea "github.com/charmbracelet/bubbletea"
+	logger "github.com/sirupsen/logrus"
+
+	keylist "perfect-gpg-keypair/internal/key_list"
+	spinner "perfect-gpg-keypair/ui/spinner"
+)
+
+// RevokeMasterKey imports the revocation certificate of a master key into the default keyring
+// and exports the revoked public key to outputFilepath, ready to be published
+func (state State) RevokeMasterKey(certificateFilePath string, outputFilepath string) error {
+	logger.Debugf("importing revocation certificate '%s'\n", certificateFilePath)
+	masterFingerprint, err := state.runStep("Importing revocation certificate ...", importRevocationCertificate(state, certificateFilePath))
+	if err != nil {
+		return err
+	}
+	logger.Debugf("revoked key with fingerprint: %s\n", masterFingerprint)
+
+	_, err = state.runStep(
+		fmt.Sprintf("Exporting revoked public key to '%s' ...", outputFilepath),
+		exportRevokedPublicKey(state, masterFingerprint, outputFilepath),
+	)
+	if err != nil {
+		return err
+	}
+
+	utils.InfoPrint("\nYour revoked GPG key is:")
+	state.defaultKeyring().ListKeys(false, "long", masterFingerprint)
+	utils.InfoPrint(fmt.Sprintf("Publish '%s' (e.g. to GitHub or a keyserver) to let others know the key is revoked\n", outputFilepath))
+	return nil
+}
+
+// RevokeSubkey revokes a single subkey of the master key, backs up the updated keys
+// and refreshes the public key in the default keyring
+func (state State) RevokeSubkey(master keylist.Key, subkeyId string, reason utils.RevocationReason, description string) error {
+	subkey, ok := master.FindSubkey(subkeyId)
+	if !ok {
+		return fmt.Errorf("key '%s' has no subkey '%s'", master.Fingerprint, subkeyId)
+	}
+	if subkey.IsRevoked() {
+		return fmt.Errorf("subkey '%s' is already revoked", subkeyId)
+	}
+
+	logger.Debugf("revoking subkey %s (%s)\n", subkey.Fingerprint, reason)
+	_, err := state.runStep(
+		fmt.Sprintf("Revoking subkey %s (%s) ...", subkey.KeyID, reason.Description()),
+		revokeSubkeyCmd(state, master.Fingerprint, subkey.Fingerprint, reason, description),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := state.exportAndBackUpKeys(master.Fingerprint); err != nil {
+		return err
+	}
+
+	logger.Debugf("importing updated public key into the default keyring\n")
+	_, err = state.runStep("Updating public key in your keyring ...", importPublicKeyIntoDefaultKeyring(state))
+	if err != nil {
+		return err
+	}
+
+	utils.InfoPrint("\nYour updated GPG keypair is:")
+	state.defaultKeyring().ListKeys(false, "long", master.Fingerprint)
+	utils.InfoPrint("Remember to publish the updated public key (e.g. to GitHub or a keyserver)\n")
+	return nil
+}
+
+// certificateWithoutColon returns the path of a copy of the revocation certificate without the leading colon
+// gpg adds to the certificates in 'openpgp-revocs.d' to prevent an accidental import, or the path itself if there is none
+func (state State) certificateWithoutColon(certificateFilePath string) (string, error) {
+	contents, err := os.ReadFile(certificateFilePath)
+	if err != nil {
+		return "", err
+	}
+	guarded := []byte(":-----BEGIN PGP PUBLIC KEY BLOCK-----")
+	if !bytes.Contains(contents, guarded) {
+		return certificateFilePath, nil
+	}
+	unguardedFilePath := filepath.Join(state.TmpDir.Path(), ".revocation-certificate.asc")
+	contents = bytes.Replace(contents, guarded, guarded[1:], 1)
+	return unguardedFilePath, os.WriteFile(unguardedFilePath, contents, 0600)
+}
+
+func importRevocationCertificate(state State, certificateFilePath string) tea.Cmd {
+	return func() tea.Msg {
+		certificateFilePath, err := state.certificateWithoutColon(certificateFilePath)
+		if err != nil {
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not read revocation certificate: %w", err))
+		}
+		keyring := state.defaultKeyring()
+		masterFingerprint, err := keyring.ImportRevocationCertificate(certificateFilePath)
+		if err != nil {
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not import revocation certificate: %w", err))
+		}
+		keys, err := keyring.GetKeys(false, masterFingerprint)
+		if err != nil || len(keys) != 1 {
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not read revoked key '%s'", masterFingerprint))
+		}
+		if !keys[0].IsRevoked() {
+			return spinner.SpinnerErrMsg(fmt.Errorf("key '%s' was not revoked, is the public key in your keyring?", masterFingerprint))
+		}
+		return spinner.ActionCompleteSpinnerMsg(masterFingerprint)
+	}
+}
+
+func exportRevokedPublicKey(state State, masterFingerprint string, outputFilepath string) tea.Cmd {
+	return func() tea.Msg {
+		if err := state.defaultKeyring().ExportPublicMasterKey(masterFingerprint, outputFilepath); err != nil {
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not export revoked public key: %w", err))
+		}
+		return spinner.ActionCompleteSpinnerMsg("")
+	}
+}
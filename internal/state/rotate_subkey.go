@@ -0,0 +1,129 @@
+package state
+
+import (
+	"fmt"
+	"perfect-gpg-keypair/internal/utils"
+
+	tea "github.com/charmbracelet/bubbletea"
+	logger "github.com/sirupsen/logrus"
+
+	keylist "perfect-gpg-keypair/internal/key_list"
+	keyalgorithm "perfect-gpg-keypair/internal/state/key_algorithm"
+	userinfo "perfect-gpg-keypair/internal/state/user_info"
+	selection "perfect-gpg-keypair/ui/selection"
+	spinner "perfect-gpg-keypair/ui/spinner"
+)
+
+// SigningSubkeyAlgorithm returns the algorithm of a new signing subkey for a master key with the given algorithm
+// (as listed by gpg, e.g. 'ed25519'). By default it is the signing algorithm of the profile matching the master key,
+// an algorithm given by name must belong to the same family as the master key.
+func SigningSubkeyAlgorithm(masterAlgorithm string, name string) (keyalgorithm.KeySpec, error) {
+	masterSpec, masterErr := keyalgorithm.ParseKeySpec(masterAlgorithm, keyalgorithm.Sign)
+	if name == "" {
+		if masterErr != nil {
+			profile, _ := keyalgorithm.GetProfile(keyalgorithm.DefaultProfileName)
+			return profile.Signing, nil
+		}
+		return masterSpec, nil
+	}
+	spec, err := keyalgorithm.ParseKeySpec(name, keyalgorithm.Sign)
+	if err != nil {
+		return spec, err
+	}
+	if masterErr != nil {
+		return spec, utils.InvalidAlgorithmError(fmt.Sprintf("master key algorithm '%s' is not supported", masterAlgorithm))
+	}
+	return spec, keyalgorithm.Profile{Master: masterSpec}.ValidateSubkey(keyalgorithm.Sign, spec)
+}
+
+// ChooseSubkeyToRevoke asks which of the usable signing subkeys of the master key should be revoked, if any
+func ChooseSubkeyToRevoke(master keylist.Key) (string, error) {
+	options := []selection.Option{{Label: "none (keep all signing subkeys)", Value: ""}}
+	for _, subkey := range master.Subkeys {
+		if usage, ok := subkeyUsage(subkey); ok && usage == keyalgorithm.Sign && !subkey.IsRevoked() {
+			options = append(options, selection.Option{
+				Label: fmt.Sprintf("%s (created %s, %s)", subkey.KeyID, subkey.Created.Format("2006-01-02"), subkey.Validity),
+				Value: subkey.Fingerprint,
+			})
+		}
+	}
+	if len(options) == 1 {
+		return "", nil
+	}
+	return selection.Select("Do you want to revoke a signing subkey that is replaced by the new one?", options, "")
+}
+
+// RotateSigningSubkey adds a new signing subkey for another computer to the master key and optionally revokes an old one.
+// The updated keys are backed up and the public key in the default keyring is refreshed,
+// the new subkey itself is only exported for importing it on the other computer.
+func (state State) RotateSigningSubkey(master keylist.Key, subkey userinfo.Subkey, revokeSubkeyId string) error {
+	var revokeSubkey keylist.Subkey
+	if revokeSubkeyId != "" {
+		var ok bool
+		revokeSubkey, ok = master.FindSubkey(revokeSubkeyId)
+		if !ok {
+			return fmt.Errorf("key '%s' has no subkey '%s'", master.Fingerprint, revokeSubkeyId)
+		}
+		if revokeSubkey.IsRevoked() {
+			return fmt.Errorf("subkey '%s' is already revoked", revokeSubkeyId)
+		}
+	}
+
+	logger.Debugf("adding %s subkey\n", subkey.Usage.Description())
+	subkeyFingerprint, err := state.runStep(
+		fmt.Sprintf("Adding %s subkey (%s) for use with another computer ...", subkey.Usage.Description(), subkey.Algorithm.Name()),
+		addSubkey(state, state.passphrase, master.Fingerprint, subkey),
+	)
+	if err != nil {
+		return err
+	}
+	logger.Debugf("successfully added a %s subkey with fingerprint: %s\n", subkey.Usage.Description(), subkeyFingerprint)
+
+	if revokeSubkeyId != "" {
+		logger.Debugf("revoking subkey %s\n", revokeSubkey.Fingerprint)
+		_, err = state.runStep(
+			fmt.Sprintf("Revoking old subkey %s ...", revokeSubkey.KeyID),
+			revokeSubkeyCmd(state, master.Fingerprint, revokeSubkey.Fingerprint, utils.RevocationSuperseded, "superseded by "+subkeyFingerprint),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := state.exportAndBackUpKeys(master.Fingerprint); err != nil {
+		return err
+	}
+
+	logger.Debugf("importing updated public key into the default keyring\n")
+	_, err = state.runStep("Updating public key in your keyring ...", importPublicKeyIntoDefaultKeyring(state))
+	if err != nil {
+		return err
+	}
+
+	utils.InfoPrint("\nYour updated GPG keypair is:")
+	state.defaultKeyring().ListKeys(false, "long", master.Fingerprint)
+	utils.InfoPrint(fmt.Sprintf(
+		"Import '%s' of the backup on the new computer with 'gpg --import' to use the subkey '%s' there.\n"+
+			"Remember to publish the updated public key (e.g. to GitHub or a keyserver)\n",
+		state.TmpDir.SigningSubkeyFileName, subkeyFingerprint,
+	))
+	return nil
+}
+
+func revokeSubkeyCmd(state State, masterFingerprint string, subkeyFingerprint string, reason utils.RevocationReason, description string) tea.Cmd {
+	return func() tea.Msg {
+		err := state.Keyring.RevokeSubkey(state.TmpDir.Path(), state.passphrase, masterFingerprint, subkeyFingerprint, reason, description)
+		if err != nil {
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not revoke subkey: %w", err))
+		}
+		// gpg --edit-key does not fail if a command could not be carried out
+		keys, err := state.Keyring.GetKeys(false, masterFingerprint)
+		if err != nil || len(keys) != 1 {
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not read revoked subkey"))
+		}
+		if revoked, ok := keys[0].FindSubkey(subkeyFingerprint); !ok || !revoked.IsRevoked() {
+			return spinner.SpinnerErrMsg(fmt.Errorf("subkey '%s' was not revoked (is the passphrase correct?)", subkeyFingerprint))
+		}
+		return spinner.ActionCompleteSpinnerMsg("")
+	}
+}
@@ -0,0 +1,42 @@
+package state
+
+import (
+	"errors"
+	"testing"
+
+	"perfect-gpg-keypair/internal/utils"
+)
+
+func TestSigningSubkeyAlgorithm(t *testing.T) {
+	tests := []struct {
+		name            string
+		masterAlgorithm string
+		algorithm       string
+		want            string
+		wantErr         bool
+	}{
+		{name: "default for ed25519", masterAlgorithm: "ed25519", want: "ed25519"},
+		{name: "default for rsa3072", masterAlgorithm: "rsa3072", want: "rsa3072"},
+		{name: "default for an unknown master key", masterAlgorithm: "dsa2048", want: "rsa4096"},
+		{name: "same family", masterAlgorithm: "rsa4096", algorithm: "rsa3072", want: "rsa3072"},
+		{name: "rsa under ed25519", masterAlgorithm: "ed25519", algorithm: "rsa4096", wantErr: true},
+		{name: "nistp384 under rsa", masterAlgorithm: "rsa4096", algorithm: "nistp384", wantErr: true},
+		{name: "encryption curve", masterAlgorithm: "ed25519", algorithm: "cv25519", wantErr: true},
+		{name: "unknown master key", masterAlgorithm: "dsa2048", algorithm: "rsa4096", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := SigningSubkeyAlgorithm(tt.masterAlgorithm, tt.algorithm)
+			if tt.wantErr {
+				var validation *utils.ValidationError
+				if !errors.As(err, &validation) {
+					t.Fatalf("SigningSubkeyAlgorithm() returned %v, want a ValidationError", err)
+				}
+				return
+			}
+			if err != nil || spec.Name() != tt.want {
+				t.Errorf("SigningSubkeyAlgorithm() = %s, %v, want %s", spec.Name(), err, tt.want)
+			}
+		})
+	}
+}
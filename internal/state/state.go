@@ -3,14 +3,24 @@ package state
 import (
 	"errors"
 	"fmt"
+	"os"
 	"perfect-gpg-keypair/internal/utils"
+	"sort"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	logger "github.com/sirupsen/logrus"
 
+	paperbackup "perfect-gpg-keypair/internal/paper_backup"
+	qrbackup "perfect-gpg-keypair/internal/qr_backup"
+	runrecord "perfect-gpg-keypair/internal/run_record"
+	shamir "perfect-gpg-keypair/internal/shamir"
+	batchspec "perfect-gpg-keypair/internal/state/batch_spec"
+	keyalgorithm "perfect-gpg-keypair/internal/state/key_algorithm"
 	userinfo "perfect-gpg-keypair/internal/state/user_info"
 	tmpdir "perfect-gpg-keypair/internal/tmp_dir"
 	confirm "perfect-gpg-keypair/ui/confirm"
+	selection "perfect-gpg-keypair/ui/selection"
 	spinner "perfect-gpg-keypair/ui/spinner"
 	userinput "perfect-gpg-keypair/ui/user_input"
 )
@@ -18,31 +28,124 @@ import (
 type State struct {
 	TmpDir   tmpdir.TmpDir
 	UserInfo userinfo.UserInfo
+	// Keyring is the keyring the keys are generated in
+	Keyring utils.Keyring
+	// Isolated generates the keys in a throwaway keyring inside TmpDir
+	Isolated bool
+	// Batch disables all user interaction
+	Batch bool
+	// OutputDir is the directory the exported keys are saved to, asked for interactively if empty
+	OutputDir string
+	// PaperBackup additionally exports the master secret as a printable paper backup
+	PaperBackup bool
+	// QRBackup additionally exports the master secret and the revocation certificates as QR codes
+	QRBackup qrbackup.Options
+	// Shamir additionally splits the master secret or its passphrase into shares
+	Shamir shamir.Options
+	// ShamirDir is the directory the shares are saved to, apart from OutputDir. Asked for interactively if empty.
+	ShamirDir string
+	// Bundle additionally packs the exported keys into a single archive, encrypted with a separate passphrase
+	Bundle bool
+	// Progress records how far the run got, so that an aborted run can be finished or rolled back. Nil if not recorded.
+	Progress         *runrecord.Record
+	passphrase       string
+	bundlePassphrase string
 }
 
-func NewState(debug bool) State {
+// NewState creates the state of a run that uses the default keyring, running gpg with runner
+func NewState(debug bool, runner utils.GpgRunner) State {
 	return State{
-		TmpDir: tmpdir.NewTmpDir(debug),
+		TmpDir:  tmpdir.NewTmpDir(debug),
+		Keyring: utils.Keyring{Runner: runner},
 	}
 }
 
-func (state *State) SetUserInfoFromInput() error {
+// defaultKeyring returns the default keyring of the user, which is run by the same runner as the keyring of the state
+func (state State) defaultKeyring() utils.Keyring {
+	return state.Keyring.WithHomeDir("")
+}
+
+// SetOutputOptions sets how the keys are exported. An empty output directory is asked for later on.
+func (state *State) SetOutputOptions(spec batchspec.BatchSpec) error {
+	if spec.OutputDir != "" {
+		if err := utils.ValidateOutputDir(spec.OutputDir); err != nil {
+			return err
+		}
+	}
+	qrBackup, err := spec.QROptions()
+	if err != nil {
+		return err
+	}
+	shamirOptions, err := spec.ShamirOptions()
+	if err != nil {
+		return err
+	}
+	if spec.ShamirDir != "" {
+		if err := utils.ValidateShamirDir(spec.ShamirDir, spec.OutputDir); err != nil {
+			return err
+		}
+	}
+	state.OutputDir = spec.OutputDir
+	state.PaperBackup = spec.PaperBackup
+	state.QRBackup = qrBackup
+	state.Shamir = shamirOptions
+	state.ShamirDir = spec.ShamirDir
+	state.Bundle = spec.Bundle
+	return nil
+}
+
+// CreateIsolatedKeyring creates a throwaway GNUPGHOME (with its own gpg-agent) in the temporary directory
+// and uses it for generating the keys, so the master key never touches the default keyring
+func (state *State) CreateIsolatedKeyring() error {
+	if err := state.TmpDir.CreateGnupgHome(); err != nil {
+		return err
+	}
+	state.Keyring = state.Keyring.WithHomeDir(state.TmpDir.GnupgHomePath())
+	return nil
+}
+
+// StopIsolatedKeyring stops the gpg-agent of the throwaway keyring, if any
+func (state State) StopIsolatedKeyring() {
+	if state.Keyring.IsDefault() {
+		return
+	}
+	logger.Debugln("stopping gpg-agent of temporary keyring")
+	if err := state.Keyring.KillAgent(); err != nil {
+		logger.Debugf("could not stop gpg-agent of temporary keyring: %s\n", err.Error())
+	}
+}
+
+// SetUserInfoFromInput asks the user for their information.
+// Algorithms and subkey options that are already set in flags are not asked for.
+func (state *State) SetUserInfoFromInput(flags batchspec.BatchSpec) error {
 	for {
 		userInfoInputModel := userinput.NewUserInfoInputModel()
 		if err := userInfoInputModel.GetInput(); err != nil {
 			return err
 		}
+		algorithm, err := getAlgorithmProfile(flags.Algorithm, state.Keyring.Capabilities)
+		if err != nil {
+			return err
+		}
 		userInfo := userinfo.UserInfo{
-			FullName: userInfoInputModel.Name.Value(),
-			Email:    userInfoInputModel.Email.Value(),
-			Expiry:   userInfoInputModel.Expiry.Value(),
+			FullName:  userInfoInputModel.Name.Value(),
+			Email:     userInfoInputModel.Email.Value(),
+			Expiry:    userInfoInputModel.Expiry.Value(),
+			Algorithm: algorithm,
+		}
+		userInfo.Subkeys, err = getSubkeysFromInput(userInfo, flags)
+		if err != nil {
+			return err
+		}
+		userInfo.Revocation, err = getRevocationFromInput(flags)
+		if err != nil {
+			return err
 		}
 
 		utils.InfoPrint("You have entered:")
 		utils.PrintHiddenBorder(userInfo.String())
 
 		confirmed, err := confirm.Confirm("Is the entered information correct?")
-		// TODO: Handle ctrl+c inside here? Causes panic
 		if err != nil {
 			return err
 		}
@@ -54,145 +157,355 @@ func (state *State) SetUserInfoFromInput() error {
 	return nil
 }
 
-func (state State) GenerateKeys() error {
-	utils.InfoPrint("The master keypair will be protected by a passphrase")
-	utils.WarningPrint("Ensure that you keep this passphrase in a safe space (e.g. a key vault)!")
-	passphrase, err := GetPassphrase()
+// getAlgorithmProfile returns the profile with the given name, or asks for one of the profiles gpg supports if empty
+func getAlgorithmProfile(algorithmName string, capabilities *utils.GpgCapabilities) (keyalgorithm.Profile, error) {
+	if algorithmName == "" {
+		supported := keyalgorithm.SupportedProfiles(capabilities)
+		if len(supported) == 0 {
+			return keyalgorithm.Profile{}, &utils.GpgUnsupportedError{Feature: "any of the key algorithms", Reason: "upgrade gpg"}
+		}
+		options := []selection.Option{}
+		defaultName := supported[0].Name
+		for _, profile := range supported {
+			options = append(options, selection.Option{Label: profile.String(), Value: profile.Name})
+			if profile.Name == keyalgorithm.DefaultProfileName {
+				defaultName = profile.Name
+			}
+		}
+		choice, err := selection.Select("Please choose the key algorithm:", options, defaultName)
+		if err != nil {
+			return keyalgorithm.Profile{}, err
+		}
+		algorithmName = choice
+	}
+	profile, err := keyalgorithm.GetProfile(algorithmName)
 	if err != nil {
-		return err
+		return profile, err
 	}
+	if capabilities != nil && !profile.SupportedBy(*capabilities) {
+		return profile, unsupportedAlgorithmError(profile.Name, *capabilities)
+	}
+	return profile, nil
+}
 
-	// Generate master keypair
-	logger.Debugf("generating master keypair\n")
-	generateMasterKeypairSpinner := spinner.NewSpinnerModel(
-		"Generating an RSA keypair with 4096 bit size ...",
-		generateMasterKeypair(state, passphrase),
-	)
-	err = spinner.Spinner(&generateMasterKeypairSpinner)
+// SetFromBatchSpec sets up the state for a run without any user interaction
+func (state *State) SetFromBatchSpec(spec batchspec.BatchSpec) error {
+	if spec.Expiry == "" {
+		spec.Expiry = userinfo.DefaultExpiry
+	}
+	if err := spec.Validate(); err != nil {
+		return err
+	}
+	algorithmName := spec.Algorithm
+	if algorithmName == "" {
+		algorithmName = keyalgorithm.DefaultProfileName
+	}
+	algorithm, err := keyalgorithm.GetProfile(algorithmName)
 	if err != nil {
 		return err
 	}
-	masterFingerprint := generateMasterKeypairSpinner.ActionOutput()
-	logger.Debugf("successfully generated master keypair with fingerprint: %s\n", masterFingerprint)
-
-	// Add signing subkey:
-	logger.Debugf("adding additional signing subkey for use with this computer\n")
-	addSigningSubkeySpinner := spinner.NewSpinnerModel(
-		"Adding additional signing subkey for use with this computer ...",
-		addSigningSubkey(state, passphrase, masterFingerprint),
-	)
-	err = spinner.Spinner(&addSigningSubkeySpinner)
+	passphrase, err := spec.ReadPassphrase()
 	if err != nil {
 		return err
 	}
-	logger.Debugf("successfully added a signing subkey\n")
-
-	// Create revocation certificate
-	logger.Debugf("creating revocation certificate at: '%s'\n", state.TmpDir.RevocationCertFilePath())
-	createRevCertSpinner := spinner.NewSpinnerModel(
-		"Creating revocation certificate ...",
-		createRevocationCertificate(state, passphrase, masterFingerprint),
-	)
-	err = spinner.Spinner(&createRevCertSpinner)
+	qrBackup, err := spec.QROptions()
+	if err != nil {
+		return err
+	}
+	shamirOptions, err := spec.ShamirOptions()
+	if err != nil {
+		return err
+	}
+	if err := state.setBundleFromBatchSpec(spec, passphrase); err != nil {
+		return err
+	}
+	state.Batch = true
+	state.OutputDir = spec.OutputDir
+	state.PaperBackup = spec.PaperBackup
+	state.QRBackup = qrBackup
+	state.Shamir = shamirOptions
+	state.ShamirDir = spec.ShamirDir
+	state.passphrase = passphrase
+	state.UserInfo = userinfo.UserInfo{
+		FullName:  spec.Name,
+		Email:     spec.Email,
+		Expiry:    spec.Expiry,
+		Algorithm: algorithm,
+	}
+	state.UserInfo.Subkeys, err = subkeysFromSpec(state.UserInfo, spec)
 	if err != nil {
 		return err
 	}
-	logger.Debugf("exported revocation certificate to: %s\n", state.TmpDir.RevocationCertFilePath())
+	state.UserInfo.Revocation, err = revocationFromSpec(spec)
+	return err
+}
 
-	// export gpg keys to temporary files
-	logger.Debugf("exporting gpg keys to: %s\n", state.TmpDir.ExportedKeysDirPath())
-	exportKeysSpinner := spinner.NewSpinnerModel(
-		"Exporting gpg keys ...",
-		exportGpgKeys(state, passphrase, masterFingerprint),
-	)
-	err = spinner.Spinner(&exportKeysSpinner)
+// GenerateKeys runs all steps of generate, recording each completed one in the journal in the temporary directory
+func (state State) GenerateKeys() error {
+	if !state.Batch {
+		utils.InfoPrint("The master keypair will be protected by a passphrase")
+		utils.WarningPrint("Ensure that you keep this passphrase in a safe space (e.g. a key vault)!")
+		passphrase, err := GetPassphrase()
+		if err != nil {
+			return err
+		}
+		state.passphrase = passphrase
+	}
+	journal, err := state.TmpDir.NewJournal(state.UserInfo, state.journalOutput(), state.Isolated)
+	if err != nil {
+		return fmt.Errorf("could not write journal: %w", err)
+	}
+	return state.runWorkflow(&journal)
+}
+
+// recordProgress advances the record of the run, if it is recorded
+func (state State) recordProgress(stage runrecord.Stage, masterFingerprint string) {
+	if state.Progress == nil {
+		return
+	}
+	state.Progress.Stage = stage
+	state.Progress.Fingerprint = masterFingerprint
+	if err := state.Progress.Save(); err != nil {
+		logger.Debugf("could not record progress of the run: %s\n", err)
+	}
+}
+
+// runStep runs the action behind a spinner, or without one in batch mode
+func (state State) runStep(title string, action tea.Cmd) (string, error) {
+	stepSpinner := spinner.NewSpinnerModel(title, action)
+	var err error
+	if state.Batch {
+		err = spinner.RunWithoutTty(&stepSpinner)
+	} else {
+		err = spinner.Spinner(&stepSpinner)
+	}
+	return stepSpinner.ActionOutput(), err
+}
+
+// backUpExportedKeys ensures the exported keys are backed up, followed by the shares (if any)
+func (state State) backUpExportedKeys(passphrase string, masterFingerprint string) error {
+	backupDir, err := state.backUpExportedKeyFiles(passphrase, masterFingerprint)
 	if err != nil {
 		return err
 	}
-	logger.Debugf(fmt.Sprintf("files exported to: %s\n", state.TmpDir.ExportedKeysDirPath()))
+	return state.backUpShares(backupDir)
+}
+
+// backUpExportedKeyFiles saves the exported keys to the output directory, which is asked for if not set, and verifies the copies.
+// Without an output directory the user backs up the keys from the temporary directory and points to the backup to verify it,
+// or confirms the backup manually. It returns the directory of the backup, or an empty one if it was confirmed manually.
+func (state State) backUpExportedKeyFiles(passphrase string, masterFingerprint string) (string, error) {
+	outputDir := state.OutputDir
+	if outputDir == "" && !state.Batch {
+		outputDirInputModel := userinput.NewOutputDirInputModel()
+		if err := userinput.GetUserInput(&outputDirInputModel); err != nil {
+			return "", err
+		}
+		outputDir = outputDirInputModel.Value()
+	}
+	if outputDir != "" {
+		outputDir = utils.ExpandHome(outputDir)
+		existing, err := state.TmpDir.ExistingCopies(outputDir)
+		if err != nil {
+			return "", err
+		}
+		overwrite, err := state.confirmOverwrite(outputDir, existing)
+		if err != nil {
+			return "", err
+		}
+		logger.Debugf("saving exported keys to output directory: %s\n", outputDir)
+		_, err = state.runStep(
+			fmt.Sprintf("Saving exported keys to '%s' ...", outputDir),
+			saveExportedKeys(state, outputDir, masterFingerprint, overwrite),
+		)
+		if err != nil {
+			return "", err
+		}
+		_, err = state.runStep(
+			fmt.Sprintf("Verifying backup in '%s' ...", outputDir),
+			verifyBackup(state, outputDir, passphrase, masterFingerprint),
+		)
+		if err != nil {
+			return "", &utils.BackupNotConfirmedError{Backup: outputDir, Err: err}
+		}
+		utils.InfoPrint(fmt.Sprintf("Files saved to: %s (see %s for their checksums)", outputDir, tmpdir.ManifestFileName))
+		if !state.Batch {
+			utils.WarningPrint("Ensure that these files are kept in a safe place (e.g. an encrypted USB stick or a key vault)!")
+		}
+		return outputDir, nil
+	}
 
-	// confirm keys are backed up
 	utils.InfoPrint(fmt.Sprintf("Files exported to: %s", state.TmpDir.ExportedKeysDirPath()))
-	utils.WarningPrint("Ensure that these files are backed up (e.g. in a key vault)!\nThey will automatically be deleted after confirming they are backed up.")
+	utils.WarningPrint("Ensure that these files are backed up (e.g. in a key vault)!\nThey will automatically be deleted after the backup is verified.")
 	for {
-		backedUp, err := confirm.Confirm("Have you backed up the files?")
-		if err != nil {
-			return err
+		backupLocationInputModel := userinput.NewBackupLocationInputModel()
+		if err := userinput.GetUserInput(&backupLocationInputModel); err != nil {
+			return "", err
 		}
-		if backedUp {
-			break
+		backupDir := backupLocationInputModel.Value()
+		if backupDir == "" {
+			backedUp, err := confirm.Confirm("Have you backed up the files?")
+			if err != nil {
+				return "", err
+			}
+			if backedUp {
+				return "", nil
+			}
+			continue
 		}
+		backupDir = utils.ExpandHome(backupDir)
+		logger.Debugf("verifying backup in: %s\n", backupDir)
+		_, err := state.runStep(
+			fmt.Sprintf("Verifying backup in '%s' ...", backupDir),
+			verifyBackup(state, backupDir, passphrase, masterFingerprint),
+		)
+		if err == nil {
+			utils.InfoPrint(fmt.Sprintf("Backup in '%s' verified", backupDir))
+			return backupDir, nil
+		}
+		var interrupt *utils.UserInterrupt
+		if errors.As(err, &interrupt) {
+			return "", err
+		}
+		utils.ErrorPrint(fmt.Sprintf("%s\nPlease fix the backup and try again.", err))
 	}
+}
 
-	// reimport and use only secret key on this laptop:
-	logger.Debugf("removing master keys and reimporting signing subkey\n")
-	reimportKeySpinner := spinner.NewSpinnerModel(
-		"Removing master keypair and reimport signing subkey ...",
-		removeMasterAndImportSubkey(state, passphrase, masterFingerprint),
-	)
-	err = spinner.Spinner(&reimportKeySpinner)
+// backUpShares saves the shares to the shares directory, which is asked for if not set and must be apart from the backup directory
+func (state State) backUpShares(backupDir string) error {
+	if !state.Shamir.Enabled() {
+		return nil
+	}
+	shamirDir := state.ShamirDir
+	if shamirDir == "" && !state.Batch {
+		shamirDirInputModel := userinput.NewShamirDirInputModel(backupDir)
+		if err := userinput.GetUserInput(&shamirDirInputModel); err != nil {
+			return err
+		}
+		shamirDir = shamirDirInputModel.Value()
+	}
+	if err := utils.ValidateShamirDir(shamirDir, backupDir); err != nil {
+		return err
+	}
+	shamirDir = utils.ExpandHome(shamirDir)
+	existing, err := state.TmpDir.ExistingShares(shamirDir)
 	if err != nil {
 		return err
 	}
-	logger.Debugf("successfully added a signing subkey\n")
-
-	utils.InfoPrint("\nYour generated GPG keypair is:")
-	utils.ListKeys(true, "long", masterFingerprint)
-	utils.InfoPrint(fmt.Sprintf("Ensure that the key with SC attributes and the fingerprint '%s' is prepended by 'sec#'\n", masterFingerprint))
+	overwrite, err := state.confirmOverwrite(shamirDir, existing)
+	if err != nil {
+		return err
+	}
+	logger.Debugf("saving shares to: %s\n", shamirDir)
+	_, err = state.runStep(fmt.Sprintf("Saving shares to '%s' ...", shamirDir), saveShares(state, shamirDir, overwrite))
+	if err != nil {
+		return err
+	}
+	utils.InfoPrint(fmt.Sprintf("Shares saved to: %s (one directory per share)", shamirDir))
+	if !state.Batch {
+		utils.WarningPrint("Hand out each share to a different person or place and never keep them together with the backup!")
+	}
 	return nil
 }
 
+// confirmOverwrite asks whether the existing files in the directory, e.g. of an earlier backup, are to be overwritten.
+// It fails in batch mode or if the user declines, so that an existing backup is never overwritten silently.
+func (state State) confirmOverwrite(dir string, existing []string) (bool, error) {
+	if len(existing) == 0 {
+		return false, nil
+	}
+	if state.Batch {
+		return false, utils.InvalidOutputDirError(fmt.Sprintf(
+			"'%s' already holds %s, move them away or choose another directory", dir, strings.Join(existing, ", "),
+		))
+	}
+	utils.WarningPrint(fmt.Sprintf("'%s' already holds %s", dir, strings.Join(existing, ", ")))
+	overwrite, err := confirm.Confirm("Do you want to overwrite them?")
+	if err != nil {
+		return false, err
+	}
+	if !overwrite {
+		return false, utils.InvalidOutputDirError(fmt.Sprintf("'%s' already holds files that are not to be overwritten", dir))
+	}
+	return true, nil
+}
+
 func generateMasterKeypair(state State, passphrase string) tea.Cmd {
 	return func() tea.Msg {
-		err := utils.GenerateMasterKeypair(passphrase, state.TmpDir.StatusFilePath(), state.TmpDir.ParametersFilePath())
+		masterFingerprint, err := state.Keyring.GenerateMasterKeypair(passphrase, state.TmpDir.ParametersFilePath())
 		if err != nil {
 			return spinner.SpinnerErrMsg(fmt.Errorf("could not generate master keypair: %w", err))
 		}
-
-		masterFingerprint, err := state.TmpDir.ReadStatusFileKeyId()
-		if err != nil {
-			return spinner.SpinnerErrMsg(fmt.Errorf("could not read id from status file: %w", err))
-		}
 		return spinner.ActionCompleteSpinnerMsg(masterFingerprint)
 	}
 }
 
-func addSigningSubkey(state State, passphrase string, masterFingerprint string) tea.Cmd {
+func addSubkey(state State, passphrase string, masterFingerprint string, subkey userinfo.Subkey) tea.Cmd {
 	return func() tea.Msg {
-		err := utils.AddSigningSubKey(passphrase, masterFingerprint, state.UserInfo.Expiry)
+		subkeyFingerprint, err := state.Keyring.AddSubKey(
+			passphrase, masterFingerprint, subkey.Algorithm.Name(), string(subkey.Usage), subkey.Expiry,
+		)
 		if err != nil {
-			return spinner.SpinnerErrMsg(fmt.Errorf("could not add signing subkey: %w", err))
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not add %s subkey: %w", subkey.Usage.Description(), err))
 		}
-		return spinner.ActionCompleteSpinnerMsg("")
+		return spinner.ActionCompleteSpinnerMsg(subkeyFingerprint)
 	}
 }
 
-func createRevocationCertificate(state State, passphrase string, masterFingerprint string) tea.Cmd {
+func createRevocationCertificate(
+	state State, passphrase string, masterFingerprint string, reason utils.RevocationReason, outputFilepath string,
+) tea.Cmd {
 	return func() tea.Msg {
-		err := utils.CreateRevocationCertificate(state.TmpDir.Path(), passphrase, state.TmpDir.RevocationCertFilePath(), masterFingerprint)
+		err := state.Keyring.CreateRevocationCertificate(
+			state.TmpDir.Path(), passphrase, outputFilepath, masterFingerprint, reason, state.UserInfo.Revocation.Description,
+		)
 		if err != nil {
-			return spinner.SpinnerErrMsg(fmt.Errorf("could not generate revocation certificate: %s\n", err.Error()))
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not generate revocation certificate: %w", err))
 		}
 		return spinner.ActionCompleteSpinnerMsg("")
 	}
 }
 
-func exportGpgKeys(state State, passphrase string, masterFingerprint string) tea.Cmd {
+func exportGpgKeys(state State, passphrase string, masterFingerprint string, subkeyFingerprints map[keyalgorithm.Usage]string) tea.Cmd {
 	privateMasterKeyFilePath := state.TmpDir.PrivateMasterKeyFilePath()
 	publicMasterKeyFilePath := state.TmpDir.PublicMasterKeyFilePath()
-	signingSubkeyFilePath := state.TmpDir.SigningSubkeyFilePath()
 	return func() tea.Msg {
-		privateKeyExportError := utils.ExportPrivateMasterKey(passphrase, masterFingerprint, privateMasterKeyFilePath)
+		privateKeyExportError := state.Keyring.ExportPrivateMasterKey(passphrase, masterFingerprint, privateMasterKeyFilePath)
 		if privateKeyExportError != nil {
 			logger.Debugln(fmt.Sprintf("could not export private master key: %s\n", privateKeyExportError.Error()))
+		} else if state.PaperBackup {
+			privateKeyExportError = paperbackup.Create(
+				privateMasterKeyFilePath, state.TmpDir.PaperBackupTextFilePath(), state.TmpDir.PaperBackupHTMLFilePath(),
+			)
+			if privateKeyExportError != nil {
+				logger.Debugln(fmt.Sprintf("could not create paper backup: %s\n", privateKeyExportError.Error()))
+			}
+		}
+		if privateKeyExportError == nil && state.QRBackup.Enabled() {
+			_, privateKeyExportError = qrbackup.Create(
+				state.QRBackup, privateMasterKeyFilePath, existingRevocationCertFilePaths(state), state.TmpDir.ExportedKeysDirPath(),
+			)
+			if privateKeyExportError != nil {
+				logger.Debugln(fmt.Sprintf("could not create QR backup: %s\n", privateKeyExportError.Error()))
+			}
 		}
-		publicKeyExportError := utils.ExportPublicMasterKey(masterFingerprint, publicMasterKeyFilePath)
+		if privateKeyExportError == nil && state.Shamir.Enabled() {
+			privateKeyExportError = createShareFiles(state, passphrase, masterFingerprint)
+			if privateKeyExportError != nil {
+				logger.Debugln(fmt.Sprintf("could not split into shares: %s\n", privateKeyExportError.Error()))
+			}
+		}
+		publicKeyExportError := state.Keyring.ExportPublicMasterKey(masterFingerprint, publicMasterKeyFilePath)
 		if publicKeyExportError != nil {
 			logger.Debugln(fmt.Sprintf("could not export public master key: %s\n", publicKeyExportError.Error()))
 		}
-		subkeyExportError := utils.ExportSigningSubkey(passphrase, masterFingerprint, signingSubkeyFilePath)
-		if subkeyExportError != nil {
-			logger.Debugln(fmt.Sprintf("could not export signing subkey: %s\n", privateKeyExportError.Error()))
+		var subkeyExportError error
+		for usage, subkeyFingerprint := range subkeyFingerprints {
+			err := state.Keyring.ExportSubkey(passphrase, subkeyFingerprint, state.TmpDir.SubkeyFilePath(usage))
+			if err != nil {
+				logger.Debugln(fmt.Sprintf("could not export %s subkey: %s\n", usage.Description(), err.Error()))
+				subkeyExportError = err
+			}
 		}
 		if privateKeyExportError != nil || publicKeyExportError != nil || subkeyExportError != nil {
 			return spinner.SpinnerErrMsg(errors.New("could not export all GPG keys. This must be done manually"))
@@ -202,17 +515,87 @@ func exportGpgKeys(state State, passphrase string, masterFingerprint string) tea
 	}
 }
 
-func removeMasterAndImportSubkey(state State, passphrase string, masterFingerprint string) tea.Cmd {
+// createShareFiles splits the exported master secret or the passphrase into share files, apart from the exported keys
+func createShareFiles(state State, passphrase string, masterFingerprint string) error {
+	secret := []byte(passphrase)
+	if state.Shamir.Secret == shamir.PrivateMaster {
+		var err error
+		if secret, err = os.ReadFile(state.TmpDir.PrivateMasterKeyFilePath()); err != nil {
+			return err
+		}
+	}
+	_, err := shamir.CreateShareFiles(state.Shamir, secret, masterFingerprint, state.TmpDir.SharesDirPath())
+	return err
+}
+
+// existingRevocationCertFilePaths returns the paths of the revocation certificates that have been created in the temporary directory
+func existingRevocationCertFilePaths(state State) []string {
+	paths := []string{}
+	for _, path := range state.TmpDir.RevocationCertFilePaths(state.UserInfo.Revocation) {
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func importSubkeyIntoDefaultKeyring(state State, passphrase string, masterFingerprint string) tea.Cmd {
 	return func() tea.Msg {
-		err := utils.DeleteSecretKeys(passphrase, masterFingerprint)
+		defaultKeyring := state.defaultKeyring()
+		if err := importSubkeys(state, defaultKeyring, passphrase); err != nil {
+			return spinner.SpinnerErrMsg(err)
+		}
+
+		err := defaultKeyring.SetUltimateOwnerTrust(state.TmpDir.Path(), masterFingerprint)
 		if err != nil {
-			return spinner.SpinnerErrMsg(fmt.Errorf("could not delete master key: %w", err))
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not set owner trust of imported key: %w", err))
 		}
+		return spinner.ActionCompleteSpinnerMsg("")
+	}
+}
 
-		err = utils.ImportKey(passphrase, state.TmpDir.SigningSubkeyFilePath())
+// saveExportedKeys copies the exported keys to the output directory along with a manifest of their checksums
+func saveExportedKeys(state State, outputDir string, masterFingerprint string, overwrite bool) tea.Cmd {
+	return func() tea.Msg {
+		if err := utils.ValidateOutputDir(outputDir); err != nil {
+			return spinner.SpinnerErrMsg(err)
+		}
+		copies, err := state.TmpDir.CopyExportedKeys(outputDir, overwrite)
+		if err != nil {
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not copy exported keys to output directory: %w", err))
+		}
+		keys, err := state.Keyring.GetKeys(false, masterFingerprint)
+		if err != nil || len(keys) != 1 {
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not read key '%s' for the manifest", masterFingerprint))
+		}
+		manifest, err := tmpdir.NewManifest(keys[0], copies)
 		if err != nil {
-			return spinner.SpinnerErrMsg(fmt.Errorf("could not import signing subkey: %w", err))
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not create manifest: %w", err))
+		}
+		if err := manifest.Write(outputDir); err != nil {
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not write manifest: %w", err))
 		}
 		return spinner.ActionCompleteSpinnerMsg("")
 	}
 }
+
+// saveShares copies the directory of each share to the shares directory
+func saveShares(state State, shamirDir string, overwrite bool) tea.Cmd {
+	return func() tea.Msg {
+		if _, err := state.TmpDir.CopyShares(shamirDir, overwrite); err != nil {
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not copy shares to '%s': %w", shamirDir, err))
+		}
+		return spinner.ActionCompleteSpinnerMsg("")
+	}
+}
+
+func importSubkeys(state State, keyring utils.Keyring, passphrase string) error {
+	for _, subkey := range state.UserInfo.Subkeys {
+		err := keyring.ImportKey(passphrase, state.TmpDir.SubkeyFilePath(subkey.Usage))
+		if err != nil {
+			return fmt.Errorf("could not import %s subkey: %w", subkey.Usage.Description(), err)
+		}
+	}
+	return nil
+}
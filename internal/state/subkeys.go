@@ -0,0 +1,92 @@
+package state
+
+import (
+	"fmt"
+
+	batchspec "perfect-gpg-keypair/internal/state/batch_spec"
+	keyalgorithm "perfect-gpg-keypair/internal/state/key_algorithm"
+	userinfo "perfect-gpg-keypair/internal/state/user_info"
+	utils "perfect-gpg-keypair/internal/utils"
+	confirm "perfect-gpg-keypair/ui/confirm"
+	selection "perfect-gpg-keypair/ui/selection"
+	userinput "perfect-gpg-keypair/ui/user_input"
+)
+
+// subkeysFromSpec returns the subkeys to generate. Unless they are set in the spec,
+// algorithms are taken from the algorithm profile and expiries from the master key.
+func subkeysFromSpec(userInfo userinfo.UserInfo, spec batchspec.BatchSpec) ([]userinfo.Subkey, error) {
+	subkeys := []userinfo.Subkey{}
+	for _, usage := range spec.SubkeyUsages() {
+		algorithmName, expiry := spec.Subkey(usage)
+		subkey := userinfo.Subkey{
+			Usage:     usage,
+			Algorithm: userInfo.Algorithm.Subkey(usage),
+			Expiry:    userInfo.Expiry,
+		}
+		if *algorithmName != "" {
+			algorithm, err := keyalgorithm.ParseKeySpec(*algorithmName, usage)
+			if err != nil {
+				return nil, err
+			}
+			if err := userInfo.Algorithm.ValidateSubkey(usage, algorithm); err != nil {
+				return nil, err
+			}
+			subkey.Algorithm = algorithm
+		}
+		if *expiry != "" {
+			if err := utils.ValidateExpiry(*expiry); err != nil {
+				return nil, fmt.Errorf("%s subkey: %w", usage.Description(), err)
+			}
+			subkey.Expiry = *expiry
+		}
+		subkeys = append(subkeys, subkey)
+	}
+	return subkeys, nil
+}
+
+// getSubkeysFromInput asks the user about the subkeys to generate,
+// skipping everything that is already set in flags
+func getSubkeysFromInput(userInfo userinfo.UserInfo, flags batchspec.BatchSpec) ([]userinfo.Subkey, error) {
+	if !flags.AuthenticationSubkey {
+		addAuthenticationSubkey, err := confirm.Confirm("Do you want an additional authentication subkey (e.g. for SSH)?")
+		if err != nil {
+			return nil, err
+		}
+		flags.AuthenticationSubkey = addAuthenticationSubkey
+	}
+
+	customise, err := confirm.Confirm(fmt.Sprintf(
+		"Do you want to choose the algorithm and expiry of each subkey? (default: %s, expires %s)",
+		userInfo.Algorithm.Name, userInfo.Expiry,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if customise {
+		for _, usage := range flags.SubkeyUsages() {
+			algorithmName, expiry := flags.Subkey(usage)
+			if *algorithmName == "" {
+				options := []selection.Option{}
+				for _, name := range userInfo.Algorithm.SubkeyAlgorithmNames(usage) {
+					options = append(options, selection.Option{Label: name, Value: name})
+				}
+				*algorithmName, err = selection.Select(
+					fmt.Sprintf("Please choose the algorithm of the %s subkey:", usage.Description()),
+					options,
+					userInfo.Algorithm.Subkey(usage).Name(),
+				)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if *expiry == "" {
+				expiryInputModel := userinput.NewSubkeyExpiryInputModel(usage.Description(), userInfo.Expiry)
+				if err := userinput.GetUserInput(&expiryInputModel); err != nil {
+					return nil, err
+				}
+				*expiry = expiryInputModel.Value()
+			}
+		}
+	}
+	return subkeysFromSpec(userInfo, flags)
+}
@@ -0,0 +1,59 @@
+package state
+
+import (
+	"errors"
+	"testing"
+
+	batchspec "perfect-gpg-keypair/internal/state/batch_spec"
+	keyalgorithm "perfect-gpg-keypair/internal/state/key_algorithm"
+	userinfo "perfect-gpg-keypair/internal/state/user_info"
+	"perfect-gpg-keypair/internal/utils"
+)
+
+func TestSubkeysFromSpecValidatesAlgorithmOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		spec    batchspec.BatchSpec
+		wantErr bool
+	}{
+		{name: "profile defaults", profile: "ed25519"},
+		{name: "same family", profile: "rsa4096", spec: batchspec.BatchSpec{SigningAlgorithm: "rsa3072", EncryptionAlgorithm: "rsa3072"}},
+		{name: "encryption curve for signing", profile: "ed25519", spec: batchspec.BatchSpec{SigningAlgorithm: "cv25519"}, wantErr: true},
+		{name: "signing curve for encryption", profile: "ed25519", spec: batchspec.BatchSpec{EncryptionAlgorithm: "ed25519"}, wantErr: true},
+		{name: "rsa under ed25519", profile: "ed25519", spec: batchspec.BatchSpec{SigningAlgorithm: "rsa4096"}, wantErr: true},
+		{name: "nistp384 under rsa", profile: "rsa4096", spec: batchspec.BatchSpec{EncryptionAlgorithm: "nistp384"}, wantErr: true},
+		{
+			name:    "authentication under another family",
+			profile: "nistp384",
+			spec:    batchspec.BatchSpec{AuthenticationSubkey: true, AuthenticationAlgorithm: "ed25519"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, err := keyalgorithm.GetProfile(tt.profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			userInfo := userinfo.UserInfo{Expiry: "1y", Algorithm: profile}
+
+			subkeys, err := subkeysFromSpec(userInfo, tt.spec)
+			if tt.wantErr {
+				var validation *utils.ValidationError
+				if !errors.As(err, &validation) {
+					t.Fatalf("subkeysFromSpec() returned %v, want a ValidationError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("subkeysFromSpec() returned error: %v", err)
+			}
+			for _, subkey := range subkeys {
+				if err := profile.ValidateSubkey(subkey.Usage, subkey.Algorithm); err != nil {
+					t.Errorf("subkeysFromSpec() returned an invalid %s subkey: %v", subkey.Usage, err)
+				}
+			}
+		})
+	}
+}
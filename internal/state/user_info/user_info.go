@@ -2,15 +2,73 @@ package user_info
 
 import (
 	"fmt"
+	"strings"
+
+	keyalgorithm "perfect-gpg-keypair/internal/state/key_algorithm"
+	utils "perfect-gpg-keypair/internal/utils"
 )
 
+const DefaultExpiry = "1y"
+
+// DefaultRevocationReason is the reason of the revocation certificate if none is chosen,
+// as a pre-made certificate is most likely needed when the key is compromised
+const DefaultRevocationReason = utils.RevocationCompromised
+
+type Subkey struct {
+	Usage     keyalgorithm.Usage
+	Algorithm keyalgorithm.KeySpec
+	Expiry    string
+}
+
+func (subkey Subkey) String() string {
+	return fmt.Sprintf("%s (%s, expires %s)", subkey.Usage.Description(), subkey.Algorithm.Name(), subkey.Expiry)
+}
+
+// Revocation describes the pre-made revocation certificate(s)
+type Revocation struct {
+	Reason      utils.RevocationReason
+	Description string
+	// AllReasons creates one certificate per reason instead of only one for Reason
+	AllReasons bool
+}
+
+// Reasons returns the reasons to create revocation certificates for
+func (revocation Revocation) Reasons() []utils.RevocationReason {
+	if revocation.AllReasons {
+		return utils.RevocationReasons
+	}
+	return []utils.RevocationReason{revocation.Reason}
+}
+
+func (revocation Revocation) String() string {
+	reason := revocation.Reason.String()
+	if revocation.AllReasons {
+		reason = "one certificate per reason"
+	}
+	if revocation.Description == "" {
+		return reason
+	}
+	return fmt.Sprintf("%s (%s)", reason, revocation.Description)
+}
+
 type UserInfo struct {
 	FullName string
 	// fullName FullName
-	Email  string
-	Expiry string
+	Email     string
+	Expiry    string
+	Algorithm keyalgorithm.Profile
+	Subkeys   []Subkey
+	// Revocation describes the pre-made revocation certificate(s)
+	Revocation Revocation
 }
 
 func (info UserInfo) String() string {
-	return fmt.Sprintf("Name:   %s\nEmail:  %s\nExpiry: %s", info.FullName, info.Email, info.Expiry)
+	subkeys := make([]string, len(info.Subkeys))
+	for i, subkey := range info.Subkeys {
+		subkeys[i] = subkey.String()
+	}
+	return fmt.Sprintf(
+		"Name:       %s\nEmail:      %s\nExpiry:     %s\nAlgorithm:  %s\nSubkeys:    %s\nRevocation: %s",
+		info.FullName, info.Email, info.Expiry, info.Algorithm.Name, strings.Join(subkeys, "\n            "), info.Revocation,
+	)
 }
@@ -0,0 +1,226 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	logger "github.com/sirupsen/logrus"
+
+	keylist "perfect-gpg-keypair/internal/key_list"
+	openpgp "perfect-gpg-keypair/internal/openpgp"
+	"perfect-gpg-keypair/internal/utils"
+	"perfect-gpg-keypair/internal/wipe"
+	spinner "perfect-gpg-keypair/ui/spinner"
+)
+
+// verifyBackup checks the copies in the backup directory against the exported files
+// and test-imports the backed up master key into a scratch keyring
+func verifyBackup(state State, backupDir string, passphrase string, masterFingerprint string) tea.Cmd {
+	return func() tea.Msg {
+		if err := state.TmpDir.VerifyCopies(backupDir); err != nil {
+			return spinner.SpinnerErrMsg(err)
+		}
+		privateMasterKeyFilePath := filepath.Join(backupDir, state.TmpDir.PrivateMasterKeyFileName)
+		if _, err := testImportBackup(state, privateMasterKeyFilePath, passphrase, masterFingerprint); err != nil {
+			return spinner.SpinnerErrMsg(err)
+		}
+		return spinner.ActionCompleteSpinnerMsg("")
+	}
+}
+
+// backupMismatchError means a backup does not hold the key it should, as opposed to an error while checking it
+type backupMismatchError struct {
+	message string
+}
+
+func (e *backupMismatchError) Error() string {
+	return e.message
+}
+
+// testImportBackup imports the backup of the master key into a scratch keyring, which is removed again afterwards,
+// and ensures it holds the secret master key with the given fingerprint and that the passphrase unlocks it
+func testImportBackup(state State, privateMasterKeyFilePath string, passphrase string, masterFingerprint string) (keylist.Key, error) {
+	tmpDir := state.TmpDir
+	if err := tmpDir.CreateScratchGnupgHome(); err != nil {
+		return keylist.Key{}, fmt.Errorf("could not create scratch keyring: %w", err)
+	}
+	scratchKeyring := state.Keyring.WithHomeDir(tmpDir.ScratchGnupgHomePath())
+	defer func() {
+		if err := scratchKeyring.KillAgent(); err != nil {
+			logger.Debugf("could not stop gpg-agent of scratch keyring: %s\n", err)
+		}
+		if err := wipe.Dir(tmpDir.ScratchGnupgHomePath()).Err(); err != nil {
+			logger.Debugf("could not remove scratch keyring: %s\n", err)
+		}
+	}()
+
+	if err := scratchKeyring.ImportKey(passphrase, privateMasterKeyFilePath); err != nil {
+		return keylist.Key{}, fmt.Errorf("could not import backup '%s': %w", privateMasterKeyFilePath, err)
+	}
+	keys, err := scratchKeyring.GetKeys(true, masterFingerprint)
+	if err != nil || len(keys) != 1 {
+		return keylist.Key{}, &backupMismatchError{fmt.Sprintf("backup '%s' does not hold the secret key '%s'", privateMasterKeyFilePath, masterFingerprint)}
+	}
+	if keys[0].Secret != keylist.SecretAvailable {
+		return keys[0], &backupMismatchError{fmt.Sprintf("backup '%s' does not hold the secret part of the master key", privateMasterKeyFilePath)}
+	}
+	// the passphrase may still be cached from the import
+	if err := scratchKeyring.KillAgent(); err != nil {
+		return keys[0], fmt.Errorf("could not stop gpg-agent of scratch keyring: %w", err)
+	}
+	if err := scratchKeyring.CheckPassphrase(passphrase, masterFingerprint); err != nil {
+		var badPassphrase *utils.BadPassphraseError
+		if errors.As(err, &badPassphrase) {
+			return keys[0], fmt.Errorf("the passphrase does not unlock the master key of backup '%s': %w", privateMasterKeyFilePath, err)
+		}
+		return keys[0], fmt.Errorf("could not check the passphrase of backup '%s': %w", privateMasterKeyFilePath, err)
+	}
+	return keys[0], nil
+}
+
+// expiryWarningPeriod is how long before their expiry keys are reported as expiring soon
+const expiryWarningPeriod = 30 * 24 * time.Hour
+
+// BackupReport is the result of verifying a backup of the master key
+type BackupReport struct {
+	// Key is the key as imported from the backup
+	Key keylist.Key
+	// Warnings lists the differences to the key in the default keyring and keys that are expired or expire soon
+	Warnings []string
+}
+
+// ReadBackupKeyInfo reads the fingerprint, algorithm and user ids of the master key from its backup, without gpg
+func ReadBackupKeyInfo(backupFilePath string) (openpgp.KeyInfo, error) {
+	backupData, err := os.ReadFile(backupFilePath)
+	if err != nil {
+		return openpgp.KeyInfo{}, err
+	}
+	keyData, err := openpgp.ReadKeyData(backupData)
+	if err != nil {
+		return openpgp.KeyInfo{}, &backupMismatchError{fmt.Sprintf("'%s' is not a key backup: %s", backupFilePath, err)}
+	}
+	info, err := openpgp.ReadKeyInfo(keyData)
+	if err != nil {
+		return info, &backupMismatchError{fmt.Sprintf("'%s' is not a key backup: %s", backupFilePath, err)}
+	}
+	return info, nil
+}
+
+// VerifyBackupFile imports the backup of the master key into a scratch keyring, which is removed again afterwards,
+// ensures the passphrase unlocks it and compares it with the key in the default keyring.
+// A backup that does not hold the secret master key is reported as utils.BackupNotConfirmedError,
+// any other error (e.g. a bad passphrase or a failing gpg) is returned as is.
+func (state *State) VerifyBackupFile(backupFilePath string) (BackupReport, error) {
+	report, err := state.verifyBackupFile(backupFilePath)
+	var mismatch *backupMismatchError
+	if errors.As(err, &mismatch) {
+		return report, &utils.BackupNotConfirmedError{Backup: backupFilePath, Err: err}
+	}
+	return report, err
+}
+
+func (state *State) verifyBackupFile(backupFilePath string) (BackupReport, error) {
+	info, err := ReadBackupKeyInfo(backupFilePath)
+	if err != nil {
+		return BackupReport{}, err
+	}
+	if !state.Batch {
+		passphrase, err := GetExistingPassphrase()
+		if err != nil {
+			return BackupReport{}, err
+		}
+		state.passphrase = passphrase
+	}
+
+	var report BackupReport
+	_, err = state.runStep("Test-importing backup into a scratch keyring ...", func() tea.Msg {
+		key, err := testImportBackup(*state, backupFilePath, state.passphrase, info.FingerprintHex())
+		if err != nil {
+			return spinner.SpinnerErrMsg(err)
+		}
+		report.Key = key
+		return spinner.ActionCompleteSpinnerMsg("")
+	})
+	if err != nil {
+		return report, err
+	}
+
+	localKeys, err := state.defaultKeyring().GetKeys(false, report.Key.Fingerprint)
+	if err != nil || len(localKeys) != 1 {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("the key '%s' is not in your keyring", report.Key.Fingerprint))
+	} else {
+		report.Warnings = append(report.Warnings, compareWithLocalKey(report.Key, localKeys[0])...)
+	}
+	report.Warnings = append(report.Warnings, expiryWarnings(report.Key, time.Now())...)
+	return report, nil
+}
+
+// compareWithLocalKey lists the subkeys and expiry dates that differ between the backup and the key in the keyring,
+// e.g. because the key was renewed or a subkey was added or revoked after the backup was taken
+func compareWithLocalKey(backup keylist.Key, local keylist.Key) []string {
+	warnings := []string{}
+	if !sameExpiry(backup.Expires, local.Expires) {
+		warnings = append(warnings, fmt.Sprintf(
+			"the master key expires %s in the backup, but %s in your keyring", formatExpiry(backup.Expires), formatExpiry(local.Expires),
+		))
+	}
+	for _, localSubkey := range local.Subkeys {
+		backupSubkey, found := backup.FindSubkey(localSubkey.Fingerprint)
+		if !found {
+			warnings = append(warnings, fmt.Sprintf("subkey '%s' of your keyring is not in the backup", localSubkey.Fingerprint))
+			continue
+		}
+		if localSubkey.IsRevoked() && !backupSubkey.IsRevoked() {
+			warnings = append(warnings, fmt.Sprintf("subkey '%s' is revoked in your keyring, but not in the backup", localSubkey.Fingerprint))
+		}
+		if !sameExpiry(backupSubkey.Expires, localSubkey.Expires) {
+			warnings = append(warnings, fmt.Sprintf(
+				"subkey '%s' expires %s in the backup, but %s in your keyring",
+				localSubkey.Fingerprint, formatExpiry(backupSubkey.Expires), formatExpiry(localSubkey.Expires),
+			))
+		}
+	}
+	for _, backupSubkey := range backup.Subkeys {
+		if _, found := local.FindSubkey(backupSubkey.Fingerprint); !found {
+			warnings = append(warnings, fmt.Sprintf("subkey '%s' of the backup is not in your keyring", backupSubkey.Fingerprint))
+		}
+	}
+	return warnings
+}
+
+// expiryWarnings lists the keys of the backup that are expired or expire within expiryWarningPeriod
+func expiryWarnings(key keylist.Key, now time.Time) []string {
+	warnings := []string{}
+	check := func(description string, subkey keylist.Subkey) {
+		switch {
+		case subkey.IsRevoked() || subkey.Expires == nil:
+		case subkey.Expires.Before(now):
+			warnings = append(warnings, fmt.Sprintf("%s expired on %s", description, formatExpiry(subkey.Expires)))
+		case subkey.Expires.Before(now.Add(expiryWarningPeriod)):
+			warnings = append(warnings, fmt.Sprintf("%s expires soon, on %s (see 'renew')", description, formatExpiry(subkey.Expires)))
+		}
+	}
+	check("the master key", key.Subkey)
+	for _, subkey := range key.Subkeys {
+		check(fmt.Sprintf("subkey '%s'", subkey.Fingerprint), subkey)
+	}
+	return warnings
+}
+
+func sameExpiry(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func formatExpiry(expires *time.Time) string {
+	if expires == nil {
+		return "never"
+	}
+	return expires.Format(time.DateOnly)
+}
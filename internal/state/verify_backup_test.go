@@ -0,0 +1,97 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	gpgfake "perfect-gpg-keypair/internal/gpg_fake"
+	batchspec "perfect-gpg-keypair/internal/state/batch_spec"
+	tmpdir "perfect-gpg-keypair/internal/tmp_dir"
+	"perfect-gpg-keypair/internal/utils"
+)
+
+// the backup fixture of internal/openpgp
+const backupFingerprint = "CF3708BE59878656536F3C64293BBA13E2721659"
+
+func TestVerifyBackupFileExitCodes(t *testing.T) {
+	backupFilePath := filepath.Join("..", "openpgp", "testdata", "secret-key.asc")
+	notABackupFilePath := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(notABackupFilePath, []byte("not a key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	listing := "sec:u:255:22:293BBA13E2721659:1704067200:::u:::cC:::+:::ed25519:::0:\n" +
+		"fpr:::::::::" + backupFingerprint + ":\n"
+
+	tests := []struct {
+		name           string
+		backupFilePath string
+		runner         *gpgfake.Runner
+		wantCode       int
+	}{
+		{
+			name:           "verified",
+			backupFilePath: backupFilePath,
+			runner:         gpgfake.New().On(gpgfake.Response{Stdout: listing}, "--list-secret-keys"),
+			wantCode:       0,
+		},
+		{
+			name:           "missing file",
+			backupFilePath: filepath.Join(t.TempDir(), "missing.gpg"),
+			runner:         gpgfake.New(),
+			wantCode:       utils.ExitError,
+		},
+		{
+			name:           "not a key backup",
+			backupFilePath: notABackupFilePath,
+			runner:         gpgfake.New(),
+			wantCode:       utils.ExitBackupNotConfirmed,
+		},
+		{
+			name:           "secret key missing from backup",
+			backupFilePath: backupFilePath,
+			runner:         gpgfake.New(),
+			wantCode:       utils.ExitBackupNotConfirmed,
+		},
+		{
+			name:           "bad passphrase",
+			backupFilePath: backupFilePath,
+			runner: gpgfake.New().
+				On(gpgfake.Response{Stdout: listing}, "--list-secret-keys").
+				On(gpgfake.Response{Status: "[GNUPG:] BAD_PASSPHRASE 293BBA13E2721659\n", ExitCode: 2}, "--export-secret-keys"),
+			wantCode: utils.ExitBadPassphrase,
+		},
+		{
+			name:           "gpg failure",
+			backupFilePath: backupFilePath,
+			runner:         gpgfake.New().On(gpgfake.Response{Status: "[GNUPG:] FAILURE import 33554433\n", ExitCode: 2}, "--import"),
+			wantCode:       utils.ExitGpgFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_GPG_PASSPHRASE", testPassphrase)
+			tmpDir, err := tmpdir.OpenTmpDir(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tmpDir.Create(); err != nil {
+				t.Fatal(err)
+			}
+			state := NewState(false, tt.runner)
+			state.TmpDir = tmpDir
+			if err := state.SetPassphraseFromBatchSpec(batchspec.BatchSpec{PassphraseEnv: "TEST_GPG_PASSPHRASE"}); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = state.VerifyBackupFile(tt.backupFilePath)
+			code := 0
+			if err != nil {
+				_, code = utils.ClassifyError(err)
+			}
+			if code != tt.wantCode {
+				t.Errorf("VerifyBackupFile() returned %v, exit code %d, want %d", err, code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,425 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	logger "github.com/sirupsen/logrus"
+
+	qrbackup "perfect-gpg-keypair/internal/qr_backup"
+	runrecord "perfect-gpg-keypair/internal/run_record"
+	shamir "perfect-gpg-keypair/internal/shamir"
+	batchspec "perfect-gpg-keypair/internal/state/batch_spec"
+	keyalgorithm "perfect-gpg-keypair/internal/state/key_algorithm"
+	tmpdir "perfect-gpg-keypair/internal/tmp_dir"
+	"perfect-gpg-keypair/internal/utils"
+	"perfect-gpg-keypair/internal/wipe"
+	spinner "perfect-gpg-keypair/ui/spinner"
+)
+
+// The steps of generate, in the order they are run. Completed steps are recorded in the journal in the temporary directory.
+const (
+	stepGenerateMaster tmpdir.Step = "generate-master"
+	stepAddSubkeys     tmpdir.Step = "add-subkeys"
+	stepRevocationCert tmpdir.Step = "revocation-cert"
+	stepExport         tmpdir.Step = "export"
+	stepBackupConfirm  tmpdir.Step = "backup-confirm"
+	stepRemoveMaster   tmpdir.Step = "remove-master"
+	stepReimport       tmpdir.Step = "reimport"
+)
+
+type workflowStep struct {
+	name tmpdir.Step
+	run  func(journal *tmpdir.Journal) error
+}
+
+func (state State) workflowSteps() []workflowStep {
+	return []workflowStep{
+		{stepGenerateMaster, state.generateMasterStep},
+		{stepAddSubkeys, state.addSubkeysStep},
+		{stepRevocationCert, state.revocationCertStep},
+		{stepExport, state.exportStep},
+		{stepBackupConfirm, state.backupConfirmStep},
+		{stepRemoveMaster, state.removeMasterStep},
+		{stepReimport, state.reimportStep},
+	}
+}
+
+// runWorkflow runs the steps of generate that the journal does not record as completed
+func (state State) runWorkflow(journal *tmpdir.Journal) error {
+	for _, step := range state.workflowSteps() {
+		if journal.IsCompleted(step.name) {
+			logger.Debugf("skipping completed step: %s\n", step.name)
+			continue
+		}
+		logger.Debugf("running step: %s\n", step.name)
+		if err := step.run(journal); err != nil {
+			return err
+		}
+		if err := journal.Complete(step.name); err != nil {
+			return fmt.Errorf("could not write journal: %w", err)
+		}
+	}
+
+	utils.InfoPrint("\nYour generated GPG keypair is:")
+	state.defaultKeyring().ListKeys(true, "long", journal.MasterFingerprint)
+	utils.InfoPrint(fmt.Sprintf("Ensure that the key with SC attributes and the fingerprint '%s' is prepended by 'sec#'\n", journal.MasterFingerprint))
+	return nil
+}
+
+// ResumeGeneration resumes generate from the temporary directory of a failed run, skipping the steps its journal records as completed.
+// The passphrase is asked for again (or read from the batch spec), everything else is taken from the journal.
+// Output options set for the resumed run must match the ones of the journal, see setOutputFromJournal.
+func (state *State) ResumeGeneration(tmpDir tmpdir.TmpDir) error {
+	journal, err := tmpDir.ReadJournal()
+	if err != nil {
+		return err
+	}
+	userInfo, err := journal.UserInfo()
+	if err != nil {
+		return fmt.Errorf("invalid journal: %w", err)
+	}
+	if err := state.setOutputFromJournal(journal.Output); err != nil {
+		return err
+	}
+	if state.Batch && state.Bundle && state.bundlePassphrase == "" && !journal.IsCompleted(stepExport) {
+		return utils.InvalidPassphraseError(
+			"the run being resumed packs the keys into a backup bundle, set its passphrase with --bundle-passphrase-file or --bundle-passphrase-env",
+		)
+	}
+	state.TmpDir = tmpDir
+	state.UserInfo = userInfo
+	state.Isolated = journal.Isolated
+	if journal.Isolated {
+		state.Keyring = state.Keyring.WithHomeDir(tmpDir.GnupgHomePath())
+	}
+	completed := make([]string, len(journal.Completed))
+	for i, step := range journal.Completed {
+		completed[i] = string(step)
+	}
+	utils.InfoPrint(fmt.Sprintf("Resuming the generation of (completed steps: %s):", strings.Join(completed, ", ")))
+	utils.PrintHiddenBorder(userInfo.String())
+
+	if !state.Batch {
+		passphrase, err := GetExistingPassphrase()
+		if err != nil {
+			return err
+		}
+		state.passphrase = passphrase
+	}
+	// fail early on a wrong passphrase, as long as the master key is there to check it.
+	// A passphrase still cached by the gpg-agent passes, it is checked again when the backup is test-imported.
+	if journal.IsCompleted(stepGenerateMaster) && !journal.IsCompleted(stepRemoveMaster) {
+		if err := state.Keyring.CheckPassphrase(state.passphrase, journal.MasterFingerprint); err != nil {
+			var badPassphrase *utils.BadPassphraseError
+			if errors.As(err, &badPassphrase) {
+				return fmt.Errorf("the passphrase does not unlock the master key '%s'", journal.MasterFingerprint)
+			}
+			return fmt.Errorf("could not check the passphrase of the master key '%s': %w", journal.MasterFingerprint, err)
+		}
+	}
+	if !journal.IsCompleted(stepGenerateMaster) {
+		if err := tmpDir.CreateParametersFile(userInfo); err != nil {
+			return fmt.Errorf("could not create parameters file: %w", err)
+		}
+	}
+	if journal.IsCompleted(stepBackupConfirm) {
+		state.recordProgress(runrecord.BackedUp, journal.MasterFingerprint)
+	} else if journal.IsCompleted(stepGenerateMaster) {
+		state.recordProgress(runrecord.MasterGenerated, journal.MasterFingerprint)
+	}
+	return state.runWorkflow(&journal)
+}
+
+// SetResumeFromBatchSpec sets up the state for resuming a run without any user interaction. The key and the output options
+// are taken from the journal of the run, output options set in the spec must match them (see setOutputFromJournal).
+func (state *State) SetResumeFromBatchSpec(spec batchspec.BatchSpec) error {
+	if err := state.SetPassphraseFromBatchSpec(spec); err != nil {
+		return err
+	}
+	if err := state.SetOutputOptions(spec); err != nil {
+		return err
+	}
+	// whether the run packs a bundle is only known from its journal
+	if spec.Bundle || spec.BundlePassphraseFile != "" || spec.BundlePassphraseEnv != "" {
+		return state.setBundlePassphrase(spec, state.passphrase)
+	}
+	return nil
+}
+
+// journalOutput returns the output options of the state, as saved in the journal
+func (state State) journalOutput() tmpdir.JournalOutput {
+	output := tmpdir.JournalOutput{
+		Dir:         state.OutputDir,
+		PaperBackup: state.PaperBackup,
+		ShamirDir:   state.ShamirDir,
+		Bundle:      state.Bundle,
+	}
+	if state.QRBackup.Enabled() {
+		output.QRBackup = string(state.QRBackup.Content)
+		output.QRFormat = string(state.QRBackup.Format)
+	}
+	if state.Shamir.Enabled() {
+		output.ShamirShares = state.Shamir.Shares
+		output.ShamirThreshold = state.Shamir.Threshold
+		output.ShamirSecret = string(state.Shamir.Secret)
+	}
+	return output
+}
+
+// setOutputFromJournal takes the output options of the run being resumed from its journal. The options set for the resumed run
+// (by flags or the batch spec) must match them, as the keys may already have been exported and backed up with them.
+// Only a directory the run would have asked for can be set.
+func (state *State) setOutputFromJournal(saved tmpdir.JournalOutput) error {
+	current := state.journalOutput()
+	conflicts := []string{}
+	if current.Dir != "" && saved.Dir != "" && !sameDir(current.Dir, saved.Dir) {
+		conflicts = append(conflicts, fmt.Sprintf("--output-dir '%s' (the run uses '%s')", current.Dir, saved.Dir))
+	}
+	if current.PaperBackup && !saved.PaperBackup {
+		conflicts = append(conflicts, "--paper-backup (the run has no paper backup)")
+	}
+	if current.QRBackup != "" && (current.QRBackup != saved.QRBackup || current.QRFormat != saved.QRFormat) {
+		conflicts = append(conflicts, fmt.Sprintf("--qr-backup %s --qr-format %s (the run uses '%s')", current.QRBackup, current.QRFormat, describeQRBackup(saved)))
+	}
+	if current.ShamirShares != 0 &&
+		(current.ShamirShares != saved.ShamirShares || current.ShamirThreshold != saved.ShamirThreshold || current.ShamirSecret != saved.ShamirSecret) {
+		conflicts = append(conflicts, fmt.Sprintf(
+			"--shamir-shares %d --shamir-threshold %d --shamir-secret %s (the run uses '%s')",
+			current.ShamirShares, current.ShamirThreshold, current.ShamirSecret, describeShamir(saved),
+		))
+	}
+	if current.ShamirDir != "" && saved.ShamirDir != "" && !sameDir(current.ShamirDir, saved.ShamirDir) {
+		conflicts = append(conflicts, fmt.Sprintf("--shamir-dir '%s' (the run uses '%s')", current.ShamirDir, saved.ShamirDir))
+	}
+	if current.Bundle && !saved.Bundle {
+		conflicts = append(conflicts, "--bundle (the run has no backup bundle)")
+	}
+	if len(conflicts) > 0 {
+		return utils.InvalidArgumentsError(fmt.Sprintf("the run being resumed was started with other output options: %s", strings.Join(conflicts, ", ")))
+	}
+
+	if saved.Dir == "" {
+		saved.Dir = current.Dir
+	}
+	if saved.ShamirDir == "" {
+		saved.ShamirDir = current.ShamirDir
+	}
+	qrBackup, err := qrbackup.ParseOptions(saved.QRBackup, saved.QRFormat)
+	if err != nil {
+		return fmt.Errorf("invalid journal: %w", err)
+	}
+	shamirOptions, err := shamir.ParseOptions(saved.ShamirShares, saved.ShamirThreshold, saved.ShamirSecret)
+	if err != nil {
+		return fmt.Errorf("invalid journal: %w", err)
+	}
+	if saved.Dir != "" {
+		if err := utils.ValidateOutputDir(saved.Dir); err != nil {
+			return err
+		}
+	} else if state.Batch {
+		return utils.InvalidOutputDirError("must be set in batch mode")
+	}
+	if saved.ShamirDir != "" {
+		if err := utils.ValidateShamirDir(saved.ShamirDir, saved.Dir); err != nil {
+			return err
+		}
+	} else if state.Batch && shamirOptions.Enabled() {
+		return utils.InvalidShamirDirError("must be set in batch mode when splitting into shares")
+	}
+	state.OutputDir = saved.Dir
+	state.PaperBackup = saved.PaperBackup
+	state.QRBackup = qrBackup
+	state.Shamir = shamirOptions
+	state.ShamirDir = saved.ShamirDir
+	state.Bundle = saved.Bundle
+	return nil
+}
+
+func describeQRBackup(output tmpdir.JournalOutput) string {
+	if output.QRBackup == "" {
+		return "no QR backup"
+	}
+	return fmt.Sprintf("%s as %s", output.QRBackup, output.QRFormat)
+}
+
+func describeShamir(output tmpdir.JournalOutput) string {
+	if output.ShamirShares == 0 {
+		return "no shares"
+	}
+	return fmt.Sprintf("%d of %d shares of the %s", output.ShamirThreshold, output.ShamirShares, output.ShamirSecret)
+}
+
+func sameDir(a string, b string) bool {
+	return filepath.Clean(utils.ExpandHome(a)) == filepath.Clean(utils.ExpandHome(b))
+}
+
+// CanResume reports whether a failed run can be resumed from its temporary directory, i.e. the master key has been generated
+func CanResume(tmpDir tmpdir.TmpDir) bool {
+	journal, err := tmpDir.ReadJournal()
+	return err == nil && journal.IsCompleted(stepGenerateMaster)
+}
+
+func (state State) generateMasterStep(journal *tmpdir.Journal) error {
+	logger.Debugf("generating master keypair\n")
+	masterFingerprint, err := state.runStep(
+		fmt.Sprintf("Generating master keypair (%s) ...", state.UserInfo.Algorithm.Description),
+		generateMasterKeypair(state, state.passphrase),
+	)
+	if err != nil {
+		return err
+	}
+	logger.Debugf("successfully generated master keypair with fingerprint: %s\n", masterFingerprint)
+	journal.MasterFingerprint = masterFingerprint
+	state.recordProgress(runrecord.MasterGenerated, masterFingerprint)
+	return nil
+}
+
+// addSubkeysStep adds the subkeys that have not been added yet, the journal is saved after each one
+func (state State) addSubkeysStep(journal *tmpdir.Journal) error {
+	for _, subkey := range state.UserInfo.Subkeys {
+		if _, added := journal.SubkeyFingerprints[string(subkey.Usage)]; added {
+			continue
+		}
+		logger.Debugf("adding %s subkey\n", subkey.Usage.Description())
+		subkeyFingerprint, err := state.runStep(
+			fmt.Sprintf("Adding %s subkey (%s) for use with this computer ...", subkey.Usage.Description(), subkey.Algorithm.Name()),
+			addSubkey(state, state.passphrase, journal.MasterFingerprint, subkey),
+		)
+		if err != nil {
+			return err
+		}
+		logger.Debugf("successfully added a %s subkey with fingerprint: %s\n", subkey.Usage.Description(), subkeyFingerprint)
+		journal.SubkeyFingerprints[string(subkey.Usage)] = subkeyFingerprint
+		if err := journal.Save(); err != nil {
+			return fmt.Errorf("could not write journal: %w", err)
+		}
+	}
+	return nil
+}
+
+func (state State) revocationCertStep(journal *tmpdir.Journal) error {
+	revocationCertFilePaths := state.TmpDir.RevocationCertFilePaths(state.UserInfo.Revocation)
+	for _, reason := range state.UserInfo.Revocation.Reasons() {
+		revocationCertFilePath := revocationCertFilePaths[reason]
+		// gpg does not overwrite a certificate left by a failed run
+		if err := wipe.File(revocationCertFilePath); err != nil {
+			return err
+		}
+		logger.Debugf("creating revocation certificate at: '%s'\n", revocationCertFilePath)
+		_, err := state.runStep(
+			fmt.Sprintf("Creating revocation certificate (%s) ...", reason.Description()),
+			createRevocationCertificate(state, state.passphrase, journal.MasterFingerprint, reason, revocationCertFilePath),
+		)
+		if err != nil {
+			return err
+		}
+		logger.Debugf("exported revocation certificate to: %s\n", revocationCertFilePath)
+	}
+	return nil
+}
+
+func (state State) exportStep(journal *tmpdir.Journal) error {
+	if err := state.wipeExportedKeys(); err != nil {
+		return fmt.Errorf("could not remove the exported keys of a failed run: %w", err)
+	}
+	subkeyFingerprints := map[keyalgorithm.Usage]string{}
+	for usage, fingerprint := range journal.SubkeyFingerprints {
+		subkeyFingerprints[keyalgorithm.Usage(usage)] = fingerprint
+	}
+	logger.Debugf("exporting gpg keys to: %s\n", state.TmpDir.ExportedKeysDirPath())
+	_, err := state.runStep(
+		"Exporting gpg keys ...",
+		exportGpgKeys(state, state.passphrase, journal.MasterFingerprint, subkeyFingerprints),
+	)
+	if err != nil {
+		return err
+	}
+	logger.Debugf("files exported to: %s\n", state.TmpDir.ExportedKeysDirPath())
+	return state.bundleExportedKeys(state.passphrase, journal.MasterFingerprint)
+}
+
+// wipeExportedKeys removes everything but the revocation certificates from the exported keys directory,
+// as gpg does not overwrite the files exported by a failed run, and the shares split by a failed run
+func (state State) wipeExportedKeys() error {
+	if err := wipe.Dir(state.TmpDir.SharesDirPath()).Err(); err != nil {
+		return err
+	}
+	filePaths, err := state.TmpDir.ExportedKeyFilePaths()
+	if err != nil {
+		return err
+	}
+	revocationCertFilePaths := []string{}
+	for _, path := range state.TmpDir.RevocationCertFilePaths(state.UserInfo.Revocation) {
+		revocationCertFilePaths = append(revocationCertFilePaths, path)
+	}
+	for _, filePath := range filePaths {
+		if slices.Contains(revocationCertFilePaths, filePath) {
+			continue
+		}
+		if err := wipe.File(filePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (state State) backupConfirmStep(journal *tmpdir.Journal) error {
+	if err := state.backUpExportedKeys(state.passphrase, journal.MasterFingerprint); err != nil {
+		return err
+	}
+	state.recordProgress(runrecord.BackedUp, journal.MasterFingerprint)
+	return nil
+}
+
+// removeMasterStep deletes the secret keys from the default keyring, the throwaway keyring of isolated runs is wiped instead
+func (state State) removeMasterStep(journal *tmpdir.Journal) error {
+	if !state.Keyring.IsDefault() {
+		return nil
+	}
+	logger.Debugf("removing master keys\n")
+	state.recordProgress(runrecord.MasterRemoved, journal.MasterFingerprint)
+	_, err := state.runStep("Removing master keypair ...", removeMasterKey(state, state.passphrase, journal.MasterFingerprint))
+	return err
+}
+
+func (state State) reimportStep(journal *tmpdir.Journal) error {
+	var err error
+	if state.Keyring.IsDefault() {
+		logger.Debugf("reimporting subkeys\n")
+		_, err = state.runStep("Reimporting subkeys ...", reimportSubkeys(state, state.passphrase))
+	} else {
+		logger.Debugf("importing public key and subkeys into the default keyring\n")
+		_, err = state.runStep(
+			"Importing public key and subkeys into your keyring ...",
+			importSubkeyIntoDefaultKeyring(state, state.passphrase, journal.MasterFingerprint),
+		)
+	}
+	if err != nil {
+		return err
+	}
+	logger.Debugf("successfully reimported the subkeys\n")
+	return nil
+}
+
+func removeMasterKey(state State, passphrase string, masterFingerprint string) tea.Cmd {
+	return func() tea.Msg {
+		if err := state.Keyring.DeleteSecretKeys(passphrase, masterFingerprint); err != nil {
+			return spinner.SpinnerErrMsg(fmt.Errorf("could not delete master key: %w", err))
+		}
+		return spinner.ActionCompleteSpinnerMsg("")
+	}
+}
+
+func reimportSubkeys(state State, passphrase string) tea.Cmd {
+	return func() tea.Msg {
+		if err := importSubkeys(state, state.Keyring, passphrase); err != nil {
+			return spinner.SpinnerErrMsg(err)
+		}
+		return spinner.ActionCompleteSpinnerMsg("")
+	}
+}
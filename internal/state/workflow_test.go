@@ -0,0 +1,459 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	gpgfake "perfect-gpg-keypair/internal/gpg_fake"
+	qrbackup "perfect-gpg-keypair/internal/qr_backup"
+	shamir "perfect-gpg-keypair/internal/shamir"
+	batchspec "perfect-gpg-keypair/internal/state/batch_spec"
+	keyalgorithm "perfect-gpg-keypair/internal/state/key_algorithm"
+	tmpdir "perfect-gpg-keypair/internal/tmp_dir"
+	"perfect-gpg-keypair/internal/utils"
+)
+
+const (
+	testPassphrase            = "correct-horse-battery-staple"
+	testMasterFingerprint     = "0123456789ABCDEF0123456789ABCDEF01234567"
+	testSigningFingerprint    = "1111111111111111111111111111111111111111"
+	testEncryptionFingerprint = "2222222222222222222222222222222222222222"
+)
+
+// testKeyListing returns the key in gpg's colon format, as listed with --list-keys or (if secret) --list-secret-keys
+func testKeyListing(secret bool) string {
+	primary, sub, serial := "pub", "sub", ""
+	if secret {
+		primary, sub, serial = "sec", "ssb", "+"
+	}
+	return strings.Join([]string{
+		primary + ":u:255:22:89ABCDEF01234567:1700000000:1731536000::u:::scSCE:::" + serial + ":::ed25519:::0:",
+		"fpr:::::::::" + testMasterFingerprint + ":",
+		"uid:u::::1700000000::0000000000000000000000000000000000000000::Jane Doe <jane@example.com>::::::::::0:",
+		sub + ":u:255:22:1111111111111111:1700000000:1731536000:::::s:::" + serial + ":::ed25519::",
+		"fpr:::::::::" + testSigningFingerprint + ":",
+		sub + ":u:255:18:2222222222222222:1700000000:1731536000:::::e:::" + serial + ":::cv25519::",
+		"fpr:::::::::" + testEncryptionFingerprint + ":",
+		"",
+	}, "\n")
+}
+
+// newTestRunner returns a fake gpg that answers every command of a successful run of generate
+func newTestRunner() *gpgfake.Runner {
+	return gpgfake.New().
+		On(gpgfake.Response{Status: "[GNUPG:] KEY_CREATED P " + testMasterFingerprint + "\n"}, "--generate-key").
+		On(gpgfake.Response{Stdout: "pub   ed25519 2023-11-14 [SC]\n      0123 4567 89AB CDEF 0123  4567 89AB CDEF 0123 4567\n"}, "--fingerprint").
+		On(gpgfake.Response{Status: "[GNUPG:] KEY_CREATED S " + testSigningFingerprint + "\n"}, "--quick-add-key", "sign").
+		On(gpgfake.Response{Status: "[GNUPG:] KEY_CREATED S " + testEncryptionFingerprint + "\n"}, "--quick-add-key", "encr").
+		On(gpgfake.Response{Stdout: "revocation certificate\n"}, "--gen-revoke").
+		On(gpgfake.Response{Stdout: "public master key\n"}, "--export").
+		On(gpgfake.Response{Stdout: "private master key\n"}, "--export-secret-keys").
+		OnFunc(func(invocation gpgfake.Invocation) gpgfake.Response {
+			return gpgfake.Response{Stdout: "subkey " + invocation.Args[len(invocation.Args)-1] + "\n"}
+		}, "--export-secret-subkeys").
+		On(gpgfake.Response{Stdout: testKeyListing(false)}, "--list-keys", "--with-colons").
+		On(gpgfake.Response{Stdout: testKeyListing(true)}, "--list-secret-keys", "--with-colons")
+}
+
+// newTestState returns the state of a batch run of generate that runs gpg with the runner
+func newTestState(t *testing.T, runner utils.GpgRunner) State {
+	t.Helper()
+	t.Setenv("TEST_GPG_PASSPHRASE", testPassphrase)
+	tmpDir, err := tmpdir.OpenTmpDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpDir.Create(); err != nil {
+		t.Fatal(err)
+	}
+	state := NewState(false, runner)
+	state.TmpDir = tmpDir
+	spec := batchspec.BatchSpec{
+		Name:          "Jane Doe",
+		Email:         "jane@example.com",
+		Algorithm:     "ed25519",
+		OutputDir:     filepath.Join(t.TempDir(), "backup"),
+		PassphraseEnv: "TEST_GPG_PASSPHRASE",
+	}
+	if err := state.SetFromBatchSpec(spec); err != nil {
+		t.Fatalf("SetFromBatchSpec() returned error: %v", err)
+	}
+	if err := state.TmpDir.CreateParametersFile(state.UserInfo); err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+// subcommands returns the gpg subcommands (the first argument) the runner was given, in order
+func subcommands(runner *gpgfake.Runner) []string {
+	names := []string{}
+	for _, invocation := range runner.Invocations() {
+		if filepath.Base(invocation.Program) == "gpg" {
+			names = append(names, invocation.Args[0])
+		}
+	}
+	return names
+}
+
+func TestGenerateKeysRunsAllSteps(t *testing.T) {
+	runner := newTestRunner()
+	state := newTestState(t, runner)
+
+	if err := state.GenerateKeys(); err != nil {
+		t.Fatalf("GenerateKeys() returned error: %v", err)
+	}
+
+	want := []string{
+		"--generate-key",
+		"--fingerprint", "--quick-add-key",
+		"--fingerprint", "--quick-add-key",
+		"--gen-revoke",
+		"--export-secret-keys", "--export", "--export-secret-subkeys", "--export-secret-subkeys",
+		"--list-keys",
+		"--import", "--list-secret-keys", "--export-secret-keys",
+		"--delete-secret-keys",
+		"--import", "--import",
+		"--list-secret-keys",
+	}
+	if got := subcommands(runner); !slices.Equal(got, want) {
+		t.Errorf("gpg subcommands:\n got %v\nwant %v", got, want)
+	}
+
+	journal, err := state.TmpDir.ReadJournal()
+	if err != nil {
+		t.Fatalf("ReadJournal() returned error: %v", err)
+	}
+	for _, step := range state.workflowSteps() {
+		if !journal.IsCompleted(step.name) {
+			t.Errorf("step %s is not recorded as completed", step.name)
+		}
+	}
+	if journal.MasterFingerprint != testMasterFingerprint {
+		t.Errorf("journal has master fingerprint %q, want %q", journal.MasterFingerprint, testMasterFingerprint)
+	}
+	for _, file := range []string{
+		state.TmpDir.PrivateMasterKeyFileName, tmpdir.ManifestFileName, filepath.Base(state.TmpDir.SubkeyFilePath(keyalgorithm.Sign)),
+	} {
+		if _, err := os.Stat(filepath.Join(state.OutputDir, file)); err != nil {
+			t.Errorf("%s was not saved to the output directory: %v", file, err)
+		}
+	}
+}
+
+func TestGenerateKeysPassesPassphraseOutOfBand(t *testing.T) {
+	runner := newTestRunner()
+	state := newTestState(t, runner)
+
+	if err := state.GenerateKeys(); err != nil {
+		t.Fatalf("GenerateKeys() returned error: %v", err)
+	}
+
+	for _, subcommand := range []string{"--generate-key", "--quick-add-key", "--gen-revoke", "--export-secret-keys", "--delete-secret-keys"} {
+		calls := runner.Calls(subcommand)
+		if len(calls) == 0 {
+			t.Errorf("%s was not run", subcommand)
+		}
+		for _, call := range calls {
+			if call.Passphrase != testPassphrase {
+				t.Errorf("%s was run with passphrase %q, want %q", subcommand, call.Passphrase, testPassphrase)
+			}
+			if slices.Contains(call.Args, testPassphrase) {
+				t.Errorf("%s was run with the passphrase as argument: %v", subcommand, call.Args)
+			}
+		}
+	}
+}
+
+func TestGenerateKeysRemovesMasterKeyFromDefaultKeyring(t *testing.T) {
+	runner := newTestRunner()
+	state := newTestState(t, runner)
+
+	if err := state.GenerateKeys(); err != nil {
+		t.Fatalf("GenerateKeys() returned error: %v", err)
+	}
+
+	deletions := runner.Calls("--delete-secret-keys")
+	if len(deletions) != 1 {
+		t.Fatalf("expected the master key to be deleted once, got %d deletions", len(deletions))
+	}
+	if !deletions[0].Has(testMasterFingerprint) || deletions[0].Has("--homedir") {
+		t.Errorf("expected the master key to be deleted from the default keyring, got %v", deletions[0].Args)
+	}
+	for _, usage := range []keyalgorithm.Usage{keyalgorithm.Sign, keyalgorithm.Encrypt} {
+		if imports := runner.Calls("--import", state.TmpDir.SubkeyFilePath(usage)); len(imports) != 1 {
+			t.Errorf("expected the %s subkey to be reimported once, got %d imports", usage.Description(), len(imports))
+		}
+	}
+}
+
+func TestGenerateKeysKeepsExistingBackup(t *testing.T) {
+	runner := newTestRunner()
+	state := newTestState(t, runner)
+	if err := os.MkdirAll(state.OutputDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	existingBackup := filepath.Join(state.OutputDir, state.TmpDir.PrivateMasterKeyFileName)
+	if err := os.WriteFile(existingBackup, []byte("earlier backup\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := state.GenerateKeys()
+	var validation *utils.ValidationError
+	if !errors.As(err, &validation) {
+		t.Fatalf("GenerateKeys() returned %v for an output directory with an earlier backup, want a ValidationError", err)
+	}
+	if contents, _ := os.ReadFile(existingBackup); string(contents) != "earlier backup\n" {
+		t.Errorf("the earlier backup was overwritten with %q", contents)
+	}
+	if entries, _ := os.ReadDir(state.OutputDir); len(entries) != 1 {
+		t.Errorf("expected nothing to be copied next to the earlier backup, got %d files", len(entries))
+	}
+	if deletions := runner.Calls("--delete-secret-keys"); len(deletions) != 0 {
+		t.Errorf("expected the master key to be kept, got %v", deletions)
+	}
+}
+
+func TestGenerateKeysSavesSharesApartFromExportedKeys(t *testing.T) {
+	runner := newTestRunner()
+	state := newTestState(t, runner)
+	state.Shamir = shamir.Options{Shares: 3, Threshold: 2, Secret: shamir.PrivateMaster}
+	state.ShamirDir = filepath.Join(t.TempDir(), "shares")
+
+	if err := state.GenerateKeys(); err != nil {
+		t.Fatalf("GenerateKeys() returned error: %v", err)
+	}
+
+	for index := 1; index <= 3; index++ {
+		shareFile := shamir.ShareFile{Secret: shamir.PrivateMaster, Index: index, Shares: 3}
+		if _, err := os.Stat(filepath.Join(state.ShamirDir, shareFile.DirName(), shareFile.FileName())); err != nil {
+			t.Errorf("share %d was not saved to a directory of its own: %v", index, err)
+		}
+	}
+	exportedKeyFilePaths, err := state.TmpDir.ExportedKeyFilePaths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range exportedKeyFilePaths {
+		if strings.Contains(filepath.Base(path), "share") {
+			t.Errorf("share %s is among the exported keys", path)
+		}
+	}
+	entries, err := os.ReadDir(state.OutputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), "share") {
+			t.Errorf("share %s was saved to the output directory", entry.Name())
+		}
+	}
+}
+
+func TestGenerateKeysRejectsSharesNextToOutputDir(t *testing.T) {
+	state := newTestState(t, newTestRunner())
+	state.Shamir = shamir.Options{Shares: 3, Threshold: 2, Secret: shamir.PrivateMaster}
+	state.ShamirDir = filepath.Join(state.OutputDir, "shares")
+
+	err := state.GenerateKeys()
+	var validation *utils.ValidationError
+	if !errors.As(err, &validation) {
+		t.Fatalf("GenerateKeys() returned %v for shares inside the output directory, want a ValidationError", err)
+	}
+	if _, statErr := os.Stat(state.ShamirDir); !os.IsNotExist(statErr) {
+		t.Errorf("expected no shares to be saved inside the output directory, got %v", statErr)
+	}
+}
+
+func TestGenerateKeysIsolatedKeepsDefaultKeyringFree(t *testing.T) {
+	runner := newTestRunner()
+	state := newTestState(t, runner)
+	state.Isolated = true
+	if err := state.CreateIsolatedKeyring(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := state.GenerateKeys(); err != nil {
+		t.Fatalf("GenerateKeys() returned error: %v", err)
+	}
+
+	for _, subcommand := range []string{"--generate-key", "--quick-add-key", "--gen-revoke"} {
+		for _, call := range runner.Calls(subcommand) {
+			if homeDir, _ := call.Option("--homedir"); homeDir != state.TmpDir.GnupgHomePath() {
+				t.Errorf("%s was run against %q, want the throwaway keyring %q", subcommand, homeDir, state.TmpDir.GnupgHomePath())
+			}
+		}
+	}
+	if deletions := runner.Calls("--delete-secret-keys"); len(deletions) != 0 {
+		t.Errorf("expected no key to be deleted, got %v", deletions)
+	}
+	if ownerTrust := runner.Calls("--import-ownertrust"); len(ownerTrust) != 1 || ownerTrust[0].Has("--homedir") {
+		t.Errorf("expected the owner trust to be set in the default keyring, got %v", ownerTrust)
+	}
+}
+
+func TestGenerateKeysResumesAfterFailedStep(t *testing.T) {
+	runner := newTestRunner().On(gpgfake.Response{Stderr: "gpg: signing failed: No pinentry", ExitCode: 2}, "--gen-revoke")
+	state := newTestState(t, runner)
+
+	if err := state.GenerateKeys(); err == nil {
+		t.Fatal("GenerateKeys() returned no error for a failing revocation certificate")
+	}
+	if !CanResume(state.TmpDir) {
+		t.Fatal("expected the failed run to be resumable")
+	}
+	if deletions := runner.Calls("--delete-secret-keys"); len(deletions) != 0 {
+		t.Fatalf("expected no key to be deleted by the failed run, got %v", deletions)
+	}
+
+	runner.On(gpgfake.Response{Stdout: "revocation certificate\n"}, "--gen-revoke")
+	resumed := NewState(false, runner)
+	if err := resumed.SetBackupFromBatchSpec(batchspec.BatchSpec{OutputDir: state.OutputDir, PassphraseEnv: "TEST_GPG_PASSPHRASE"}); err != nil {
+		t.Fatalf("SetBackupFromBatchSpec() returned error: %v", err)
+	}
+	if err := resumed.ResumeGeneration(state.TmpDir); err != nil {
+		t.Fatalf("ResumeGeneration() returned error: %v", err)
+	}
+
+	if generated := runner.Calls("--generate-key"); len(generated) != 1 {
+		t.Errorf("expected the master key to be generated once, got %d times", len(generated))
+	}
+	if added := runner.Calls("--quick-add-key"); len(added) != 2 {
+		t.Errorf("expected 2 subkeys to be added, got %d", len(added))
+	}
+	if deletions := runner.Calls("--delete-secret-keys", testMasterFingerprint); len(deletions) != 1 {
+		t.Errorf("expected the master key to be deleted once, got %d deletions", len(deletions))
+	}
+}
+
+// failedRun returns the state of a batch run with the output options set by configure, which failed after generating the keys
+func failedRun(t *testing.T, configure func(state *State)) (*gpgfake.Runner, State) {
+	t.Helper()
+	runner := newTestRunner().On(gpgfake.Response{Stderr: "gpg: signing failed: No pinentry", ExitCode: 2}, "--gen-revoke")
+	state := newTestState(t, runner)
+	configure(&state)
+	if err := state.GenerateKeys(); err == nil {
+		t.Fatal("GenerateKeys() returned no error for a failing revocation certificate")
+	}
+	runner.On(gpgfake.Response{Stdout: "revocation certificate\n"}, "--gen-revoke")
+	return runner, state
+}
+
+func TestResumeGenerationKeepsOutputOptions(t *testing.T) {
+	runner, state := failedRun(t, func(state *State) {
+		state.Shamir = shamir.Options{Shares: 3, Threshold: 2, Secret: shamir.PrivateMaster}
+		state.ShamirDir = filepath.Join(t.TempDir(), "shares")
+	})
+
+	// only the passphrase is given again
+	resumed := NewState(false, runner)
+	if err := resumed.SetResumeFromBatchSpec(batchspec.BatchSpec{PassphraseEnv: "TEST_GPG_PASSPHRASE"}); err != nil {
+		t.Fatalf("SetResumeFromBatchSpec() returned error: %v", err)
+	}
+	if err := resumed.ResumeGeneration(state.TmpDir); err != nil {
+		t.Fatalf("ResumeGeneration() returned error: %v", err)
+	}
+
+	if resumed.OutputDir != state.OutputDir || resumed.Shamir != state.Shamir || resumed.ShamirDir != state.ShamirDir {
+		t.Errorf("the resumed run exports to %s with %+v to %s, want %s with %+v to %s",
+			resumed.OutputDir, resumed.Shamir, resumed.ShamirDir, state.OutputDir, state.Shamir, state.ShamirDir)
+	}
+	if _, err := os.Stat(filepath.Join(state.OutputDir, state.TmpDir.PrivateMasterKeyFileName)); err != nil {
+		t.Errorf("the keys were not saved to the output directory of the run: %v", err)
+	}
+	entries, err := os.ReadDir(state.ShamirDir)
+	if err != nil || len(entries) != 3 {
+		t.Errorf("expected 3 shares in the shares directory of the run, got %d (%v)", len(entries), err)
+	}
+}
+
+func TestResumeGenerationRejectsConflictingOutputOptions(t *testing.T) {
+	t.Setenv("TEST_BUNDLE_PASSPHRASE", "another-passphrase")
+	tests := []struct {
+		name      string
+		configure func(state *State)
+		spec      func(state State) batchspec.BatchSpec
+		wantErr   string
+	}{
+		{
+			name:      "same output directory",
+			configure: func(state *State) {},
+			spec:      func(state State) batchspec.BatchSpec { return batchspec.BatchSpec{OutputDir: state.OutputDir + "/"} },
+		},
+		{
+			name:      "other output directory",
+			configure: func(state *State) {},
+			spec: func(state State) batchspec.BatchSpec {
+				return batchspec.BatchSpec{OutputDir: state.OutputDir + "-other"}
+			},
+			wantErr: "--output-dir",
+		},
+		{
+			name:      "paper backup added",
+			configure: func(state *State) {},
+			spec:      func(state State) batchspec.BatchSpec { return batchspec.BatchSpec{PaperBackup: true} },
+			wantErr:   "--paper-backup (the run has no paper backup)",
+		},
+		{
+			name:      "other QR format",
+			configure: func(state *State) { state.QRBackup = qrbackup.Options{Content: qrbackup.Armored, Format: qrbackup.SVG} },
+			spec: func(state State) batchspec.BatchSpec {
+				return batchspec.BatchSpec{QRBackup: "armored", QRFormat: "png"}
+			},
+			wantErr: "(the run uses 'armored as svg')",
+		},
+		{
+			name: "other number of shares",
+			configure: func(state *State) {
+				state.Shamir = shamir.Options{Shares: 3, Threshold: 2, Secret: shamir.PrivateMaster}
+				state.ShamirDir = filepath.Join(filepath.Dir(state.OutputDir), "shares")
+			},
+			spec:    func(state State) batchspec.BatchSpec { return batchspec.BatchSpec{ShamirShares: 5, ShamirThreshold: 3} },
+			wantErr: "(the run uses '2 of 3 shares of the private-master')",
+		},
+		{
+			name:      "bundle added",
+			configure: func(state *State) {},
+			spec: func(state State) batchspec.BatchSpec {
+				return batchspec.BatchSpec{Bundle: true, BundlePassphraseEnv: "TEST_BUNDLE_PASSPHRASE"}
+			},
+			wantErr: "--bundle (the run has no backup bundle)",
+		},
+		{
+			name:      "bundle passphrase missing",
+			configure: func(state *State) { state.Bundle = true },
+			spec:      func(state State) batchspec.BatchSpec { return batchspec.BatchSpec{} },
+			wantErr:   "set its passphrase with --bundle-passphrase-file or --bundle-passphrase-env",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner, state := failedRun(t, tt.configure)
+			spec := tt.spec(state)
+			spec.PassphraseEnv = "TEST_GPG_PASSPHRASE"
+			resumed := NewState(false, runner)
+			if err := resumed.SetResumeFromBatchSpec(spec); err != nil {
+				t.Fatalf("SetResumeFromBatchSpec() returned error: %v", err)
+			}
+			revocations := len(runner.Calls("--gen-revoke"))
+
+			err := resumed.ResumeGeneration(state.TmpDir)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ResumeGeneration() returned error: %v", err)
+				}
+				return
+			}
+			var validation *utils.ValidationError
+			if !errors.As(err, &validation) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ResumeGeneration() returned %v, want a ValidationError containing %q", err, tt.wantErr)
+			}
+			if len(runner.Calls("--gen-revoke")) != revocations {
+				t.Error("the run was resumed despite the conflicting options")
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package tmpdir
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+
+	keyalgorithm "perfect-gpg-keypair/internal/state/key_algorithm"
+	userinfo "perfect-gpg-keypair/internal/state/user_info"
+	utils "perfect-gpg-keypair/internal/utils"
+)
+
+// JournalFileName is the name of the journal in the temporary directory
+const JournalFileName = "journal.yaml"
+
+// journalVersion is written to every journal, to be able to change the format later on
+const journalVersion = 1
+
+// Step is a named step of the generate workflow
+type Step string
+
+// Journal records the completed steps of the generate workflow along with everything needed to resume it,
+// except for the passphrase, which is never written
+type Journal struct {
+	path    string
+	Version int `yaml:"version"`
+	// Key describes the key being generated, as entered or set in the batch spec
+	Key JournalKey `yaml:"key"`
+	// Output describes how the keys are exported, as set when the run started
+	Output JournalOutput `yaml:"output"`
+	// Isolated runs generate the master key in the throwaway keyring inside the temporary directory
+	Isolated           bool              `yaml:"isolated"`
+	MasterFingerprint  string            `yaml:"master_fingerprint,omitempty"`
+	SubkeyFingerprints map[string]string `yaml:"subkey_fingerprints,omitempty"`
+	Completed          []Step            `yaml:"completed"`
+}
+
+type JournalKey struct {
+	Name                  string          `yaml:"name"`
+	Email                 string          `yaml:"email"`
+	Expiry                string          `yaml:"expiry"`
+	Algorithm             string          `yaml:"algorithm"`
+	Subkeys               []JournalSubkey `yaml:"subkeys"`
+	RevocationReason      string          `yaml:"revocation_reason"`
+	RevocationDescription string          `yaml:"revocation_description,omitempty"`
+	AllRevocationReasons  bool            `yaml:"all_revocation_reasons,omitempty"`
+}
+
+type JournalSubkey struct {
+	Usage     string `yaml:"usage"`
+	Algorithm string `yaml:"algorithm"`
+	Expiry    string `yaml:"expiry"`
+}
+
+// JournalOutput are the output options of the run. An empty output or shares directory is asked for when it is needed.
+type JournalOutput struct {
+	Dir             string `yaml:"dir,omitempty"`
+	PaperBackup     bool   `yaml:"paper_backup,omitempty"`
+	QRBackup        string `yaml:"qr_backup,omitempty"`
+	QRFormat        string `yaml:"qr_format,omitempty"`
+	ShamirShares    int    `yaml:"shamir_shares,omitempty"`
+	ShamirThreshold int    `yaml:"shamir_threshold,omitempty"`
+	ShamirSecret    string `yaml:"shamir_secret,omitempty"`
+	ShamirDir       string `yaml:"shamir_dir,omitempty"`
+	Bundle          bool   `yaml:"bundle,omitempty"`
+}
+
+// NewJournal creates the journal of a new run in the temporary directory
+func (tmpDir TmpDir) NewJournal(userInfo userinfo.UserInfo, output JournalOutput, isolated bool) (Journal, error) {
+	journal := Journal{
+		path:    tmpDir.JournalFilePath(),
+		Version: journalVersion,
+		Key: JournalKey{
+			Name:                  userInfo.FullName,
+			Email:                 userInfo.Email,
+			Expiry:                userInfo.Expiry,
+			Algorithm:             userInfo.Algorithm.Name,
+			RevocationReason:      userInfo.Revocation.Reason.String(),
+			RevocationDescription: userInfo.Revocation.Description,
+			AllRevocationReasons:  userInfo.Revocation.AllReasons,
+		},
+		Output:             output,
+		Isolated:           isolated,
+		SubkeyFingerprints: map[string]string{},
+		Completed:          []Step{},
+	}
+	for _, subkey := range userInfo.Subkeys {
+		journal.Key.Subkeys = append(journal.Key.Subkeys, JournalSubkey{
+			Usage:     string(subkey.Usage),
+			Algorithm: subkey.Algorithm.Name(),
+			Expiry:    subkey.Expiry,
+		})
+	}
+	return journal, journal.Save()
+}
+
+// ReadJournal reads the journal of a previous run from the temporary directory
+func (tmpDir TmpDir) ReadJournal() (Journal, error) {
+	journal := Journal{path: tmpDir.JournalFilePath()}
+	contents, err := os.ReadFile(journal.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return journal, fmt.Errorf("'%s' holds no journal of a previous run", tmpDir.Path())
+	}
+	if err != nil {
+		return journal, err
+	}
+	if err := yaml.Unmarshal(contents, &journal); err != nil {
+		return journal, fmt.Errorf("could not parse journal '%s': %w", journal.path, err)
+	}
+	if journal.Version != journalVersion {
+		return journal, fmt.Errorf("journal '%s' has unsupported version %d", journal.path, journal.Version)
+	}
+	if journal.SubkeyFingerprints == nil {
+		journal.SubkeyFingerprints = map[string]string{}
+	}
+	return journal, nil
+}
+
+// HasJournal reports whether the temporary directory holds the journal of a run that can be resumed
+func (tmpDir TmpDir) HasJournal() bool {
+	_, err := os.Stat(tmpDir.JournalFilePath())
+	return err == nil
+}
+
+// Save writes the journal, replacing the previous one atomically
+func (journal Journal) Save() error {
+	contents, err := yaml.Marshal(journal)
+	if err != nil {
+		return err
+	}
+	tmpPath := journal.path + ".tmp"
+	if err := os.WriteFile(tmpPath, contents, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, journal.path)
+}
+
+func (journal Journal) IsCompleted(step Step) bool {
+	return slices.Contains(journal.Completed, step)
+}
+
+// Complete marks the step as completed and saves the journal
+func (journal *Journal) Complete(step Step) error {
+	if !journal.IsCompleted(step) {
+		journal.Completed = append(journal.Completed, step)
+	}
+	return journal.Save()
+}
+
+// UserInfo returns the description of the key being generated
+func (journal Journal) UserInfo() (userinfo.UserInfo, error) {
+	algorithm, err := keyalgorithm.GetProfile(journal.Key.Algorithm)
+	if err != nil {
+		return userinfo.UserInfo{}, err
+	}
+	reason, err := utils.ParseRevocationReason(journal.Key.RevocationReason)
+	if err != nil {
+		return userinfo.UserInfo{}, err
+	}
+	userInfo := userinfo.UserInfo{
+		FullName:  journal.Key.Name,
+		Email:     journal.Key.Email,
+		Expiry:    journal.Key.Expiry,
+		Algorithm: algorithm,
+		Revocation: userinfo.Revocation{
+			Reason:      reason,
+			Description: journal.Key.RevocationDescription,
+			AllReasons:  journal.Key.AllRevocationReasons,
+		},
+	}
+	for _, subkey := range journal.Key.Subkeys {
+		usage := keyalgorithm.Usage(subkey.Usage)
+		spec, err := keyalgorithm.ParseKeySpec(subkey.Algorithm, usage)
+		if err != nil {
+			return userinfo.UserInfo{}, err
+		}
+		userInfo.Subkeys = append(userInfo.Subkeys, userinfo.Subkey{Usage: usage, Algorithm: spec, Expiry: subkey.Expiry})
+	}
+	return userInfo, nil
+}
@@ -0,0 +1,167 @@
+package tmpdir
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	keyalgorithm "perfect-gpg-keypair/internal/state/key_algorithm"
+	userinfo "perfect-gpg-keypair/internal/state/user_info"
+	"perfect-gpg-keypair/internal/utils"
+)
+
+func newTestTmpDir(t *testing.T) TmpDir {
+	t.Helper()
+	tmpDir, err := OpenTmpDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tmpDir
+}
+
+func testUserInfo(t *testing.T) userinfo.UserInfo {
+	t.Helper()
+	algorithm, err := keyalgorithm.GetProfile("ed25519")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signing, err := keyalgorithm.ParseKeySpec("ed25519", keyalgorithm.Sign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryption, err := keyalgorithm.ParseKeySpec("cv25519", keyalgorithm.Encrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return userinfo.UserInfo{
+		FullName:  "Jane Doe",
+		Email:     "jane@example.com",
+		Expiry:    "2y",
+		Algorithm: algorithm,
+		Subkeys: []userinfo.Subkey{
+			{Usage: keyalgorithm.Sign, Algorithm: signing, Expiry: "1y"},
+			{Usage: keyalgorithm.Encrypt, Algorithm: encryption, Expiry: "2y"},
+		},
+		Revocation: userinfo.Revocation{Reason: utils.RevocationCompromised, Description: "lost laptop", AllReasons: true},
+	}
+}
+
+func TestJournalRoundTrip(t *testing.T) {
+	tmpDir := newTestTmpDir(t)
+	userInfo := testUserInfo(t)
+	output := JournalOutput{
+		Dir:             "/mnt/backup",
+		PaperBackup:     true,
+		QRBackup:        "paperkey",
+		QRFormat:        "svg",
+		ShamirShares:    5,
+		ShamirThreshold: 3,
+		ShamirSecret:    "passphrase",
+		ShamirDir:       "/mnt/shares",
+		Bundle:          true,
+	}
+	journal, err := tmpDir.NewJournal(userInfo, output, true)
+	if err != nil {
+		t.Fatalf("NewJournal() returned error: %v", err)
+	}
+	if !tmpDir.HasJournal() {
+		t.Fatal("HasJournal() = false after NewJournal()")
+	}
+	info, err := os.Stat(tmpDir.JournalFilePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("the journal has permissions %o, want 600", info.Mode().Perm())
+	}
+	journal.MasterFingerprint = "0123456789ABCDEF0123456789ABCDEF01234567"
+	journal.SubkeyFingerprints["sign"] = "1111111111111111111111111111111111111111"
+	if err := journal.Complete("generate-master"); err != nil {
+		t.Fatalf("Complete() returned error: %v", err)
+	}
+	if err := journal.Complete("generate-master"); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := tmpDir.ReadJournal()
+	if err != nil {
+		t.Fatalf("ReadJournal() returned error: %v", err)
+	}
+	if !reflect.DeepEqual(read, journal) {
+		t.Errorf("ReadJournal() = %+v, want %+v", read, journal)
+	}
+	if read.Output != output || !read.Isolated {
+		t.Errorf("ReadJournal() returned the output %+v (isolated %v), want %+v", read.Output, read.Isolated, output)
+	}
+	if len(read.Completed) != 1 {
+		t.Errorf("a step completed twice is recorded %d times", len(read.Completed))
+	}
+	restored, err := read.UserInfo()
+	if err != nil {
+		t.Fatalf("UserInfo() returned error: %v", err)
+	}
+	if restored.String() != userInfo.String() || restored.Revocation != userInfo.Revocation {
+		t.Errorf("UserInfo() = %s, want %s", restored.String(), userInfo.String())
+	}
+}
+
+func TestJournalIsCompleted(t *testing.T) {
+	journal := Journal{Completed: []Step{"generate-master", "add-subkeys"}}
+	tests := []struct {
+		step Step
+		want bool
+	}{
+		{step: "generate-master", want: true},
+		{step: "add-subkeys", want: true},
+		{step: "revocation-cert", want: false},
+		{step: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := journal.IsCompleted(tt.step); got != tt.want {
+			t.Errorf("IsCompleted(%q) = %v, want %v", tt.step, got, tt.want)
+		}
+	}
+}
+
+func TestReadJournalRejectsInvalidJournals(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		wantErr  string
+	}{
+		{name: "no journal", wantErr: "holds no journal of a previous run"},
+		{name: "not yaml", contents: "version: [1\n", wantErr: "could not parse journal"},
+		{name: "unsupported version", contents: "version: 2\ncompleted: []\n", wantErr: "unsupported version 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := newTestTmpDir(t)
+			if tt.contents != "" {
+				if err := os.WriteFile(tmpDir.JournalFilePath(), []byte(tt.contents), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := tmpDir.ReadJournal()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ReadJournal() returned %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadJournalWithoutOutput(t *testing.T) {
+	// journals written before the output options were saved resume with the options given again
+	tmpDir := newTestTmpDir(t)
+	contents := "version: 1\nkey:\n  name: Jane Doe\n  algorithm: ed25519\n  revocation_reason: no-reason\nisolated: false\ncompleted: [generate-master]\n"
+	if err := os.WriteFile(tmpDir.JournalFilePath(), []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	journal, err := tmpDir.ReadJournal()
+	if err != nil {
+		t.Fatalf("ReadJournal() returned error: %v", err)
+	}
+	if journal.Output != (JournalOutput{}) || !journal.IsCompleted("generate-master") {
+		t.Errorf("ReadJournal() = %+v", journal)
+	}
+}
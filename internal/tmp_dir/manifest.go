@@ -0,0 +1,139 @@
+package tmpdir
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	keylist "perfect-gpg-keypair/internal/key_list"
+)
+
+const ManifestFileName = "manifest.json"
+
+type ManifestSubkey struct {
+	Fingerprint  string               `json:"fingerprint"`
+	Capabilities []keylist.Capability `json:"capabilities"`
+	Expires      *time.Time           `json:"expires,omitempty"`
+	Revoked      bool                 `json:"revoked,omitempty"`
+}
+
+type ManifestFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest describes the exported keys in an output directory, so the backup can be checked later on
+type Manifest struct {
+	Created     time.Time        `json:"created"`
+	Fingerprint string           `json:"fingerprint"`
+	UserID      string           `json:"user_id"`
+	Expires     *time.Time       `json:"expires,omitempty"`
+	Subkeys     []ManifestSubkey `json:"subkeys"`
+	Files       []ManifestFile   `json:"files"`
+}
+
+// NewManifest creates the manifest of the exported files of the master key
+func NewManifest(master keylist.Key, filePaths []string) (Manifest, error) {
+	manifest := Manifest{
+		Created:     time.Now().UTC().Truncate(time.Second),
+		Fingerprint: master.Fingerprint,
+		UserID:      master.UserID(),
+		Expires:     master.Expires,
+		Subkeys:     []ManifestSubkey{},
+		Files:       []ManifestFile{},
+	}
+	for _, subkey := range master.Subkeys {
+		manifest.Subkeys = append(manifest.Subkeys, ManifestSubkey{
+			Fingerprint:  subkey.Fingerprint,
+			Capabilities: subkey.Capabilities,
+			Expires:      subkey.Expires,
+			Revoked:      subkey.IsRevoked(),
+		})
+	}
+	for _, path := range filePaths {
+		file, err := checksum(path)
+		if err != nil {
+			return manifest, err
+		}
+		manifest.Files = append(manifest.Files, file)
+	}
+	return manifest, nil
+}
+
+func checksum(path string) (ManifestFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	return ManifestFile{Name: filepath.Base(path), Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// Write writes the manifest to the given directory
+func (manifest Manifest) Write(dir string) error {
+	var contents bytes.Buffer
+	encoder := json.NewEncoder(&contents)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return err
+	}
+	return writeFileSynced(filepath.Join(dir, ManifestFileName), contents.Bytes())
+}
+
+// Verify checks the size and checksum of each file of the manifest in the given directory
+func (manifest Manifest) Verify(dir string) error {
+	mismatched := []string{}
+	for _, file := range manifest.Files {
+		actual, err := checksum(filepath.Join(dir, file.Name))
+		if err != nil {
+			return err
+		}
+		if actual != file {
+			mismatched = append(mismatched, file.Name)
+		}
+	}
+	if len(mismatched) > 0 {
+		return fmt.Errorf("checksum does not match the manifest: %s", strings.Join(mismatched, ", "))
+	}
+	return nil
+}
+
+// ReadManifest reads the manifest from the given directory
+func ReadManifest(dir string) (Manifest, error) {
+	var manifest Manifest
+	contents, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		return manifest, err
+	}
+	err = json.Unmarshal(contents, &manifest)
+	return manifest, err
+}
+
+func writeFileSynced(path string, contents []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Chmod(0600); err != nil {
+		return err
+	}
+	if _, err := f.Write(contents); err != nil {
+		return err
+	}
+	return f.Sync()
+}
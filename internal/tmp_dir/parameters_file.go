@@ -26,13 +26,10 @@ func (parameters_file ParametersFile) Create(user_info userinfo.UserInfo) error
 }
 
 func (parameters_file ParametersFile) contents(user_info userinfo.UserInfo) string {
+	algorithm := user_info.Algorithm
 	return fmt.Sprintf(
-		"Key-Type: RSA\n"+
-			"Key-Length: 4096\n"+
+		algorithm.Master.ParameterLines("Key")+
 			"Key-Usage: sign\n"+
-			"Subkey-Type: RSA\n"+
-			"Subkey-Length: 406\n"+
-			"Subkey-Usage: encrypt\n"+
 			"Name-Real: %s\n"+
 			"Name-Email: %s\n"+
 			"Expire-Date: %s\n"+
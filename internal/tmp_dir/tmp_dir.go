@@ -1,49 +1,128 @@
 package tmpdir
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	logger "github.com/sirupsen/logrus"
 
+	keyalgorithm "perfect-gpg-keypair/internal/state/key_algorithm"
 	userinfo "perfect-gpg-keypair/internal/state/user_info"
+	utils "perfect-gpg-keypair/internal/utils"
+	"perfect-gpg-keypair/internal/wipe"
 )
 
 type TmpDir struct {
 	parent                   string
 	name                     string
 	parametersFileName       string
-	statusFileName           string
 	exportedKeysDirName      string
+	sharesDirName            string
+	gnupgHomeDirName         string
+	scratchGnupgHomeDirName  string
 	RevocationCertFileName   string
 	PublicMasterKeyFileName  string
 	PrivateMasterKeyFileName string
 	SigningSubkeyFileName    string
+	EncryptionSubkeyFileName string
+	AuthSubkeyFileName       string
+	PaperBackupTextFileName  string
+	PaperBackupHTMLFileName  string
+	BundleFileName           string
+	bundleTarFileName        string
 }
 
 func NewTmpDir(debug bool) TmpDir {
 	name := "gpg_key_generator_debug"
 	if !debug {
-		name = time.Now().Local().Format("06-02-01-15-04")
+		// the pid tells apart runs started within the same minute, e.g. a new run and the kept directory of a failed one
+		name = fmt.Sprintf("%s-%d", time.Now().Local().Format("06-02-01-15-04"), os.Getpid())
 	}
+	return newTmpDir(ramBackedTempDir(), name)
+}
+
+// OpenTmpDir returns the existing temporary directory of a previous run, e.g. to resume it
+func OpenTmpDir(path string) (TmpDir, error) {
+	absPath, err := filepath.Abs(utils.ExpandHome(path))
+	if err != nil {
+		return TmpDir{}, err
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return TmpDir{}, err
+	}
+	if !info.IsDir() {
+		return TmpDir{}, fmt.Errorf("'%s' is not a directory", path)
+	}
+	return newTmpDir(filepath.Dir(absPath), filepath.Base(absPath)), nil
+}
+
+func newTmpDir(parent string, name string) TmpDir {
 	return TmpDir{
-		parent:                   os.TempDir(),
+		parent:                   parent,
 		name:                     name,
 		parametersFileName:       "parameters",
-		statusFileName:           "status",
 		exportedKeysDirName:      "keys",
+		sharesDirName:            "shares",
+		gnupgHomeDirName:         "gnupg",
+		scratchGnupgHomeDirName:  "scratch-gnupg",
 		RevocationCertFileName:   ".revocation-certification.asc",
 		PublicMasterKeyFileName:  ".public-master.gpg",
 		PrivateMasterKeyFileName: ".private-master.gpg",
 		SigningSubkeyFileName:    ".signing-subkey.gpg",
+		EncryptionSubkeyFileName: ".encryption-subkey.gpg",
+		AuthSubkeyFileName:       ".authentication-subkey.gpg",
+		PaperBackupTextFileName:  ".paper-backup.txt",
+		PaperBackupHTMLFileName:  ".paper-backup.html",
+		BundleFileName:           ".backup-bundle.tar.gpg",
+		bundleTarFileName:        "bundle.tar",
+	}
+}
+
+// ramBackedTempDir returns a directory on a RAM-backed file system if there is a writable one, so that the key material
+// never reaches the disk, where it cannot be reliably overwritten afterwards. Falls back to the default temporary directory.
+func ramBackedTempDir() string {
+	candidates := []string{}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		candidates = append(candidates, runtimeDir)
+	}
+	candidates = append(candidates, "/dev/shm")
+	for _, dir := range candidates {
+		if isWritableDir(dir) {
+			return dir
+		}
+	}
+	logger.Debugln("no RAM-backed temporary directory available, using the default one")
+	return os.TempDir()
+}
+
+func isWritableDir(dir string) bool {
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return false
 	}
+	probe, err := os.CreateTemp(dir, ".probe-")
+	if err != nil {
+		return false
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return true
 }
 
 func (tmpDir TmpDir) Create() error {
 	logger.Debugf("Creating temporary directory at '%s'", tmpDir.Path())
 	for _, dir := range []string{tmpDir.Path(), tmpDir.ExportedKeysDirPath()} {
-		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		// MkdirAll leaves the permissions of a directory left over from a previous (debug) run untouched
+		if err := os.Chmod(dir, 0700); err != nil {
 			return err
 		}
 	}
@@ -58,14 +137,29 @@ func (tmpDir TmpDir) ParametersFilePath() string {
 	return filepath.Join(tmpDir.Path(), tmpDir.parametersFileName)
 }
 
-func (tmpDir TmpDir) StatusFilePath() string {
-	return filepath.Join(tmpDir.Path(), tmpDir.statusFileName)
+func (tmpDir TmpDir) JournalFilePath() string {
+	return filepath.Join(tmpDir.Path(), JournalFileName)
 }
 
 func (tmpDir TmpDir) RevocationCertFilePath() string {
 	return filepath.Join(tmpDir.ExportedKeysDirPath(), tmpDir.RevocationCertFileName)
 }
 
+// RevocationCertFilePaths returns the path of the revocation certificate for each reason to create one for.
+// A single certificate is written to RevocationCertFilePath, otherwise the reason is appended to the file name.
+func (tmpDir TmpDir) RevocationCertFilePaths(revocation userinfo.Revocation) map[utils.RevocationReason]string {
+	if !revocation.AllReasons {
+		return map[utils.RevocationReason]string{revocation.Reason: tmpDir.RevocationCertFilePath()}
+	}
+	paths := map[utils.RevocationReason]string{}
+	extension := filepath.Ext(tmpDir.RevocationCertFileName)
+	for _, reason := range revocation.Reasons() {
+		fileName := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(tmpDir.RevocationCertFileName, extension), reason, extension)
+		paths[reason] = filepath.Join(tmpDir.ExportedKeysDirPath(), fileName)
+	}
+	return paths
+}
+
 func (tmpDir TmpDir) PublicMasterKeyFilePath() string {
 	return filepath.Join(tmpDir.ExportedKeysDirPath(), tmpDir.PublicMasterKeyFileName)
 }
@@ -74,7 +168,30 @@ func (tmpDir TmpDir) PrivateMasterKeyFilePath() string {
 	return filepath.Join(tmpDir.ExportedKeysDirPath(), tmpDir.PrivateMasterKeyFileName)
 }
 
-func (tmpDir TmpDir) SigningSubkeyFilePath() string {
+func (tmpDir TmpDir) PaperBackupTextFilePath() string {
+	return filepath.Join(tmpDir.ExportedKeysDirPath(), tmpDir.PaperBackupTextFileName)
+}
+
+func (tmpDir TmpDir) PaperBackupHTMLFilePath() string {
+	return filepath.Join(tmpDir.ExportedKeysDirPath(), tmpDir.PaperBackupHTMLFileName)
+}
+
+func (tmpDir TmpDir) BundleFilePath() string {
+	return filepath.Join(tmpDir.ExportedKeysDirPath(), tmpDir.BundleFileName)
+}
+
+// BundleTarFilePath is the unencrypted archive of the bundle, outside of the exported keys directory
+func (tmpDir TmpDir) BundleTarFilePath() string {
+	return filepath.Join(tmpDir.Path(), tmpDir.bundleTarFileName)
+}
+
+func (tmpDir TmpDir) SubkeyFilePath(usage keyalgorithm.Usage) string {
+	switch usage {
+	case keyalgorithm.Encrypt:
+		return filepath.Join(tmpDir.ExportedKeysDirPath(), tmpDir.EncryptionSubkeyFileName)
+	case keyalgorithm.Authenticate:
+		return filepath.Join(tmpDir.ExportedKeysDirPath(), tmpDir.AuthSubkeyFileName)
+	}
 	return filepath.Join(tmpDir.ExportedKeysDirPath(), tmpDir.SigningSubkeyFileName)
 }
 
@@ -82,10 +199,233 @@ func (tmpDir TmpDir) ExportedKeysDirPath() string {
 	return filepath.Join(tmpDir.Path(), tmpDir.exportedKeysDirName)
 }
 
+// SharesDirPath is the directory the shares of the master secret or its passphrase are written to,
+// apart from the exported keys so that they are neither saved nor bundled along with them
+func (tmpDir TmpDir) SharesDirPath() string {
+	return filepath.Join(tmpDir.Path(), tmpDir.sharesDirName)
+}
+
+func (tmpDir TmpDir) GnupgHomePath() string {
+	return filepath.Join(tmpDir.Path(), tmpDir.gnupgHomeDirName)
+}
+
+// ScratchGnupgHomePath is the GNUPGHOME backups are test-imported into, separate from the one of GnupgHomePath
+func (tmpDir TmpDir) ScratchGnupgHomePath() string {
+	return filepath.Join(tmpDir.Path(), tmpDir.scratchGnupgHomeDirName)
+}
+
+// CreateGnupgHome creates a throwaway GNUPGHOME inside the temporary directory
+func (tmpDir TmpDir) CreateGnupgHome() error {
+	return createGnupgHome(tmpDir.GnupgHomePath())
+}
+
+// CreateScratchGnupgHome creates an empty throwaway GNUPGHOME for test-importing a backup.
+// Anything left over from a previous test-import is removed.
+func (tmpDir TmpDir) CreateScratchGnupgHome() error {
+	if err := wipe.Dir(tmpDir.ScratchGnupgHomePath()).Err(); err != nil {
+		return err
+	}
+	return createGnupgHome(tmpDir.ScratchGnupgHomePath())
+}
+
+func createGnupgHome(path string) error {
+	logger.Debugf("Creating temporary GNUPGHOME at '%s'", path)
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return err
+	}
+	// passphrases are passed to gpg directly, which requires loopback pinentry
+	agentConf := filepath.Join(path, "gpg-agent.conf")
+	return os.WriteFile(agentConf, []byte("allow-loopback-pinentry\n"), 0600)
+}
+
 func (tmpDir TmpDir) CreateParametersFile(userInfo userinfo.UserInfo) error {
 	return ParametersFile{Path: tmpDir.ParametersFilePath()}.Create(userInfo)
 }
 
-func (tmpDir TmpDir) ReadStatusFileKeyId() (string, error) {
-	return StatusFile{Path: tmpDir.StatusFilePath()}.ReadCreatedKeyId()
+// ExportedKeyFilePaths returns the paths of all files in the exported keys directory
+func (tmpDir TmpDir) ExportedKeyFilePaths() ([]string, error) {
+	entries, err := os.ReadDir(tmpDir.ExportedKeysDirPath())
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			paths = append(paths, filepath.Join(tmpDir.ExportedKeysDirPath(), entry.Name()))
+		}
+	}
+	return paths, nil
+}
+
+// ExistingCopies returns the names of the exported key files and the manifest that already exist in the destination directory,
+// e.g. from an earlier backup
+func (tmpDir TmpDir) ExistingCopies(destination string) ([]string, error) {
+	paths, err := tmpDir.ExportedKeyFilePaths()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, path := range paths {
+		names = append(names, filepath.Base(path))
+	}
+	return existingFiles(destination, append(names, ManifestFileName))
+}
+
+// CopyExportedKeys copies all exported key files to the destination directory,
+// which is created if it does not exist, and returns the paths of the copies.
+// Existing files are only overwritten if overwrite is set.
+func (tmpDir TmpDir) CopyExportedKeys(destination string, overwrite bool) ([]string, error) {
+	logger.Debugf("copying exported keys to '%s'", destination)
+	if err := os.MkdirAll(destination, 0700); err != nil {
+		return nil, err
+	}
+	paths, err := tmpDir.ExportedKeyFilePaths()
+	if err != nil {
+		return nil, err
+	}
+	copies := []string{}
+	for _, path := range paths {
+		copyPath := filepath.Join(destination, filepath.Base(path))
+		if err := copyFile(path, copyPath, overwrite); err != nil {
+			return nil, fmt.Errorf("could not copy '%s': %w", filepath.Base(path), err)
+		}
+		copies = append(copies, copyPath)
+	}
+	return copies, nil
+}
+
+// ExistingShares returns the share files (relative to the destination directory) that already exist in it, e.g. from an earlier split
+func (tmpDir TmpDir) ExistingShares(destination string) ([]string, error) {
+	names, err := tmpDir.shareFileNames()
+	if err != nil {
+		return nil, err
+	}
+	return existingFiles(destination, names)
+}
+
+// shareFileNames returns the share files relative to the shares directory, e.g. 'share-1-of-3/.share-passphrase-1-of-3.yaml'
+func (tmpDir TmpDir) shareFileNames() ([]string, error) {
+	shareDirs, err := os.ReadDir(tmpDir.SharesDirPath())
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, shareDir := range shareDirs {
+		if !shareDir.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(tmpDir.SharesDirPath(), shareDir.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			names = append(names, filepath.Join(shareDir.Name(), entry.Name()))
+		}
+	}
+	return names, nil
+}
+
+// CopyShares copies the directory of each share to the destination directory,
+// which is created if it does not exist, and returns the paths of the copied share files.
+// Existing files are only overwritten if overwrite is set.
+func (tmpDir TmpDir) CopyShares(destination string, overwrite bool) ([]string, error) {
+	logger.Debugf("copying shares to '%s'", destination)
+	names, err := tmpDir.shareFileNames()
+	if err != nil {
+		return nil, err
+	}
+	copies := []string{}
+	for _, name := range names {
+		copyPath := filepath.Join(destination, name)
+		if err := os.MkdirAll(filepath.Dir(copyPath), 0700); err != nil {
+			return nil, err
+		}
+		if err := copyFile(filepath.Join(tmpDir.SharesDirPath(), name), copyPath, overwrite); err != nil {
+			return nil, fmt.Errorf("could not copy '%s': %w", name, err)
+		}
+		copies = append(copies, copyPath)
+	}
+	return copies, nil
+}
+
+// existingFiles returns the names of the files that exist in the directory
+func existingFiles(dir string, names []string) ([]string, error) {
+	existing := []string{}
+	for _, name := range names {
+		_, err := os.Lstat(filepath.Join(dir, name))
+		if err == nil {
+			existing = append(existing, name)
+			continue
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return existing, nil
+}
+
+// VerifyCopies checks that the backup directory holds a copy of each exported key file with the same checksum
+func (tmpDir TmpDir) VerifyCopies(backupDir string) error {
+	paths, err := tmpDir.ExportedKeyFilePaths()
+	if err != nil {
+		return err
+	}
+	missing := []string{}
+	mismatched := []string{}
+	for _, path := range paths {
+		exported, err := checksum(path)
+		if err != nil {
+			return err
+		}
+		backedUp, err := checksum(filepath.Join(backupDir, filepath.Base(path)))
+		if errors.Is(err, os.ErrNotExist) {
+			missing = append(missing, exported.Name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if backedUp != exported {
+			mismatched = append(mismatched, exported.Name)
+		}
+	}
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "missing: "+strings.Join(missing, ", "))
+	}
+	if len(mismatched) > 0 {
+		problems = append(problems, "checksum does not match: "+strings.Join(mismatched, ", "))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("backup in '%s' is incomplete (%s)", backupDir, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// copyFile copies the file, failing if the destination exists unless overwrite is set
+func copyFile(source string, destination string, overwrite bool) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if overwrite {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	out, err := os.OpenFile(destination, flags, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	// the permissions of an existing file are not changed by OpenFile
+	if err := out.Chmod(0600); err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Sync()
 }
@@ -0,0 +1,19 @@
+package utils
+
+import "fmt"
+
+// BackupNotConfirmedError means a backup of the exported keys could not be verified.
+// While generating keys, the master key is not removed from the keyring then.
+type BackupNotConfirmedError struct {
+	// Backup is the backup directory, or the backup file of the master key
+	Backup string
+	Err    error
+}
+
+func (e *BackupNotConfirmedError) Error() string {
+	return fmt.Sprintf("backup '%s' could not be confirmed: %s", e.Backup, e.Err)
+}
+
+func (e *BackupNotConfirmedError) Unwrap() error {
+	return e.Err
+}
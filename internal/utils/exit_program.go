@@ -1,14 +1,102 @@
 package utils
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"slices"
+	"strings"
 
 	logger "github.com/sirupsen/logrus"
 )
 
-func ExitProgram(msg string) {
-	if msg == "" {
-		os.Exit(1)
+// The exit codes of perfect-gpg-keypair, see 'Exit codes' in the README.
+// An error is reported with the code of its most specific cause, e.g. a backup that could not be confirmed
+// because of a bad passphrase exits with ExitBadPassphrase.
+const (
+	ExitError              = 1
+	ExitValidation         = 2
+	ExitGpgNotFound        = 3
+	ExitBadPassphrase      = 4
+	ExitKeyNotFound        = 5
+	ExitBackupNotConfirmed = 6
+	ExitGpgFailed          = 7
+	ExitGpgUnsupported     = 8
+	ExitInterrupted        = 130
+)
+
+// ErrorFormats are the formats errors can be reported in, see SetErrorFormat
+var ErrorFormats = []string{"text", "json"}
+
+var errorFormat = "text"
+
+// SetErrorFormat sets whether ExitProgram logs the error ('text') or writes it to stderr as a JSON object ('json')
+func SetErrorFormat(format string) error {
+	if !slices.Contains(ErrorFormats, format) {
+		return InvalidErrorFormatError(fmt.Sprintf("'%s', must be one of: %s", format, strings.Join(ErrorFormats, ", ")))
+	}
+	errorFormat = format
+	return nil
+}
+
+// ClassifyError returns the kind of the error as reported with '--error-format json', along with its exit code
+func ClassifyError(err error) (string, int) {
+	var (
+		interrupt          *UserInterrupt
+		gpgNotFound        *GpgNotFoundError
+		gpgUnsupported     *GpgUnsupportedError
+		badPassphrase      *BadPassphraseError
+		keyNotFound        *KeyNotFoundError
+		validation         *ValidationError
+		backupNotConfirmed *BackupNotConfirmedError
+		pinentry           *PinentryError
+		agent              *AgentError
+		noData             *NoDataError
+		importErr          *ImportError
+		keyNotCreated      *KeyNotCreatedError
+		gpgErr             *GpgError
+	)
+	switch {
+	case errors.As(err, &interrupt):
+		return "interrupted", ExitInterrupted
+	case errors.As(err, &gpgNotFound):
+		return "gpg_not_found", ExitGpgNotFound
+	case errors.As(err, &gpgUnsupported):
+		return "gpg_unsupported", ExitGpgUnsupported
+	case errors.As(err, &badPassphrase):
+		return "bad_passphrase", ExitBadPassphrase
+	case errors.As(err, &keyNotFound):
+		return "key_not_found", ExitKeyNotFound
+	case errors.As(err, &validation):
+		return "validation", ExitValidation
+	case errors.As(err, &backupNotConfirmed):
+		return "backup_not_confirmed", ExitBackupNotConfirmed
+	case errors.As(err, &pinentry), errors.As(err, &agent), errors.As(err, &noData),
+		errors.As(err, &importErr), errors.As(err, &keyNotCreated), errors.As(err, &gpgErr):
+		return "gpg_failed", ExitGpgFailed
+	}
+	return "error", ExitError
+}
+
+// errorReport is an error as written with '--error-format json'
+type errorReport struct {
+	Error    string `json:"error"`
+	Message  string `json:"message"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// ExitProgram reports the error and exits with its exit code (see ClassifyError).
+// Unlike logger.Fatal, the shutdown hooks are run first.
+func ExitProgram(err error) {
+	kind, code := ClassifyError(err)
+	if errorFormat == "json" {
+		report, _ := json.Marshal(errorReport{Error: kind, Message: err.Error(), ExitCode: code})
+		fmt.Fprintln(os.Stderr, string(report))
+	} else if code == ExitInterrupted {
+		fmt.Printf("SIGINT: %s\n", err.Error())
+	} else {
+		logger.Errorln(err.Error())
 	}
-	logger.Fatalln(msg)
+	Exit(code)
 }
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		kind string
+		code int
+	}{
+		"interrupt":       {&UserInterrupt{}, "interrupted", ExitInterrupted},
+		"gpg not found":   {fmt.Errorf("could not renew: %w", &GpgNotFoundError{}), "gpg_not_found", ExitGpgNotFound},
+		"gpg unsupported": {&GpgUnsupportedError{Feature: "the algorithm 'ed25519'"}, "gpg_unsupported", ExitGpgUnsupported},
+		"bad passphrase":  {&BadPassphraseError{}, "bad_passphrase", ExitBadPassphrase},
+		"key not found":   {fmt.Errorf("could not delete: %w", &KeyNotFoundError{Key: "ABC"}), "key_not_found", ExitKeyNotFound},
+		"validation":      {InvalidExpiryError("ensure expiry is of format '<n>w|m|y'"), "validation", ExitValidation},
+		"backup":          {&BackupNotConfirmedError{Backup: "/backup", Err: errors.New("checksum mismatch")}, "backup_not_confirmed", ExitBackupNotConfirmed},
+		"gpg failure":     {fmt.Errorf("could not export: %w", &GpgError{Command: "--export"}), "gpg_failed", ExitGpgFailed},
+		"pinentry":        {&PinentryError{Launched: true}, "gpg_failed", ExitGpgFailed},
+		"other":           {errors.New("disk full"), "error", ExitError},
+		"specific cause":  {&BackupNotConfirmedError{Backup: "/backup", Err: &BadPassphraseError{}}, "bad_passphrase", ExitBadPassphrase},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			kind, code := ClassifyError(test.err)
+			if kind != test.kind || code != test.code {
+				t.Errorf("ClassifyError() = %q, %d, want %q, %d", kind, code, test.kind, test.code)
+			}
+		})
+	}
+}
+
+func TestSetErrorFormat(t *testing.T) {
+	defer SetErrorFormat("text")
+	if err := SetErrorFormat("json"); err != nil {
+		t.Errorf("SetErrorFormat(json) returned error: %v", err)
+	}
+	var validation *ValidationError
+	if err := SetErrorFormat("yaml"); !errors.As(err, &validation) {
+		t.Errorf("SetErrorFormat(yaml) returned %v, want a ValidationError", err)
+	}
+}
@@ -1,94 +1,195 @@
 package utils
 
 import (
+	"bytes"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
 	logger "github.com/sirupsen/logrus"
+
+	gpgstatus "perfect-gpg-keypair/internal/gpg_status"
+	keylist "perfect-gpg-keypair/internal/key_list"
 )
 
-func CheckGpgIsInstalled() error {
-	logger.Debugln("running: 'which gpg'")
-	cmd := exec.Command("which", "gpg")
-	_, err := cmd.Output()
+// Keyring runs gpg against the GNUPGHOME at HomeDir.
+// An empty HomeDir refers to the default keyring of the user.
+type Keyring struct {
+	HomeDir string
+	// Runner runs the gpg commands, ExecRunner if nil
+	Runner GpgRunner
+	// Capabilities of gpg, see WithCapabilities. If nil, gpg is assumed to support everything.
+	Capabilities *GpgCapabilities
+}
+
+func DefaultKeyring() Keyring {
+	return Keyring{}
+}
+
+func NewKeyring(homeDir string) Keyring {
+	return Keyring{HomeDir: homeDir}
+}
+
+// WithHomeDir returns the keyring at homeDir, run by the same runner and gpg
+func (keyring Keyring) WithHomeDir(homeDir string) Keyring {
+	return Keyring{HomeDir: homeDir, Runner: keyring.Runner, Capabilities: keyring.Capabilities}
+}
+
+func (keyring Keyring) runner() GpgRunner {
+	if keyring.Runner == nil {
+		return ExecRunner{}
+	}
+	return keyring.Runner
+}
+
+func (keyring Keyring) IsDefault() bool {
+	return keyring.HomeDir == ""
+}
+
+// newCommand creates a gpg command against the keyring, which reports its status lines on stderr along with its messages.
+// They are parsed into events when the command is run, see GpgCommandArgs.execute.
+// gpg runs in the C locale (see GpgCommandArgs.toCommand), so the user IDs are passed and printed as UTF-8 explicitly.
+func (keyring Keyring) newCommand(subcommand string) GpgCommandArgs {
+	c := NewGpgCommand(subcommand).withProgram(keyring.gpgProgram()).addOption("--status-fd", "2").
+		addFlag("--utf8-strings").addOption("--display-charset", "utf-8")
+	if !keyring.IsDefault() {
+		c = c.addOption("--homedir", keyring.HomeDir)
+	}
+	return c
+}
+
+// newGpgconfCommand creates a gpgconf command against the keyring
+func (keyring Keyring) newGpgconfCommand(subcommand string) GpgCommandArgs {
+	c := NewGpgconfCommand(subcommand)
+	if !keyring.IsDefault() {
+		c = c.addOption("--homedir", keyring.HomeDir)
+	}
+	return c
+}
+
+// KillAgent stops the gpg-agent serving the keyring
+func (keyring Keyring) KillAgent() error {
+	_, err := keyring.newGpgconfCommand("--kill").addArg("gpg-agent").output(keyring.runner())
 	return err
 }
 
-func ListKeys(secret bool, format string, name string) error {
+func (keyring Keyring) ListKeys(secret bool, format string, name string) error {
 	var c GpgCommandArgs
 	if secret {
-		c = NewGpgCommand("--list-secret-keys").addOption("--keyid-format", format).addArg(name)
+		c = keyring.newCommand("--list-secret-keys").addOption("--keyid-format", format).addArg(name)
 	} else {
-		c = NewGpgCommand("--list-keys").addOption("--keyid-format", format).addArg(name)
-	}
-	cmd := c.toCommand()
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	logger.Debugln(fmt.Sprintf("running: '%s'\n", c.getCommandString()))
-	return cmd.Run()
-}
-
-func DeleteEntireKey(fingerprint string) error {
-	c := NewGpgCommand("--delete-secret-and-public-keys").addFlag("--batch").addFlag("--yes").addArg(fingerprint)
-	cmd := c.toCommand()
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	logger.Debugln(fmt.Sprintf("running: '%s'\n", c.getCommandString()))
-	return cmd.Run()
-}
-
-func DeleteSecretKeys(passphrase string, fingerprint string) error {
-	c := NewGpgCommand("--delete-secret-keys").addFlag("--batch").addFlag("--yes").addPassphrase(passphrase).addArg(fingerprint)
-	cmd := c.toCommand()
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	logger.Debugln(fmt.Sprintf("running: '%s'\n", c.getCommandString()))
-	return cmd.Run()
-}
-
-func GenerateMasterKeypair(passphrase string, statusFilepath string, parametersFilepath string) error {
-	c := NewGpgCommand("--generate-key").addArg("--no-tty").addArg("--batch").addPassphrase(passphrase).addOption("--status-file", statusFilepath).addArg(parametersFilepath)
-	cmd := c.toCommand()
-	logger.Debugln(fmt.Sprintf("running: '%s'\n", c.getCommandString()))
-	_, err := cmd.Output()
-	return err
+		c = keyring.newCommand("--list-keys").addOption("--keyid-format", format).addArg(name)
+	}
+	return c.run(keyring.runner(), os.Stdout, os.Stderr)
 }
 
-func AddSigningSubKey(passphrase string, masterKeyId string, expiry string) error {
-	fingerprint, err := getKeyFingerprint(masterKeyId)
+// GetKeys lists the (secret) keys matching name, or all keys if name is empty, parsed from gpg's colon format
+func (keyring Keyring) GetKeys(secret bool, name string) ([]keylist.Key, error) {
+	subcommand := "--list-keys"
+	if secret {
+		subcommand = "--list-secret-keys"
+	}
+	c := keyring.newCommand(subcommand).addFlag("--with-colons").addFlag("--fixed-list-mode").addFlag("--with-subkey-fingerprint").addFlag("--with-keygrip").addArg(name)
+	out, err := c.output(keyring.runner())
 	if err != nil {
-		return fmt.Errorf("could not get fingerprint for key: %w", err)
+		return nil, err
 	}
-	c := NewGpgCommand("--quick-add-key").addArg("--no-tty").addArg("--batch").addPassphrase(passphrase).addArg(fingerprint).addArg("rsa4096").addArg("sign").addArg(expiry)
-	cmd := c.toCommand()
-	logger.Debugln(fmt.Sprintf("running: '%s'\n", c.getCommandString()))
-	_, err = cmd.Output()
+	return keylist.Parse(bytes.NewReader(out))
+}
+
+func (keyring Keyring) DeleteEntireKey(fingerprint string) error {
+	c := keyring.newCommand("--delete-secret-and-public-keys").addFlag("--batch").addFlag("--yes").addArg(fingerprint)
+	return c.run(keyring.runner(), os.Stdout, os.Stderr)
+}
+
+func (keyring Keyring) DeleteSecretKeys(passphrase string, fingerprint string) error {
+	c := keyring.newCommand("--delete-secret-keys").addFlag("--batch").addFlag("--yes").addPassphrase(passphrase).addArg(fingerprint)
+	return c.run(keyring.runner(), os.Stdout, os.Stderr)
+}
+
+// GenerateMasterKeypair generates the master key described by the parameters file and returns its fingerprint
+func (keyring Keyring) GenerateMasterKeypair(passphrase string, parametersFilepath string) (string, error) {
+	c := keyring.newCommand("--generate-key").addArg("--no-tty").addArg("--batch").addPassphrase(passphrase).addArg(parametersFilepath)
+	events, err := c.execute(keyring.runner(), nil, nil)
+	if err != nil {
+		return "", err
+	}
+	return createdKey(events)
+}
+
+// AddSubKey adds a subkey with the given algorithm and usage ('sign', 'encr' or 'auth') to the master key
+// and returns the fingerprint of the subkey
+func (keyring Keyring) AddSubKey(passphrase string, masterKeyId string, algorithm string, usage string, expiry string) (string, error) {
+	fingerprint, err := keyring.getKeyFingerprint(masterKeyId)
+	if err != nil {
+		return "", fmt.Errorf("could not get fingerprint for key: %w", err)
+	}
+	c := keyring.newCommand("--quick-add-key").addArg("--no-tty").addArg("--batch").addPassphrase(passphrase).addArg(fingerprint).addArg(algorithm).addArg(usage).addArg(expiry)
+	events, err := c.execute(keyring.runner(), nil, nil)
+	if err != nil {
+		return "", err
+	}
+	return createdKey(events)
+}
+
+// createdKey returns the fingerprint of the key reported as created by gpg
+func createdKey(events gpgstatus.Events) (string, error) {
+	fingerprint, ok := events.CreatedKey()
+	if !ok {
+		return "", &KeyNotCreatedError{Message: "gpg reported no created key"}
+	}
+	return fingerprint, nil
+}
+
+// SetExpiry sets the expiry of the master key and, if given, of the subkeys with the given fingerprints.
+// The expiry is relative to now, e.g. '1y', or '0' for no expiry.
+func (keyring Keyring) SetExpiry(passphrase string, masterFingerprint string, expiry string, subkeyFingerprints ...string) error {
+	c := keyring.newCommand("--quick-set-expire").addArg("--no-tty").addArg("--batch").addPassphrase(passphrase).addArg(masterFingerprint).addArg(expiry)
+	if _, err := c.output(keyring.runner()); err != nil {
+		return err
+	}
+	if len(subkeyFingerprints) == 0 {
+		return nil
+	}
+	c = keyring.newCommand("--quick-set-expire").addArg("--no-tty").addArg("--batch").addPassphrase(passphrase).addArg(masterFingerprint).addArg(expiry)
+	for _, subkeyFingerprint := range subkeyFingerprints {
+		c = c.addArg(subkeyFingerprint)
+	}
+	_, err := c.output(keyring.runner())
 	return err
 }
 
-func CreateRevocationCertificate(tmpDir string, passphrase string, outputFilepath string, masterKeyId string) error {
+func (keyring Keyring) CreateRevocationCertificate(
+	tmpDir string, passphrase string, outputFilepath string, masterKeyId string, reason RevocationReason, description string,
+) error {
 	commandFilePath := filepath.Join(tmpDir, ".rev-cert-input")
-	err := createRevocationCertificateCommandFile(commandFilePath)
+	err := createRevocationCertificateCommandFile(commandFilePath, reason, description)
 	if err != nil {
 		return fmt.Errorf("could not create input file: %w", err)
 	}
 	defer os.Remove(commandFilePath)
-	c := NewGpgCommand("--gen-revoke").addArg("--no-tty").addPassphrase(passphrase).addOption("--command-file", commandFilePath).addOutput(outputFilepath).addArg(masterKeyId)
-	cmd := c.toCommand()
-	logger.Debugln(fmt.Sprintf("running: '%s'\n", c.getCommandString()))
-	_, err = cmd.Output()
+	c := keyring.newCommand("--gen-revoke").addArg("--no-tty").addPassphrase(passphrase).addOption("--command-file", commandFilePath).addOutput(outputFilepath).addArg(masterKeyId)
+	_, err = c.output(keyring.runner())
 	return err
 }
 
-func getKeyFingerprint(keyId string) (string, error) {
-	c := NewGpgCommand("--fingerprint").addArg(keyId)
-	cmd := c.toCommand()
+// RevokeSubkey revokes a single subkey of the master key, which must be available in the keyring
+func (keyring Keyring) RevokeSubkey(tmpDir string, passphrase string, masterFingerprint string, subkeyFingerprint string, reason RevocationReason, description string) error {
+	commandFilePath := filepath.Join(tmpDir, ".revoke-subkey-input")
+	err := os.WriteFile(commandFilePath, []byte(revokeSubkeyCommands(subkeyFingerprint, reason, description)), 0600)
+	if err != nil {
+		return fmt.Errorf("could not create input file: %w", err)
+	}
+	defer os.Remove(commandFilePath)
+	c := keyring.newCommand("--edit-key").addArg("--no-tty").addPassphrase(passphrase).addOption("--command-file", commandFilePath).addArg(masterFingerprint)
+	_, err = c.output(keyring.runner())
+	return err
+}
 
-	logger.Debugln(fmt.Sprintf("running: '%s'\n", c.getCommandString()))
-	out, err := cmd.Output()
+func (keyring Keyring) getKeyFingerprint(keyId string) (string, error) {
+	c := keyring.newCommand("--fingerprint").addArg(keyId)
+	out, err := c.output(keyring.runner())
 	if err != nil {
 		return "", err
 	}
@@ -99,8 +200,8 @@ func getKeyFingerprint(keyId string) (string, error) {
 	return strings.Join(strings.Fields(fingerprintLine), " "), nil
 }
 
-func createRevocationCertificateCommandFile(fp string) error {
-	commandFileContents := "y\n1\n\ny\n"
+func createRevocationCertificateCommandFile(fp string, reason RevocationReason, description string) error {
+	commandFileContents := revocationCertificateCommands(reason, description)
 	f, err := os.Create(fp)
 	if err != nil {
 		return err
@@ -113,43 +214,102 @@ func createRevocationCertificateCommandFile(fp string) error {
 	return nil
 }
 
-func ExportPublicMasterKey(masterKeyId string, outputFilepath string) error {
-	c := NewGpgCommand("--export").addArg("--armor").addOutput(outputFilepath).addArg(masterKeyId)
-	cmd := c.toCommand()
-	logger.Debugln(fmt.Sprintf("running: '%s'\n", c.getCommandString()))
-	_, err := cmd.Output()
+func (keyring Keyring) ExportPublicMasterKey(masterKeyId string, outputFilepath string) error {
+	c := keyring.newCommand("--export").addArg("--armor").addOutput(outputFilepath).addArg(masterKeyId)
+	return keyring.export(c, masterKeyId)
+}
+
+func (keyring Keyring) ExportPrivateMasterKey(passphrase string, masterKeyId string, outputFilepath string) error {
+	c := keyring.newCommand("--export-secret-keys").addArg("--armor").addPassphrase(passphrase).addOutput(outputFilepath).addArg(masterKeyId)
+	return keyring.export(c, masterKeyId)
+}
+
+// ExportSubkey exports only the secret part of the given subkey (along with the public master key)
+func (keyring Keyring) ExportSubkey(passphrase string, subkeyFingerprint string, outputFilepath string) error {
+	c := keyring.newCommand("--export-secret-subkeys").addArg("--armor").addPassphrase(passphrase).addOutput(outputFilepath).addArg(subkeyFingerprint + "!")
+	return keyring.export(c, subkeyFingerprint)
+}
+
+// export runs the export command, which gpg reports as successful even if it exported nothing
+func (keyring Keyring) export(c GpgCommandArgs, keyId string) error {
+	events, err := c.execute(keyring.runner(), nil, nil)
 	if err != nil {
 		return err
 	}
+	if events.ExportedCount() == 0 {
+		return &KeyNotFoundError{Key: keyId}
+	}
 	return nil
 }
 
-func ExportPrivateMasterKey(passphrase string, masterKeyId string, outputFilepath string) error {
-	c := NewGpgCommand("--export-secret-keys").addArg("--armor").addPassphrase(passphrase).addOutput(outputFilepath).addArg(masterKeyId)
-	cmd := c.toCommand()
-	logger.Debugln(fmt.Sprintf("running: '%s'\n", c.getCommandString()))
-	_, err := cmd.Output()
+func (keyring Keyring) ImportKey(passphrase string, filePath string) error {
+	c := keyring.newCommand("--import").addPassphrase(passphrase).addArg(filePath)
+	_, err := c.output(keyring.runner())
+	return err
+}
+
+// ImportPublicKey imports a public key, which does not require a passphrase
+func (keyring Keyring) ImportPublicKey(filePath string) error {
+	c := keyring.newCommand("--import").addArg("--batch").addArg(filePath)
+	_, err := c.output(keyring.runner())
+	return err
+}
+
+// ImportRevocationCertificate imports a revocation certificate and returns the fingerprint of the revoked key
+func (keyring Keyring) ImportRevocationCertificate(filePath string) (string, error) {
+	c := keyring.newCommand("--import").addArg("--batch").addArg(filePath)
+	events, err := c.execute(keyring.runner(), nil, nil)
 	if err != nil {
-		return err
+		return "", err
 	}
-	return nil
+	fingerprint, ok := events.ConsideredKey()
+	if !ok {
+		return "", fmt.Errorf("no key found for the revocation certificate")
+	}
+	return fingerprint, nil
 }
 
-func ExportSigningSubkey(passphrase string, masterKeyId string, outputFilepath string) error {
-	c := NewGpgCommand("--export-secret-subkeys").addArg("--armor").addPassphrase(passphrase).addOutput(outputFilepath).addArg(masterKeyId)
-	cmd := c.toCommand()
-	logger.Debugln(fmt.Sprintf("running: '%s'\n", c.getCommandString()))
-	_, err := cmd.Output()
-	if err != nil {
-		return err
+// SetUltimateOwnerTrust marks the key as ultimately trusted, as gpg does for keys generated in the keyring
+func (keyring Keyring) SetUltimateOwnerTrust(tmpDir string, fingerprint string) error {
+	ownerTrustFilePath := filepath.Join(tmpDir, ".ownertrust")
+	if err := os.WriteFile(ownerTrustFilePath, []byte(fmt.Sprintf("%s:6:\n", fingerprint)), 0600); err != nil {
+		return fmt.Errorf("could not create ownertrust file: %w", err)
 	}
-	return nil
+	defer os.Remove(ownerTrustFilePath)
+	c := keyring.newCommand("--import-ownertrust").addArg(ownerTrustFilePath)
+	_, err := c.output(keyring.runner())
+	return err
+}
+
+// CheckPassphrase exports the secret key and discards it, which only succeeds if the passphrase unlocks it
+// (and it is not cached by the gpg-agent). Unlike signing, exporting works whatever the usage or expiry of the key.
+// The export is written to stdout: gpg removes its output file if exporting fails, which would be /dev/null when run as root.
+func (keyring Keyring) CheckPassphrase(passphrase string, fingerprint string) error {
+	c := keyring.newCommand("--export-secret-keys").addArg("--batch").addPassphrase(passphrase).addOutput("-").addArg(fingerprint + "!")
+	return keyring.export(c, fingerprint)
 }
 
-func ImportKey(passphrase string, filePath string) error {
-	c := NewGpgCommand("--import").addPassphrase(passphrase).addArg(filePath)
-	cmd := c.toCommand()
-	logger.Debugln(fmt.Sprintf("running: '%s'\n", c.getCommandString()))
-	_, err := cmd.Output()
+// EncryptSymmetric encrypts the file with the passphrase only (no key), using AES256 and a strong key derivation.
+// The passphrase is not cached by the gpg-agent, unless gpg is too old to support '--no-symkey-cache'.
+func (keyring Keyring) EncryptSymmetric(passphrase string, inputFilePath string, outputFilepath string) error {
+	c := keyring.newCommand("--symmetric").addArg("--batch").addArg("--yes").addArg(keyring.noSymkeyCacheFlag()).
+		addOption("--cipher-algo", "AES256").addOption("--s2k-digest-algo", "SHA512").addOption("--s2k-count", "65011712").
+		addPassphrase(passphrase).addOutput(outputFilepath).addArg(inputFilePath)
+	_, err := c.output(keyring.runner())
 	return err
 }
+
+// DecryptSymmetric decrypts a file that was encrypted with EncryptSymmetric and returns the plaintext
+func (keyring Keyring) DecryptSymmetric(passphrase string, inputFilePath string) ([]byte, error) {
+	c := keyring.newCommand("--decrypt").addArg("--batch").addArg(keyring.noSymkeyCacheFlag()).addPassphrase(passphrase).addArg(inputFilePath)
+	return c.output(keyring.runner())
+}
+
+// noSymkeyCacheFlag returns '--no-symkey-cache' if gpg supports it, or an empty argument, which is not added
+func (keyring Keyring) noSymkeyCacheFlag() string {
+	if !keyring.supports(noSymkeyCacheVersion) {
+		logger.Debugf("gpg is older than %s, the passphrase may be cached by the gpg-agent\n", noSymkeyCacheVersion)
+		return ""
+	}
+	return "--no-symkey-cache"
+}
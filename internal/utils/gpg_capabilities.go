@@ -0,0 +1,267 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// MinGpgVersion is the oldest gpg that has all the commands that are run, e.g. '--quick-set-expire' for subkeys
+const MinGpgVersion = "2.1.22"
+
+// noSymkeyCacheVersion is the first gpg with '--no-symkey-cache', older versions run without it
+const noSymkeyCacheVersion = "2.2.7"
+
+// GpgCapabilities are the features of the installed gpg and the configuration of its gpg-agent
+type GpgCapabilities struct {
+	// Path is the gpg binary that is run
+	Path    string
+	Version string
+	// PublicKeyAlgorithms are the public key algorithms listed by 'gpg --version', e.g. 'RSA' or 'EDDSA'
+	PublicKeyAlgorithms []string
+	// Curves are the elliptic curves gpg supports, e.g. 'ed25519'
+	Curves []string
+	// LoopbackAllowed is set if the gpg-agent accepts the passphrase from gpg ('--pinentry-mode loopback')
+	LoopbackAllowed bool
+	// ExportSSHKey is set if gpg can export the authentication subkey as an SSH public key ('--export-ssh-key')
+	ExportSSHKey bool
+}
+
+// GpgUnsupportedError means the installed gpg (or its gpg-agent) lacks a feature that is needed
+type GpgUnsupportedError struct {
+	Feature string
+	Reason  string
+}
+
+func (e *GpgUnsupportedError) Error() string {
+	return fmt.Sprintf("gpg does not support %s: %s", e.Feature, e.Reason)
+}
+
+// ProbeCapabilities finds the gpg binary and parses 'gpg --version', the supported curves, the options of gpg
+// and the options of the gpg-agent serving the keyring. The gpg listed by gpgconf is probed, which is the one
+// the keyring runs once it has the capabilities (see WithCapabilities).
+func (keyring Keyring) ProbeCapabilities() (GpgCapabilities, error) {
+	capabilities := GpgCapabilities{}
+	out, err := keyring.newGpgconfCommand("--list-components").output(keyring.runner())
+	if errors.Is(err, exec.ErrNotFound) {
+		return capabilities, &GpgNotFoundError{Err: err}
+	}
+	if err != nil {
+		return capabilities, fmt.Errorf("could not list the components of GnuPG: %w", err)
+	}
+	capabilities.Path = parseGpgPath(out)
+	if capabilities.Path == "" {
+		return capabilities, &GpgNotFoundError{Err: errors.New("gpgconf does not list gpg")}
+	}
+
+	keyring.Capabilities = &capabilities
+	out, err = keyring.newCommand("--version").output(keyring.runner())
+	if err != nil {
+		return capabilities, &GpgNotFoundError{Err: err}
+	}
+	capabilities.Version, capabilities.PublicKeyAlgorithms = parseGpgVersion(out)
+	if capabilities.Version == "" {
+		return capabilities, fmt.Errorf("could not parse the output of 'gpg --version'")
+	}
+
+	out, err = keyring.newCommand("--list-config").addFlag("--with-colons").addArg("curve").output(keyring.runner())
+	if err != nil {
+		return capabilities, fmt.Errorf("could not list the curves supported by gpg: %w", err)
+	}
+	capabilities.Curves = parseCurves(out)
+
+	out, err = keyring.newCommand("--dump-options").output(keyring.runner())
+	if err != nil {
+		return capabilities, fmt.Errorf("could not list the options of gpg: %w", err)
+	}
+	capabilities.ExportSSHKey = hasOption(out, "--export-ssh-key")
+
+	out, err = keyring.newGpgconfCommand("--list-options").addArg("gpg-agent").output(keyring.runner())
+	if err != nil {
+		return capabilities, fmt.Errorf("could not list the options of the gpg-agent: %w", err)
+	}
+	capabilities.LoopbackAllowed = parseLoopbackAllowed(out)
+	logger.Debugf("gpg capabilities: %+v\n", capabilities)
+	return capabilities, nil
+}
+
+// WithCapabilities probes the capabilities of gpg and fails if it lacks a feature that is always needed.
+// The returned keyring falls back where gpg lacks an optional feature.
+func (keyring Keyring) WithCapabilities() (Keyring, error) {
+	capabilities, err := keyring.ProbeCapabilities()
+	if err != nil {
+		return keyring, err
+	}
+	if err := capabilities.Check(); err != nil {
+		return keyring, err
+	}
+	keyring.Capabilities = &capabilities
+	return keyring, nil
+}
+
+// Check fails if the gpg is older than MinGpgVersion or its gpg-agent does not accept passphrases from gpg
+func (capabilities GpgCapabilities) Check() error {
+	if !capabilities.AtLeast(MinGpgVersion) {
+		return &GpgUnsupportedError{
+			Feature: "the commands that are run",
+			Reason:  fmt.Sprintf("'%s' is version %s, at least %s is required", capabilities.Path, capabilities.Version, MinGpgVersion),
+		}
+	}
+	if !capabilities.LoopbackAllowed {
+		return &GpgUnsupportedError{
+			Feature: "passing the passphrase to the gpg-agent ('--pinentry-mode loopback')",
+			Reason:  "remove 'no-allow-loopback-pinentry' from gpg-agent.conf and restart it with 'gpgconf --kill gpg-agent'",
+		}
+	}
+	return nil
+}
+
+// CheckExportSSHKey fails if gpg cannot export the authentication subkey as an SSH public key
+func (capabilities GpgCapabilities) CheckExportSSHKey() error {
+	if !capabilities.ExportSSHKey {
+		return &GpgUnsupportedError{
+			Feature: "exporting the authentication subkey for SSH ('--export-ssh-key')",
+			Reason:  fmt.Sprintf("'%s' (version %s) does not have the option", capabilities.Path, capabilities.Version),
+		}
+	}
+	return nil
+}
+
+// AtLeast reports whether gpg is of the given version or newer
+func (capabilities GpgCapabilities) AtLeast(version string) bool {
+	return compareVersions(capabilities.Version, version) >= 0
+}
+
+// SupportsAlgorithm reports whether gpg supports the public key algorithm (as listed by 'gpg --version', e.g. 'EDDSA')
+// and, if given, the curve
+func (capabilities GpgCapabilities) SupportsAlgorithm(algorithm string, curve string) bool {
+	if !slices.Contains(capabilities.PublicKeyAlgorithms, strings.ToUpper(algorithm)) {
+		return false
+	}
+	return curve == "" || slices.Contains(capabilities.Curves, curve)
+}
+
+// gpgProgram returns the gpg binary the keyring runs, the probed one if any or 'gpg' from the PATH otherwise
+func (keyring Keyring) gpgProgram() string {
+	if keyring.Capabilities == nil || keyring.Capabilities.Path == "" {
+		return "gpg"
+	}
+	return keyring.Capabilities.Path
+}
+
+// supports reports whether the keyring's gpg is of the given version or newer, assuming it is if it was not probed
+func (keyring Keyring) supports(version string) bool {
+	return keyring.Capabilities == nil || keyring.Capabilities.AtLeast(version)
+}
+
+// parseGpgPath returns the path of gpg from the output of 'gpgconf --list-components', e.g. 'gpg:OpenPGP:/usr/bin/gpg'
+func parseGpgPath(out []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) >= 3 && fields[0] == "gpg" {
+			return fields[2]
+		}
+	}
+	return ""
+}
+
+// parseGpgVersion returns the version and the public key algorithms from the output of 'gpg --version':
+//
+//	gpg (GnuPG) 2.2.40
+//	...
+//	Pubkey: RSA, ELG, DSA, ECDH, ECDSA, EDDSA
+func parseGpgVersion(out []byte) (string, []string) {
+	version := ""
+	algorithms := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if fields := strings.Fields(line); version == "" && len(fields) >= 3 && fields[0] == "gpg" {
+			version = fields[len(fields)-1]
+		}
+		if pubkeys, ok := strings.CutPrefix(line, "Pubkey:"); ok {
+			for _, algorithm := range strings.Split(pubkeys, ",") {
+				algorithms = append(algorithms, strings.TrimSpace(algorithm))
+			}
+		}
+	}
+	return version, algorithms
+}
+
+// parseCurves returns the curves from the output of 'gpg --list-config --with-colons curve', e.g. 'cfg:curve:cv25519;ed25519'
+func parseCurves(out []byte) []string {
+	curves := []string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if list, ok := strings.CutPrefix(line, "cfg:curve:"); ok {
+			curves = append(curves, strings.Split(strings.TrimSpace(list), ";")...)
+		}
+	}
+	return curves
+}
+
+// hasOption reports whether the output of 'gpg --dump-options', one option per line, lists the option
+func hasOption(out []byte, option string) bool {
+	return slices.Contains(strings.Split(string(out), "\n"), option)
+}
+
+// parseLoopbackAllowed reads the loopback option from the output of 'gpgconf --list-options gpg-agent'.
+// Its fields are 'name:flags:level:description:type:alt-type:argname:default:argdef:value', the value is set if the option is.
+// gpg-agent 2.1.12 and later allow loopback unless 'no-allow-loopback-pinentry' is set, older ones only with 'allow-loopback-pinentry'.
+func parseLoopbackAllowed(out []byte) bool {
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) < 10 {
+			continue
+		}
+		set := strings.TrimSpace(fields[9]) != ""
+		switch fields[0] {
+		case "no-allow-loopback-pinentry":
+			return !set
+		case "allow-loopback-pinentry":
+			return set
+		}
+	}
+	return true
+}
+
+// compareVersions compares dotted versions like '2.2.40', ignoring suffixes like '-beta'
+func compareVersions(a string, b string) int {
+	partsA, partsB := versionParts(a), versionParts(b)
+	for i := 0; i < max(len(partsA), len(partsB)); i++ {
+		var partA, partB int
+		if i < len(partsA) {
+			partA = partsA[i]
+		}
+		if i < len(partsB) {
+			partB = partsB[i]
+		}
+		if partA != partB {
+			return partA - partB
+		}
+	}
+	return 0
+}
+
+func versionParts(version string) []int {
+	parts := []int{}
+	for _, field := range strings.Split(version, ".") {
+		digits := field
+		if i := strings.IndexFunc(field, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+			digits = field[:i]
+		}
+		part, err := strconv.Atoi(digits)
+		if err != nil {
+			break
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
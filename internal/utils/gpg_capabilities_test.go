@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"testing"
+)
+
+const testGpgVersionOutput = `gpg (GnuPG) 2.2.40
+libgcrypt 1.10.1
+Copyright (C) 2022 g10 Code GmbH
+
+Home: /home/jane/.gnupg
+Supported algorithms:
+Pubkey: RSA, ELG, DSA, ECDH, ECDSA, EDDSA
+Cipher: IDEA, 3DES, CAST5, BLOWFISH, AES, AES192, AES256, TWOFISH,
+        CAMELLIA128, CAMELLIA192, CAMELLIA256
+Hash: SHA1, RIPEMD160, SHA256, SHA384, SHA512, SHA224
+Compression: Uncompressed, ZIP, ZLIB, BZIP2
+`
+
+func TestParseGpgVersion(t *testing.T) {
+	version, algorithms := parseGpgVersion([]byte(testGpgVersionOutput))
+	if version != "2.2.40" {
+		t.Errorf("version = %q, want 2.2.40", version)
+	}
+	if want := []string{"RSA", "ELG", "DSA", "ECDH", "ECDSA", "EDDSA"}; !slices.Equal(algorithms, want) {
+		t.Errorf("algorithms = %v, want %v", algorithms, want)
+	}
+}
+
+func TestParseGpgPathAndCurves(t *testing.T) {
+	path := parseGpgPath([]byte("gpg:OpenPGP:/usr/bin/gpg\ngpgsm:S/MIME:/usr/bin/gpgsm\ngpg-agent:Private Keys:/usr/bin/gpg-agent\n"))
+	if path != "/usr/bin/gpg" {
+		t.Errorf("path = %q, want /usr/bin/gpg", path)
+	}
+	curves := parseCurves([]byte("cfg:curve:cv25519;ed25519;nistp256;nistp384\n"))
+	if want := []string{"cv25519", "ed25519", "nistp256", "nistp384"}; !slices.Equal(curves, want) {
+		t.Errorf("curves = %v, want %v", curves, want)
+	}
+}
+
+func TestParseLoopbackAllowed(t *testing.T) {
+	tests := map[string]struct {
+		output string
+		want   bool
+	}{
+		"default":           {"no-allow-loopback-pinentry:8:2:disallow caller to override the pinentry:0:0::::\n", true},
+		"disallowed":        {"no-allow-loopback-pinentry:8:2:disallow caller to override the pinentry:0:0::::1\n", false},
+		"old agent":         {"allow-loopback-pinentry:8:2:allow caller to override the pinentry:0:0::::\n", false},
+		"old agent allowed": {"allow-loopback-pinentry:8:2:allow caller to override the pinentry:0:0::::1\n", true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := parseLoopbackAllowed([]byte(test.output)); got != test.want {
+				t.Errorf("parseLoopbackAllowed() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCapabilitiesCheck(t *testing.T) {
+	capabilities := GpgCapabilities{Path: "/usr/bin/gpg", Version: "2.2.40", LoopbackAllowed: true}
+	if err := capabilities.Check(); err != nil {
+		t.Errorf("Check() returned error: %v", err)
+	}
+	var unsupported *GpgUnsupportedError
+	for _, tooOld := range []string{"2.1.21", "2.0.30", "1.4.23"} {
+		capabilities.Version = tooOld
+		if err := capabilities.Check(); !errors.As(err, &unsupported) {
+			t.Errorf("Check() of gpg %s returned %v, want a GpgUnsupportedError", tooOld, err)
+		}
+	}
+	capabilities.Version = "2.4.4-unknown"
+	capabilities.LoopbackAllowed = false
+	if err := capabilities.Check(); !errors.As(err, &unsupported) {
+		t.Errorf("Check() without loopback returned %v, want a GpgUnsupportedError", err)
+	}
+}
+
+func TestSymmetricEncryptionFallsBackWithoutNoSymkeyCache(t *testing.T) {
+	keyring := Keyring{Capabilities: &GpgCapabilities{Version: "2.2.6"}}
+	if flag := keyring.noSymkeyCacheFlag(); flag != "" {
+		t.Errorf("noSymkeyCacheFlag() of gpg 2.2.6 = %q, want none", flag)
+	}
+	keyring.Capabilities.Version = "2.2.7"
+	if flag := keyring.noSymkeyCacheFlag(); flag != "--no-symkey-cache" {
+		t.Errorf("noSymkeyCacheFlag() of gpg 2.2.7 = %q, want --no-symkey-cache", flag)
+	}
+}
+
+// probeRunner answers the commands of the capability probe as the gpg at /opt/gnupg/bin/gpg, and records the programs it runs
+type probeRunner struct {
+	dumpOptions string
+	programs    *[]string
+}
+
+func (runner probeRunner) Run(command GpgCommandArgs, stdout io.Writer, stderr io.Writer) error {
+	*runner.programs = append(*runner.programs, command.Program())
+	answers := map[string]string{
+		"--list-components": "gpg:OpenPGP:/opt/gnupg/bin/gpg\n",
+		"--version":         testGpgVersionOutput,
+		"--list-config":     "cfg:curve:cv25519;ed25519\n",
+		"--dump-options":    runner.dumpOptions,
+		"--list-options":    "no-allow-loopback-pinentry:8:2:disallow caller to override the pinentry:0:0::::\n",
+	}
+	io.WriteString(stdout, answers[command.Args()[0]])
+	return nil
+}
+
+func TestProbeCapabilities(t *testing.T) {
+	tests := map[string]struct {
+		dumpOptions  string
+		exportSSHKey bool
+	}{
+		"with --export-ssh-key":    {dumpOptions: "--sign\n--export-ssh-key\n--version\n", exportSSHKey: true},
+		"without --export-ssh-key": {dumpOptions: "--sign\n--export-ssh-keys-for\n--version\n", exportSSHKey: false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			programs := []string{}
+			keyring, err := Keyring{Runner: probeRunner{dumpOptions: test.dumpOptions, programs: &programs}}.WithCapabilities()
+			if err != nil {
+				t.Fatalf("WithCapabilities() returned error: %v", err)
+			}
+			if keyring.Capabilities.ExportSSHKey != test.exportSSHKey {
+				t.Errorf("ExportSSHKey = %v, want %v", keyring.Capabilities.ExportSSHKey, test.exportSSHKey)
+			}
+			if err := keyring.Capabilities.CheckExportSSHKey(); (err == nil) != test.exportSSHKey {
+				t.Errorf("CheckExportSSHKey() returned %v", err)
+			}
+			// the gpg listed by gpgconf is probed and run, not the first gpg in the PATH
+			want := []string{"gpgconf", "/opt/gnupg/bin/gpg", "/opt/gnupg/bin/gpg", "/opt/gnupg/bin/gpg", "gpgconf"}
+			if !slices.Equal(programs, want) {
+				t.Errorf("the probe ran %v, want %v", programs, want)
+			}
+			if program := keyring.newCommand("--list-keys").Program(); program != "/opt/gnupg/bin/gpg" {
+				t.Errorf("the keyring runs %s, want /opt/gnupg/bin/gpg", program)
+			}
+		})
+	}
+}
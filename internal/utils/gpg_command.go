@@ -1,26 +1,65 @@
 package utils
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
 	"os/exec"
-	"regexp"
 	"slices"
 	"strings"
+
+	logger "github.com/sirupsen/logrus"
+
+	gpgstatus "perfect-gpg-keypair/internal/gpg_status"
 )
 
+// passphraseFd is the file descriptor gpg reads the passphrase from.
+// exec.Cmd passes ExtraFiles[0] as file descriptor 3.
+const passphraseFd = "3"
+
 type GpgCommandArgs struct {
-	args []string
+	program    string
+	args       []string
+	passphrase string
 }
 
 func NewGpgCommand(subcommand string) GpgCommandArgs {
-	return GpgCommandArgs{[]string{subcommand}}
+	return GpgCommandArgs{program: "gpg", args: []string{subcommand}}
+}
+
+// withProgram returns the command run with the given binary, e.g. the absolute path of gpg
+func (c GpgCommandArgs) withProgram(program string) GpgCommandArgs {
+	c.program = program
+	return c
+}
+
+func NewGpgconfCommand(subcommand string) GpgCommandArgs {
+	return GpgCommandArgs{program: "gpgconf", args: []string{subcommand}}
+}
+
+// Program returns the program that is run, 'gpg' (or the path of the probed gpg, see Keyring.ProbeCapabilities) or 'gpgconf'
+func (c GpgCommandArgs) Program() string {
+	return c.program
+}
+
+// Args returns the arguments of the command. The passphrase is never among them, see Passphrase.
+func (c GpgCommandArgs) Args() []string {
+	return slices.Clone(c.args)
+}
+
+// Passphrase returns the passphrase that is passed to gpg on a separate file descriptor, if any
+func (c GpgCommandArgs) Passphrase() string {
+	return c.passphrase
 }
 
 func (c GpgCommandArgs) hasPassphrase() bool {
-	return slices.Contains(c.args, "--passphrase")
+	return c.passphrase != ""
 }
 
 func (c GpgCommandArgs) append(a ...string) GpgCommandArgs {
-	return GpgCommandArgs{append(c.args, a...)}
+	c.args = append(slices.Clip(c.args), a...)
+	return c
 }
 
 func (c GpgCommandArgs) addFlag(flag string) GpgCommandArgs {
@@ -38,23 +77,79 @@ func (c GpgCommandArgs) addOption(option string, arg string) GpgCommandArgs {
 	return c.append([]string{option, arg}...)
 }
 
+// addPassphrase makes gpg read the passphrase from a pipe instead of the command line,
+// where it would be visible to every user (e.g. in /proc/<pid>/cmdline)
 func (c GpgCommandArgs) addPassphrase(passphrase string) GpgCommandArgs {
-	return c.addOption("--pinentry", "loopback").addOption("--passphrase", passphrase)
+	c = c.addOption("--pinentry-mode", "loopback").addOption("--passphrase-fd", passphraseFd)
+	c.passphrase = passphrase
+	return c
 }
 
 func (c GpgCommandArgs) addOutput(outputFilepath string) GpgCommandArgs {
 	return c.addOption("--output", outputFilepath)
 }
 
-func (c GpgCommandArgs) toCommand() *exec.Cmd {
-	return exec.Command("gpg", c.args...)
+// toCommand creates the command. If a passphrase is set, it is written to a pipe
+// that is passed on to gpg, the read end of which must be closed by the caller once the command has finished.
+// The messages of gpg are not translated (LC_ALL=C), as some failures are only reported by them, see gpgFailure.
+func (c GpgCommandArgs) toCommand() (*exec.Cmd, error) {
+	cmd := exec.Command(c.program, c.args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	if c.hasPassphrase() {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, fmt.Errorf("could not create passphrase pipe: %w", err)
+		}
+		defer w.Close()
+		if _, err := io.WriteString(w, c.passphrase+"\n"); err != nil {
+			r.Close()
+			return nil, fmt.Errorf("could not write passphrase to pipe: %w", err)
+		}
+		cmd.ExtraFiles = []*os.File{r}
+	}
+	return cmd, nil
 }
 
-func (c GpgCommandArgs) getCommandString() string {
-	out := "gpg " + strings.Join(c.args, " ")
-	if c.hasPassphrase() {
-		re := regexp.MustCompile(`(--passphrase) ([^\s]+)`)
-		return re.ReplaceAllString(out, `$1 XXXXX`)
+func closeExtraFiles(cmd *exec.Cmd) {
+	for _, f := range cmd.ExtraFiles {
+		f.Close()
 	}
-	return out
+}
+
+// run runs the gpg command with the given stdout and stderr, to which the messages of gpg are written once it has finished
+func (c GpgCommandArgs) run(runner GpgRunner, stdout io.Writer, stderr io.Writer) error {
+	_, err := c.execute(runner, stdout, stderr)
+	return err
+}
+
+// output runs the gpg command and returns its standard output
+func (c GpgCommandArgs) output(runner GpgRunner) ([]byte, error) {
+	var stdout bytes.Buffer
+	_, err := c.execute(runner, &stdout, nil)
+	return stdout.Bytes(), err
+}
+
+// execute runs the gpg command and returns the status events it reported on stderr (see Keyring.newCommand).
+// If the command fails, the events and messages of gpg are mapped to a typed error.
+func (c GpgCommandArgs) execute(runner GpgRunner, stdout io.Writer, stderr io.Writer) (gpgstatus.Events, error) {
+	var statusAndMessages bytes.Buffer
+	logger.Debugln(fmt.Sprintf("running: '%s'\n", c.getCommandString()))
+	err := runner.Run(c, stdout, &statusAndMessages)
+	events, messages := gpgstatus.Parse(statusAndMessages.Bytes())
+	if stderr != nil {
+		for _, line := range strings.SplitAfter(statusAndMessages.String(), "\n") {
+			if line != "" && !strings.HasPrefix(line, gpgstatus.Prefix) {
+				io.WriteString(stderr, line)
+			}
+		}
+	}
+	if err != nil {
+		logger.Debugf("'%s' failed: %s\n%s\n", c.getCommandString(), err, statusAndMessages.String())
+		return events, gpgFailure(c.args[0], events, messages, err)
+	}
+	return events, nil
+}
+
+func (c GpgCommandArgs) getCommandString() string {
+	return c.program + " " + strings.Join(c.args, " ")
 }
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testPassphrase = "correct-horse-battery-staple"
+
+func TestAddPassphraseKeepsPassphraseOutOfArgs(t *testing.T) {
+	c := NewGpgCommand("--export-secret-keys").addArg("--armor").addPassphrase(testPassphrase).addArg("ABCDEF")
+	cmd, err := c.toCommand()
+	if err != nil {
+		t.Fatalf("toCommand() returned error: %v", err)
+	}
+	defer closeExtraFiles(cmd)
+
+	for _, arg := range cmd.Args {
+		if strings.Contains(arg, testPassphrase) {
+			t.Errorf("command argument %q contains the passphrase", arg)
+		}
+	}
+	if strings.Contains(c.getCommandString(), testPassphrase) {
+		t.Errorf("command string %q contains the passphrase", c.getCommandString())
+	}
+	if len(cmd.ExtraFiles) != 1 {
+		t.Fatalf("expected 1 extra file, got %d", len(cmd.ExtraFiles))
+	}
+	got, err := io.ReadAll(cmd.ExtraFiles[0])
+	if err != nil {
+		t.Fatalf("could not read passphrase pipe: %v", err)
+	}
+	if string(got) != testPassphrase+"\n" {
+		t.Errorf("passphrase pipe contains %q, want %q", got, testPassphrase+"\n")
+	}
+}
+
+func TestCommandWithoutPassphraseHasNoExtraFiles(t *testing.T) {
+	cmd, err := NewGpgCommand("--list-keys").toCommand()
+	if err != nil {
+		t.Fatalf("toCommand() returned error: %v", err)
+	}
+	if len(cmd.ExtraFiles) != 0 {
+		t.Errorf("expected no extra files, got %d", len(cmd.ExtraFiles))
+	}
+	if !slices.Contains(cmd.Env, "LC_ALL=C") {
+		t.Error("expected gpg to run in the C locale")
+	}
+}
+
+// fakeGpgScript records its arguments and whatever it reads on the passphrase file descriptor
+const fakeGpgScript = `#!/bin/sh
+printf '%s\n' "$@" >> "$FAKE_GPG_ARGS_LOG"
+cat 2>/dev/null <&3 >> "$FAKE_GPG_PASSPHRASE_LOG"
+echo "pub   ed25519 2024-01-01 [SC]"
+echo "      0123 4567 89AB CDEF 0123  4567 89AB CDEF 0123 4567"
+echo "[GNUPG:] KEY_CREATED P 0123456789ABCDEF0123456789ABCDEF01234567" >&2
+`
+
+func installFakeGpg(t *testing.T) (argsLog string, passphraseLog string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake gpg script requires a POSIX shell")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "gpg"), []byte(fakeGpgScript), 0700); err != nil {
+		t.Fatal(err)
+	}
+	argsLog = filepath.Join(dir, "args.log")
+	passphraseLog = filepath.Join(dir, "passphrase.log")
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_GPG_ARGS_LOG", argsLog)
+	t.Setenv("FAKE_GPG_PASSPHRASE_LOG", passphraseLog)
+	return argsLog, passphraseLog
+}
+
+func TestGpgFunctionsNeverPassPassphraseAsArgument(t *testing.T) {
+	fingerprint := "0123456789ABCDEF0123456789ABCDEF01234567"
+	tests := map[string]func(dir string) error{
+		"DeleteSecretKeys": func(dir string) error {
+			return DefaultKeyring().DeleteSecretKeys(testPassphrase, fingerprint)
+		},
+		"GenerateMasterKeypair": func(dir string) error {
+			_, err := DefaultKeyring().GenerateMasterKeypair(testPassphrase, filepath.Join(dir, "parameters"))
+			return err
+		},
+		"AddSubKey": func(dir string) error {
+			_, err := DefaultKeyring().AddSubKey(testPassphrase, fingerprint, "ed25519", "sign", "1y")
+			return err
+		},
+		"CreateRevocationCertificate": func(dir string) error {
+			return DefaultKeyring().CreateRevocationCertificate(dir, testPassphrase, filepath.Join(dir, "rev.asc"), fingerprint, RevocationCompromised, "")
+		},
+		"ExportPrivateMasterKey": func(dir string) error {
+			return DefaultKeyring().ExportPrivateMasterKey(testPassphrase, fingerprint, filepath.Join(dir, "private.gpg"))
+		},
+		"ExportSubkey": func(dir string) error {
+			return DefaultKeyring().ExportSubkey(testPassphrase, fingerprint, filepath.Join(dir, "subkey.gpg"))
+		},
+		"ImportKey": func(dir string) error {
+			return DefaultKeyring().ImportKey(testPassphrase, filepath.Join(dir, "subkey.gpg"))
+		},
+	}
+
+	for name, call := range tests {
+		t.Run(name, func(t *testing.T) {
+			argsLog, passphraseLog := installFakeGpg(t)
+			if err := call(t.TempDir()); err != nil {
+				t.Fatalf("%s returned error: %v", name, err)
+			}
+
+			args, err := os.ReadFile(argsLog)
+			if err != nil {
+				t.Fatalf("fake gpg was not called: %v", err)
+			}
+			if strings.Contains(string(args), testPassphrase) {
+				t.Errorf("gpg arguments contain the passphrase:\n%s", args)
+			}
+			if !strings.Contains(string(args), "--passphrase-fd\n"+passphraseFd+"\n") {
+				t.Errorf("gpg arguments do not contain '--passphrase-fd %s':\n%s", passphraseFd, args)
+			}
+
+			passphrase, err := os.ReadFile(passphraseLog)
+			if err != nil {
+				t.Fatalf("could not read passphrase log: %v", err)
+			}
+			if string(passphrase) != testPassphrase+"\n" {
+				t.Errorf("gpg read %q from the passphrase file descriptor, want %q", passphrase, testPassphrase+"\n")
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	gpgstatus "perfect-gpg-keypair/internal/gpg_status"
+)
+
+// GpgNotFoundError means gpg is not installed, or not in the PATH
+type GpgNotFoundError struct {
+	Err error
+}
+
+func (e *GpgNotFoundError) Error() string {
+	return "gpg command could not be found, install GnuPG and make sure 'gpg' is in your PATH"
+}
+
+func (e *GpgNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// BadPassphraseError means the passphrase does not unlock the secret key
+type BadPassphraseError struct {
+	// KeyID is the key the passphrase was tried on, if reported by gpg
+	KeyID string
+}
+
+func (e *BadPassphraseError) Error() string {
+	if e.KeyID != "" {
+		return fmt.Sprintf("bad passphrase: it does not unlock the key '%s', check for typos and the keyboard layout", e.KeyID)
+	}
+	return "bad passphrase: it does not unlock the key, check for typos and the keyboard layout"
+}
+
+// PinentryError means gpg could not get the passphrase, which is passed to it with the loopback pinentry
+type PinentryError struct {
+	// Launched is set if the gpg-agent launched a pinentry instead of using the passphrase passed to gpg
+	Launched bool
+	Message  string
+}
+
+func (e *PinentryError) Error() string {
+	if e.Launched {
+		return "the gpg-agent asked for the passphrase with a pinentry instead of accepting it from perfect-gpg-keypair, " +
+			"remove 'no-allow-loopback-pinentry' from gpg-agent.conf and restart it with 'gpgconf --kill gpg-agent'"
+	}
+	return fmt.Sprintf("gpg could not get the passphrase: %s", e.Message)
+}
+
+// KeyNotFoundError means the key is not in the keyring, or its secret part is missing or unusable
+type KeyNotFoundError struct {
+	Key     string
+	Message string
+}
+
+func (e *KeyNotFoundError) Error() string {
+	if e.Key != "" {
+		return fmt.Sprintf("key '%s' not found in the keyring (check the fingerprint with 'list --secret')", e.Key)
+	}
+	return fmt.Sprintf("key not found in the keyring: %s (check the fingerprint with 'list --secret')", e.Message)
+}
+
+// NoDataError means the file given to gpg does not hold any OpenPGP data
+type NoDataError struct {
+	Message string
+}
+
+func (e *NoDataError) Error() string {
+	return fmt.Sprintf("no valid OpenPGP data found, is it the right file? (%s)", e.Message)
+}
+
+// ImportError means gpg refused to import a key
+type ImportError struct {
+	Reason string
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("could not import the key: %s", e.Reason)
+}
+
+// KeyNotCreatedError means gpg did not create the key, e.g. because the algorithm is not supported
+type KeyNotCreatedError struct {
+	Message string
+}
+
+func (e *KeyNotCreatedError) Error() string {
+	return fmt.Sprintf("gpg did not create the key: %s", e.Message)
+}
+
+// AgentError means gpg could not use the gpg-agent
+type AgentError struct {
+	Message string
+}
+
+func (e *AgentError) Error() string {
+	return fmt.Sprintf("could not use the gpg-agent: %s (is it installed and is the GNUPGHOME writable?)", e.Message)
+}
+
+// GpgError is a failed gpg command that is not mapped to a more specific error
+type GpgError struct {
+	// Command is the gpg command, e.g. '--export-secret-keys'
+	Command string
+	// Location and Code are reported by the last ERROR or FAILURE status line, if any
+	Location string
+	Code     int
+	// Message is the last message gpg printed, if any
+	Message string
+	Err     error
+}
+
+func (e *GpgError) Error() string {
+	msg := fmt.Sprintf("gpg %s failed", e.Command)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	} else if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if e.Location != "" {
+		msg += fmt.Sprintf(" (%s, error code %d)", e.Location, e.Code)
+	}
+	return msg
+}
+
+func (e *GpgError) Unwrap() error {
+	return e.Err
+}
+
+// importProblems are the reasons of IMPORT_PROBLEM status lines
+var importProblems = map[string]string{
+	"0": "unknown problem",
+	"1": "invalid certificate",
+	"2": "issuer certificate missing",
+	"3": "certificate chain too long",
+	"4": "error storing certificate",
+}
+
+// gpgFailure maps the status events of a failed gpg command to a typed error. The messages only describe the error,
+// except for a bad passphrase on '--import', which gpg reports without a status line. gpg runs in the C locale
+// (see GpgCommandArgs.toCommand), so the message is not translated.
+func gpgFailure(command string, events gpgstatus.Events, messages []string, err error) error {
+	message := ""
+	if len(messages) > 0 {
+		message = messages[len(messages)-1]
+	}
+	keyID, _ := events.ConsideredKey()
+	switch {
+	case events.Has(gpgstatus.PinentryLaunched):
+		return &PinentryError{Launched: true, Message: message}
+	case events.Has(gpgstatus.BadPassphrase):
+		event, _ := events.Last(gpgstatus.BadPassphrase)
+		return &BadPassphraseError{KeyID: event.Arg(0)}
+	case events.HasCode(gpgstatus.CodeBadPassphrase) || containsMessage(messages, ": Bad passphrase"):
+		return &BadPassphraseError{KeyID: keyID}
+	case events.Has(gpgstatus.MissingPassphrase) || events.HasCode(gpgstatus.CodeNoPinentry, gpgstatus.CodeCanceled, gpgstatus.CodeNoPassphrase):
+		return &PinentryError{Message: message}
+	case events.HasCode(gpgstatus.CodeNoAgent, gpgstatus.CodeAgent):
+		return &AgentError{Message: message}
+	case events.Has(gpgstatus.NoData):
+		return &NoDataError{Message: message}
+	case events.Has(gpgstatus.ImportProblem):
+		event, _ := events.Last(gpgstatus.ImportProblem)
+		reason, ok := importProblems[event.Arg(0)]
+		if !ok {
+			reason = importProblems["0"]
+		}
+		return &ImportError{Reason: reason}
+	case events.Has(gpgstatus.KeyNotCreated):
+		return &KeyNotCreatedError{Message: message}
+	case events.Has(gpgstatus.InvSgnr):
+		event, _ := events.Last(gpgstatus.InvSgnr)
+		return &KeyNotFoundError{Key: strings.TrimSuffix(event.Arg(1), "!"), Message: message}
+	case events.Has(gpgstatus.NoSgnr) || deleteProblem(events) == "1" ||
+		events.HasCode(gpgstatus.CodeNoPubkey, gpgstatus.CodeNoSeckey, gpgstatus.CodeNotFound):
+		return &KeyNotFoundError{Message: message}
+	}
+	gpgErr := &GpgError{Command: command, Message: message, Err: err}
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Keyword == gpgstatus.Error || events[i].Keyword == gpgstatus.Failure {
+			gpgErr.Location = events[i].Location()
+			gpgErr.Code = events[i].Code()
+			break
+		}
+	}
+	return gpgErr
+}
+
+// deleteProblem returns the reason of a DELETE_PROBLEM status line: 1 if the key does not exist,
+// 2 if its secret key must be deleted first and 3 if the name is ambiguous
+func deleteProblem(events gpgstatus.Events) string {
+	event, _ := events.Last(gpgstatus.DeleteProblem)
+	return event.Arg(0)
+}
+
+func containsMessage(messages []string, text string) bool {
+	for _, message := range messages {
+		if strings.Contains(message, text) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+// statusRunner answers every command with the given stderr, as written by gpg run with '--status-fd 2'
+type statusRunner struct {
+	stderr string
+	err    error
+}
+
+func (runner statusRunner) Run(command GpgCommandArgs, stdout io.Writer, stderr io.Writer) error {
+	io.WriteString(stderr, runner.stderr)
+	return runner.err
+}
+
+var errExit2 = errors.New("exit status 2")
+
+func TestGpgFailureMapsStatusToTypedErrors(t *testing.T) {
+	tests := map[string]struct {
+		stderr string
+		check  func(err error) bool
+	}{
+		"bad passphrase on signing": {
+			stderr: "[GNUPG:] KEY_CONSIDERED 0123456789ABCDEF0123456789ABCDEF01234567 2\n" +
+				"gpg: signing failed: Bad passphrase\n[GNUPG:] FAILURE sign 67108875\n",
+			check: isError[*BadPassphraseError],
+		},
+		"bad passphrase without key": {
+			stderr: "gpg: signing failed: Falsche Passphrase\n[GNUPG:] FAILURE sign 67108875\n",
+			check:  isError[*BadPassphraseError],
+		},
+		"bad passphrase on import": {
+			stderr: "gpg: key 3996F0554C1E28B1/3996F0554C1E28B1: error sending to agent: Bad passphrase\n" +
+				"gpg: import from 'backup.asc' failed: Bad passphrase\n[GNUPG:] IMPORT_RES 0 0 1 0 0 0 0 0 0 1 0 0 0 0 0\n",
+			check: isError[*BadPassphraseError],
+		},
+		"message without status": {
+			stderr: "gpg: error reading key: key not found\n",
+			check: func(err error) bool {
+				var gpgErr *GpgError
+				return errors.As(err, &gpgErr) && gpgErr.Message == "error reading key: key not found"
+			},
+		},
+		"pinentry launched": {
+			stderr: "[GNUPG:] PINENTRY_LAUNCHED 1234 curses 1.2.1 - xterm - - 0/0 0\n[GNUPG:] FAILURE sign 83918950\n",
+			check: func(err error) bool {
+				var pinentry *PinentryError
+				return errors.As(err, &pinentry) && pinentry.Launched
+			},
+		},
+		"no data": {
+			stderr: "gpg: no valid OpenPGP data found.\n[GNUPG:] NODATA 1\n[GNUPG:] IMPORT_RES 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0\n",
+			check:  isError[*NoDataError],
+		},
+		"missing key": {
+			stderr: "gpg: error reading key: No public key\n[GNUPG:] ERROR keylist.getkey 9\n",
+			check:  isError[*KeyNotFoundError],
+		},
+		"unusable signer": {
+			stderr: "[GNUPG:] INV_SGNR 9 89ABCDEF01234567!\n[GNUPG:] FAILURE sign 54\n",
+			check: func(err error) bool {
+				var notFound *KeyNotFoundError
+				return errors.As(err, &notFound) && notFound.Key == "89ABCDEF01234567"
+			},
+		},
+		"key not created": {
+			stderr: "gpg: invalid algorithm\n[GNUPG:] KEY_NOT_CREATED\n",
+			check:  isError[*KeyNotCreatedError],
+		},
+		"other failure": {
+			stderr: "gpg: something unexpected\n[GNUPG:] FAILURE gpg-exit 33554433\n",
+			check: func(err error) bool {
+				var gpgErr *GpgError
+				return errors.As(err, &gpgErr) && gpgErr.Location == "gpg-exit" && errors.Is(err, errExit2)
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			keyring := Keyring{Runner: statusRunner{stderr: test.stderr, err: errExit2}}
+			_, err := keyring.newCommand("--detach-sign").output(keyring.runner())
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !test.check(err) {
+				t.Errorf("unexpected error %T: %v", err, err)
+			}
+		})
+	}
+}
+
+func TestExportOfMissingKeyFails(t *testing.T) {
+	keyring := Keyring{Runner: statusRunner{stderr: "gpg: WARNING: nothing exported\n[GNUPG:] EXPORT_RES 0 0 0\n"}}
+	err := keyring.ExportPublicMasterKey("89ABCDEF01234567", "-")
+	var notFound *KeyNotFoundError
+	if !errors.As(err, &notFound) || notFound.Key != "89ABCDEF01234567" {
+		t.Errorf("ExportPublicMasterKey() returned %v, want a KeyNotFoundError", err)
+	}
+}
+
+func isError[T error](err error) bool {
+	var target T
+	return errors.As(err, &target)
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"io"
+)
+
+// GpgRunner runs gpg (and gpgconf) commands. The keyrings and the commands run gpg through it,
+// so that tests can replace it with a fake.
+type GpgRunner interface {
+	// Run runs the command with the given stdout and stderr, either of which may be nil to discard the output
+	Run(command GpgCommandArgs, stdout io.Writer, stderr io.Writer) error
+}
+
+// ExecRunner runs the commands with the gpg installed on the system
+type ExecRunner struct{}
+
+func (ExecRunner) Run(command GpgCommandArgs, stdout io.Writer, stderr io.Writer) error {
+	cmd, err := command.toCommand()
+	if err != nil {
+		return err
+	}
+	defer closeExtraFiles(cmd)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RevocationReason is the reason for a revocation, as numbered in the menus of 'gpg --gen-revoke' and 'revkey'
+type RevocationReason int
+
+const (
+	RevocationNoReason RevocationReason = iota
+	RevocationCompromised
+	RevocationSuperseded
+	RevocationNoLongerUsed
+)
+
+var RevocationReasons = []RevocationReason{RevocationNoReason, RevocationCompromised, RevocationSuperseded, RevocationNoLongerUsed}
+
+func (reason RevocationReason) String() string {
+	switch reason {
+	case RevocationCompromised:
+		return "compromised"
+	case RevocationSuperseded:
+		return "superseded"
+	case RevocationNoLongerUsed:
+		return "no-longer-used"
+	}
+	return "no-reason"
+}
+
+// Description returns the reason as shown by gpg
+func (reason RevocationReason) Description() string {
+	switch reason {
+	case RevocationCompromised:
+		return "Key has been compromised"
+	case RevocationSuperseded:
+		return "Key is superseded"
+	case RevocationNoLongerUsed:
+		return "Key is no longer used"
+	}
+	return "No reason specified"
+}
+
+func RevocationReasonNames() []string {
+	names := make([]string, len(RevocationReasons))
+	for i, reason := range RevocationReasons {
+		names[i] = reason.String()
+	}
+	return names
+}
+
+func ParseRevocationReason(name string) (RevocationReason, error) {
+	for _, reason := range RevocationReasons {
+		if reason.String() == strings.ToLower(name) {
+			return reason, nil
+		}
+	}
+	return RevocationNoReason, InvalidRevocationReasonError(fmt.Sprintf(
+		"unknown revocation reason '%s', must be one of: %s", name, strings.Join(RevocationReasonNames(), ", "),
+	))
+}
+
+// revocationDescriptionLines returns the answers for the description prompt of gpg,
+// which ends at the first empty line
+func revocationDescriptionLines(description string) string {
+	lines := ""
+	for _, line := range strings.Split(description, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines += line + "\n"
+		}
+	}
+	return lines + "\n"
+}
+
+// revocationCertificateCommands answers the prompts of 'gpg --gen-revoke'
+func revocationCertificateCommands(reason RevocationReason, description string) string {
+	return fmt.Sprintf("y\n%d\n%sy\n", reason, revocationDescriptionLines(description))
+}
+
+// revokeSubkeyCommands answers the prompts of 'gpg --edit-key' for revoking a single subkey
+func revokeSubkeyCommands(subkeyFingerprint string, reason RevocationReason, description string) string {
+	return fmt.Sprintf("key %s\nrevkey\ny\n%d\n%sy\nsave\n", subkeyFingerprint, reason, revocationDescriptionLines(description))
+}
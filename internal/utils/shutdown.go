@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// shutdownHooks are run (last registered first) before the program exits on a signal or through ExitProgram
+var (
+	shutdownMutex sync.Mutex
+	shutdownHooks = []*shutdownHook{}
+)
+
+type shutdownHook struct {
+	name string
+	run  func()
+}
+
+// OnShutdown registers a hook that is run when the program is terminated by SIGINT/SIGTERM or exits through ExitProgram,
+// e.g. to wipe temporary files. The returned function unregisters the hook once it is no longer needed.
+func OnShutdown(name string, run func()) func() {
+	shutdownMutex.Lock()
+	defer shutdownMutex.Unlock()
+	hook := &shutdownHook{name: name, run: run}
+	shutdownHooks = append(shutdownHooks, hook)
+	return func() {
+		shutdownMutex.Lock()
+		defer shutdownMutex.Unlock()
+		for i, registered := range shutdownHooks {
+			if registered == hook {
+				shutdownHooks = append(shutdownHooks[:i], shutdownHooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// runShutdownHooks runs and unregisters all hooks, so each one runs at most once
+func runShutdownHooks() {
+	shutdownMutex.Lock()
+	hooks := shutdownHooks
+	shutdownHooks = []*shutdownHook{}
+	shutdownMutex.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		logger.Debugf("running shutdown hook: %s\n", hooks[i].name)
+		hooks[i].run()
+	}
+}
+
+// HandleSignals traps SIGINT and SIGTERM, runs the shutdown hooks and exits with 128 + the signal number.
+// Ctrl-C inside the interactive prompts does not raise SIGINT (the terminal is in raw mode), it is returned as UserInterrupt instead.
+func HandleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		// a second signal while cleaning up terminates immediately
+		signal.Reset(syscall.SIGINT, syscall.SIGTERM)
+		fmt.Fprintf(os.Stderr, "\nReceived %s, cleaning up ...\n", sig)
+		runShutdownHooks()
+		code := 1
+		if number, ok := sig.(syscall.Signal); ok {
+			code = 128 + int(number)
+		}
+		os.Exit(code)
+	}()
+}
+
+// Exit runs the shutdown hooks and exits with the given code
+func Exit(code int) {
+	runShutdownHooks()
+	os.Exit(code)
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestShutdownHooks(t *testing.T) {
+	ran := []string{}
+	hook := func(name string) func() {
+		return func() { ran = append(ran, name) }
+	}
+	OnShutdown("remove record", hook("remove record"))
+	unregister := OnShutdown("wipe previous run", hook("wipe previous run"))
+	OnShutdown("wipe tmp dir", hook("wipe tmp dir"))
+	unregister()
+	// unregistering twice, e.g. once the step completed and again on exit, is harmless
+	unregister()
+
+	runShutdownHooks()
+	if want := []string{"wipe tmp dir", "remove record"}; !slices.Equal(ran, want) {
+		t.Errorf("ran the hooks %v, want %v", ran, want)
+	}
+	runShutdownHooks()
+	if len(ran) != 2 {
+		t.Errorf("the hooks ran again: %v", ran)
+	}
+}
@@ -1,8 +1,12 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/mail"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 )
@@ -34,6 +38,47 @@ func InvalidPassphraseError(msg string) error {
 	return &ValidationError{"passphrase", msg}
 }
 
+func InvalidAlgorithmError(msg string) error {
+	return &ValidationError{"algorithm", msg}
+}
+
+func InvalidOutputDirError(msg string) error {
+	return &ValidationError{"output directory", msg}
+}
+
+func InvalidShamirDirError(msg string) error {
+	return &ValidationError{"shares directory", msg}
+}
+
+func InvalidFingerprintError(msg string) error {
+	return &ValidationError{"fingerprint", msg}
+}
+
+func InvalidRevocationReasonError(msg string) error {
+	return &ValidationError{"revocation reason", msg}
+}
+
+func InvalidRecoveryActionError(msg string) error {
+	return &ValidationError{"action for an aborted run", msg}
+}
+
+func InvalidOutputFormatError(msg string) error {
+	return &ValidationError{"output format", msg}
+}
+
+func InvalidErrorFormatError(msg string) error {
+	return &ValidationError{"error format", msg}
+}
+
+func InvalidBatchConfigError(msg string) error {
+	return &ValidationError{"batch configuration", msg}
+}
+
+// InvalidArgumentsError is returned for arguments and flags that can not be combined or are missing
+func InvalidArgumentsError(msg string) error {
+	return &ValidationError{"arguments", msg}
+}
+
 func ValidateName(name string) error {
 	if name == "" {
 		return InvalidNameError("can not be empty")
@@ -69,3 +114,70 @@ func ValidatePassphrase(passphrase string) error {
 	}
 	return nil
 }
+
+// ValidateOutputDir ensures the directory the exported keys are written to can not be accessed by its group or other users.
+// The directory does not need to exist yet.
+func ValidateOutputDir(dir string) error {
+	return validatePrivateDir(dir, InvalidOutputDirError)
+}
+
+// ValidateShamirDir ensures the directory the shares are written to can not be accessed by its group or other users
+// and is kept apart from the output directory (if set), so that the shares never end up next to the backup they protect.
+// The directory does not need to exist yet.
+func ValidateShamirDir(dir string, outputDir string) error {
+	if err := validatePrivateDir(dir, InvalidShamirDirError); err != nil {
+		return err
+	}
+	if outputDir != "" && dirsOverlap(ExpandHome(dir), ExpandHome(outputDir)) {
+		return InvalidShamirDirError(fmt.Sprintf("'%s' must be kept apart from the output directory '%s'", dir, outputDir))
+	}
+	return nil
+}
+
+func validatePrivateDir(dir string, invalidDirError func(string) error) error {
+	if dir == "" {
+		return invalidDirError("can not be empty")
+	}
+	info, err := os.Stat(ExpandHome(dir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return invalidDirError(err.Error())
+	}
+	if !info.IsDir() {
+		return invalidDirError(fmt.Sprintf("'%s' is not a directory", dir))
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return invalidDirError(fmt.Sprintf(
+			"'%s' is accessible by its group or other users (mode %04o), restrict it with 'chmod 700 %s'", dir, info.Mode().Perm(), dir,
+		))
+	}
+	return nil
+}
+
+// dirsOverlap reports whether the directories are the same or one is inside the other
+func dirsOverlap(a string, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	inside := func(dir string, parent string) bool {
+		rel, err := filepath.Rel(parent, dir)
+		return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+	}
+	return inside(absA, absB) || inside(absB, absA)
+}
+
+// ExpandHome replaces a leading '~' of the path with the home directory of the user
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateOutputDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    os.FileMode
+		wantErr bool
+	}{
+		{name: "owner only", mode: 0700},
+		{name: "readable by group", mode: 0750, wantErr: true},
+		{name: "writable by group", mode: 0720, wantErr: true},
+		{name: "readable by others", mode: 0705, wantErr: true},
+		{name: "open to all", mode: 0777, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "backup")
+			if err := os.Mkdir(dir, 0700); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(dir, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			err := ValidateOutputDir(dir)
+			var validation *ValidationError
+			if tt.wantErr && !errors.As(err, &validation) {
+				t.Errorf("ValidateOutputDir() of a directory with mode %04o returned %v, want a ValidationError", tt.mode, err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("ValidateOutputDir() of a directory with mode %04o returned error: %v", tt.mode, err)
+			}
+		})
+	}
+}
+
+func TestValidateOutputDirAcceptsMissingDir(t *testing.T) {
+	if err := ValidateOutputDir(filepath.Join(t.TempDir(), "missing")); err != nil {
+		t.Errorf("ValidateOutputDir() of a missing directory returned error: %v", err)
+	}
+	if err := ValidateOutputDir(""); err == nil {
+		t.Error("ValidateOutputDir() of an empty path returned no error")
+	}
+}
+
+func TestValidateShamirDir(t *testing.T) {
+	parent := t.TempDir()
+	outputDir := filepath.Join(parent, "backup")
+	tests := []struct {
+		name    string
+		dir     string
+		wantErr bool
+	}{
+		{name: "apart", dir: filepath.Join(parent, "shares")},
+		{name: "prefix of the name only", dir: outputDir + "-shares"},
+		{name: "output directory", dir: outputDir, wantErr: true},
+		{name: "inside output directory", dir: filepath.Join(outputDir, "shares"), wantErr: true},
+		{name: "parent of output directory", dir: parent, wantErr: true},
+		{name: "empty", dir: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateShamirDir(tt.dir, outputDir)
+			if tt.wantErr && err == nil {
+				t.Errorf("ValidateShamirDir(%q) returned no error", tt.dir)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("ValidateShamirDir(%q) returned error: %v", tt.dir, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package wipe
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FailedFile is a file that could not be wiped, it may still be (partly) readable from disk
+type FailedFile struct {
+	Path string
+	Err  error
+}
+
+// Report lists the files that could not be wiped
+type Report struct {
+	Failed []FailedFile
+}
+
+func (report Report) OK() bool {
+	return len(report.Failed) == 0
+}
+
+func (report Report) Error() string {
+	lines := []string{"could not wipe:"}
+	for _, failed := range report.Failed {
+		lines = append(lines, fmt.Sprintf("  %s: %s", failed.Path, failed.Err))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Err returns the report as error if any file could not be wiped
+func (report Report) Err() error {
+	if report.OK() {
+		return nil
+	}
+	return report
+}
+
+// File overwrites the contents of a regular file with random data, syncs it to disk and unlinks it.
+// Note that on SSDs and copy-on-write or journaling file systems the old blocks may survive the overwrite,
+// which is why sensitive files are best kept on a RAM-backed file system in the first place.
+func File(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().IsRegular() && info.Size() > 0 {
+		if err := overwrite(path, info.Size()); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+func overwrite(path string, size int64) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := fillRandom(f, size); err != nil {
+		return err
+	}
+	// also drop the size, so the unlinked inode does not tell how large the file was
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// fillRandom overwrites the first size bytes of the file with random data and syncs it to disk
+func fillRandom(f *os.File, size int64) error {
+	if _, err := io.CopyN(f, rand.Reader, size); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// syncDir makes the removal of a directory entry durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	// syncing a directory is not supported on every platform and file system
+	if err := d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) && !errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+	return nil
+}
+
+// Dir wipes all files in the directory (see File) and removes it along with its subdirectories.
+// Sockets and other special files (e.g. of a gpg-agent) are only removed. The returned report lists what could not be wiped.
+func Dir(dir string) Report {
+	var report Report
+	if _, err := os.Lstat(dir); errors.Is(err, fs.ErrNotExist) {
+		return report
+	}
+	dirs := []string{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			report.Failed = append(report.Failed, FailedFile{Path: path, Err: err})
+			return nil
+		}
+		if entry.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		if err := File(path); err != nil {
+			report.Failed = append(report.Failed, FailedFile{Path: path, Err: err})
+		}
+		return nil
+	})
+	if err != nil {
+		report.Failed = append(report.Failed, FailedFile{Path: dir, Err: err})
+	}
+	// remove the deepest directories first
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+	for _, path := range dirs {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			report.Failed = append(report.Failed, FailedFile{Path: path, Err: err})
+		}
+	}
+	return report
+}
@@ -0,0 +1,235 @@
+package wipe
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func writeFile(t *testing.T, path string, contents []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, contents, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFillRandom(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	secret := bytes.Repeat([]byte("secret key material "), 200)
+	writeFile(t, path, secret)
+
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := fillRandom(f, int64(len(secret))); err != nil {
+		t.Fatalf("fillRandom() returned error: %v", err)
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contents) != len(secret) {
+		t.Errorf("the file has %d bytes after the overwrite, want %d", len(contents), len(secret))
+	}
+	if bytes.Contains(contents, []byte("secret key material")) {
+		t.Error("the file still holds its contents after the overwrite")
+	}
+	if bytes.Equal(contents, make([]byte, len(secret))) {
+		t.Error("the file was overwritten with zeros instead of random data")
+	}
+}
+
+func TestFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		create func(t *testing.T, path string)
+	}{
+		{
+			name:   "regular file",
+			create: func(t *testing.T, path string) { writeFile(t, path, []byte("secret key material\n")) },
+		},
+		{
+			name:   "empty file",
+			create: func(t *testing.T, path string) { writeFile(t, path, nil) },
+		},
+		{
+			name:   "missing file",
+			create: func(t *testing.T, path string) {},
+		},
+		{
+			name: "named pipe",
+			create: func(t *testing.T, path string) {
+				// opened for writing, a pipe without a reader would block
+				if err := syscall.Mkfifo(path, 0600); err != nil {
+					t.Skipf("could not create a named pipe: %v", err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file")
+			tt.create(t, path)
+			if err := File(path); err != nil {
+				t.Fatalf("File() returned error: %v", err)
+			}
+			if _, err := os.Lstat(path); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("%s still exists (%v)", path, err)
+			}
+		})
+	}
+}
+
+func TestFileTruncatesSharedInode(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret")
+	writeFile(t, path, []byte("secret key material\n"))
+	// the contents stay reachable through another name of the inode, which shows what is left on disk
+	link := filepath.Join(dir, "link")
+	if err := os.Link(path, link); err != nil {
+		t.Skipf("could not create a hard link: %v", err)
+	}
+
+	if err := File(path); err != nil {
+		t.Fatalf("File() returned error: %v", err)
+	}
+	contents, err := os.ReadFile(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contents) != 0 {
+		t.Errorf("the wiped inode still holds %d bytes: %q", len(contents), contents)
+	}
+}
+
+func TestFileOnlyRemovesSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	writeFile(t, target, []byte("not to be wiped\n"))
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := File(link); err != nil {
+		t.Fatalf("File() returned error: %v", err)
+	}
+	if _, err := os.Lstat(link); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("the symlink still exists (%v)", err)
+	}
+	if contents, err := os.ReadFile(target); err != nil || string(contents) != "not to be wiped\n" {
+		t.Errorf("the target of the symlink was changed: %q (%v)", contents, err)
+	}
+}
+
+func TestDir(t *testing.T) {
+	tests := []struct {
+		name   string
+		create func(t *testing.T, dir string)
+	}{
+		{
+			name:   "missing directory",
+			create: func(t *testing.T, dir string) {},
+		},
+		{
+			name: "empty directory",
+			create: func(t *testing.T, dir string) {
+				if err := os.Mkdir(dir, 0700); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "nested files",
+			create: func(t *testing.T, dir string) {
+				writeFile(t, filepath.Join(dir, "parameters"), []byte("Key-Type: eddsa\n"))
+				writeFile(t, filepath.Join(dir, "keys", ".private-master.gpg"), []byte("secret key material\n"))
+				writeFile(t, filepath.Join(dir, "keys", "subkeys", ".signing-subkey.gpg"), []byte("secret key material\n"))
+				if err := os.Mkdir(filepath.Join(dir, "empty"), 0700); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "socket of a gpg-agent",
+			create: func(t *testing.T, dir string) {
+				writeFile(t, filepath.Join(dir, "gnupg", "pubring.kbx"), []byte("keyring\n"))
+				listener, err := net.Listen("unix", filepath.Join(dir, "gnupg", "S.gpg-agent"))
+				if err != nil {
+					t.Skipf("could not create a socket: %v", err)
+				}
+				// keep the socket file when the listener is closed, as a killed gpg-agent does
+				listener.(*net.UnixListener).SetUnlinkOnClose(false)
+				listener.Close()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "tmp")
+			tt.create(t, dir)
+			report := Dir(dir)
+			if !report.OK() || report.Err() != nil {
+				t.Fatalf("Dir() reported: %v", report)
+			}
+			if _, err := os.Lstat(dir); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("%s still exists (%v)", dir, err)
+			}
+		})
+	}
+}
+
+func TestDirReportsFilesThatCouldNotBeWiped(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can remove files from read-only directories")
+	}
+	dir := filepath.Join(t.TempDir(), "tmp")
+	writeFile(t, filepath.Join(dir, "parameters"), []byte("Key-Type: eddsa\n"))
+	readOnly := filepath.Join(dir, "read-only")
+	writeFile(t, filepath.Join(readOnly, ".private-master.gpg"), []byte("secret key material\n"))
+	if err := os.Chmod(readOnly, 0500); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(readOnly, 0700) })
+
+	report := Dir(dir)
+	if report.OK() || report.Err() == nil {
+		t.Fatal("Dir() reported no failure for a file in a read-only directory")
+	}
+	failed := []string{}
+	for _, f := range report.Failed {
+		failed = append(failed, f.Path)
+	}
+	want := []string{filepath.Join(readOnly, ".private-master.gpg"), readOnly, dir}
+	if strings.Join(failed, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Dir() reported %v, want %v", failed, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "parameters")); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("the other files were not wiped after a failure")
+	}
+}
+
+func TestReportError(t *testing.T) {
+	report := Report{Failed: []FailedFile{
+		{Path: "/tmp/a/.private-master.gpg", Err: fs.ErrPermission},
+		{Path: "/tmp/a", Err: errors.New("directory not empty")},
+	}}
+	want := "could not wipe:\n  /tmp/a/.private-master.gpg: permission denied\n  /tmp/a: directory not empty"
+	if report.Error() != want {
+		t.Errorf("Error() = %q, want %q", report.Error(), want)
+	}
+	if (Report{}).Err() != nil {
+		t.Error("Err() of an empty report is not nil")
+	}
+}
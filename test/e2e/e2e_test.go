@@ -0,0 +1,315 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	keylist "perfect-gpg-keypair/internal/key_list"
+	openpgp "perfect-gpg-keypair/internal/openpgp"
+	tmpdir "perfect-gpg-keypair/internal/tmp_dir"
+)
+
+const testPassphrase = "correct-horse-battery-staple"
+
+// quickRandomConf makes the gpg-agent, which generates the keys, use quick (insecure) random numbers,
+// so that the tests do not wait for entropy. It is not set for gpg, which refuses to sign with such keys.
+const quickRandomConf = "debug-quick-random\n"
+
+// binaryPath is the perfect-gpg-keypair binary built for the tests
+var binaryPath string
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		fmt.Fprintln(os.Stderr, "the end-to-end tests require gpg to be installed")
+		return 1
+	}
+	dir, err := os.MkdirTemp("", "perfect-gpg-keypair-e2e-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	binaryPath = filepath.Join(dir, "perfect-gpg-keypair")
+	build := exec.Command("go", "build", "-o", binaryPath, "perfect-gpg-keypair")
+	build.Stdout = os.Stdout
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "could not build perfect-gpg-keypair: %s\n", err)
+		return 1
+	}
+	return m.Run()
+}
+
+// env is a throwaway GNUPGHOME along with the state and runtime directories of perfect-gpg-keypair,
+// so that the tests never touch the keyring or files of the user
+type env struct {
+	t              *testing.T
+	gnupgHome      string
+	stateHome      string
+	runtimeDir     string
+	passphraseFile string
+}
+
+func newEnv(t *testing.T) env {
+	t.Helper()
+	e := env{
+		t:          t,
+		gnupgHome:  t.TempDir(),
+		stateHome:  t.TempDir(),
+		runtimeDir: t.TempDir(),
+	}
+	if err := os.Chmod(e.gnupgHome, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(e.gnupgHome, "gpg-agent.conf"), []byte(quickRandomConf), 0600); err != nil {
+		t.Fatal(err)
+	}
+	e.passphraseFile = filepath.Join(t.TempDir(), "passphrase")
+	if err := os.WriteFile(e.passphraseFile, []byte(testPassphrase), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		exec.Command("gpgconf", "--homedir", e.gnupgHome, "--kill", "all").Run()
+	})
+	return e
+}
+
+func (e env) environ() []string {
+	return append(os.Environ(),
+		"GNUPGHOME="+e.gnupgHome,
+		"XDG_STATE_HOME="+e.stateHome,
+		"XDG_RUNTIME_DIR="+e.runtimeDir,
+	)
+}
+
+// run runs perfect-gpg-keypair with the given arguments and returns its output, failing the test if it fails
+func (e env) run(args ...string) string {
+	e.t.Helper()
+	return e.exec(binaryPath, args...)
+}
+
+// gpg runs gpg against the throwaway GNUPGHOME and returns its output, failing the test if it fails
+func (e env) gpg(args ...string) string {
+	e.t.Helper()
+	return e.exec("gpg", append([]string{"--batch"}, args...)...)
+}
+
+func (e env) exec(program string, args ...string) string {
+	e.t.Helper()
+	cmd := exec.Command(program, args...)
+	cmd.Env = e.environ()
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		e.t.Fatalf("'%s %s' failed: %v\nstdout:\n%s\nstderr:\n%s", filepath.Base(program), strings.Join(args, " "), err, stdout.String(), stderr.String())
+	}
+	return stdout.String()
+}
+
+// exitCode runs perfect-gpg-keypair with the given arguments and returns its exit code, failing the test if it could not be run
+func (e env) exitCode(args ...string) int {
+	e.t.Helper()
+	cmd := exec.Command(binaryPath, args...)
+	cmd.Env = e.environ()
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		e.t.Fatalf("could not run '%s': %v", strings.Join(args, " "), err)
+	}
+	return 0
+}
+
+// generate runs generate in batch mode and returns the output directory
+func (e env) generate(extraArgs ...string) string {
+	e.t.Helper()
+	outputDir := filepath.Join(e.t.TempDir(), "backup")
+	args := []string{
+		"generate", "--batch",
+		"--name", "Jane Doe", "--email", "jane@example.com", "--expiry", "1y", "--algorithm", "ed25519",
+		"--output-dir", outputDir, "--passphrase-file", e.passphraseFile,
+	}
+	e.run(append(args, extraArgs...)...)
+	return outputDir
+}
+
+// listKeys lists the (secret) keys of the throwaway keyring with 'list -o json'
+func (e env) listKeys(secret bool) []keylist.Key {
+	e.t.Helper()
+	args := []string{"list", "-o", "json"}
+	if secret {
+		args = append(args, "--secret")
+	}
+	var keys []keylist.Key
+	if err := json.Unmarshal([]byte(e.run(args...)), &keys); err != nil {
+		e.t.Fatalf("could not parse the output of 'list -o json': %v", err)
+	}
+	return keys
+}
+
+func TestGenerateListDelete(t *testing.T) {
+	e := newEnv(t)
+	outputDir := e.generate()
+
+	secretKeys := e.listKeys(true)
+	if len(secretKeys) != 1 {
+		t.Fatalf("expected 1 secret key in the keyring, got %d", len(secretKeys))
+	}
+	master := secretKeys[0]
+	assertMasterRemoved(t, e, master)
+	assertSigningSubkeyUsable(t, e, master)
+	assertExportedFilesParse(t, e, outputDir, master.Fingerprint)
+
+	e.run("delete", "--force", master.Fingerprint)
+	if keys := e.listKeys(false); len(keys) != 0 {
+		t.Errorf("expected no key to be left after delete, got %d", len(keys))
+	}
+}
+
+func TestGenerateIsolated(t *testing.T) {
+	e := newEnv(t)
+	outputDir := e.generate("--isolated")
+
+	secretKeys := e.listKeys(true)
+	if len(secretKeys) != 1 {
+		t.Fatalf("expected 1 secret key in the keyring, got %d", len(secretKeys))
+	}
+	master := secretKeys[0]
+	assertMasterRemoved(t, e, master)
+	assertSigningSubkeyUsable(t, e, master)
+	assertExportedFilesParse(t, e, outputDir, master.Fingerprint)
+}
+
+func TestVerifyExpiredBackup(t *testing.T) {
+	e := newEnv(t)
+	// a certify-only master key that expired long ago, which gpg refuses to sign with
+	e.gpg("--faked-system-time", "20200101T000000", "--pinentry-mode", "loopback", "--passphrase-file", e.passphraseFile,
+		"--quick-generate-key", "Jane Doe <jane@example.com>", "ed25519", "cert", "1d")
+	secretKeys := e.listKeys(true)
+	if len(secretKeys) != 1 {
+		t.Fatalf("expected 1 secret key in the keyring, got %d", len(secretKeys))
+	}
+	backupFilePath := filepath.Join(t.TempDir(), ".private-master.gpg")
+	e.gpg("--pinentry-mode", "loopback", "--passphrase-file", e.passphraseFile,
+		"--armor", "--output", backupFilePath, "--export-secret-keys", secretKeys[0].Fingerprint)
+
+	output := e.run("verify-backup", "--batch", "--passphrase-file", e.passphraseFile, backupFilePath)
+	if !strings.Contains(output, "the master key expired on 2020-01-02") {
+		t.Errorf("expected the expiry of the master key to be reported, got:\n%s", output)
+	}
+
+	wrongPassphraseFile := filepath.Join(t.TempDir(), "wrong-passphrase")
+	if err := os.WriteFile(wrongPassphraseFile, []byte("wrong-"+testPassphrase), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if code := e.exitCode("verify-backup", "--batch", "--passphrase-file", wrongPassphraseFile, backupFilePath); code != 4 {
+		t.Errorf("verify-backup with a wrong passphrase exited with %d, want 4", code)
+	}
+}
+
+// assertMasterRemoved checks that only a stub of the secret master key is left ('sec#'), next to the secret subkeys
+func assertMasterRemoved(t *testing.T, e env, master keylist.Key) {
+	t.Helper()
+	if master.Secret != keylist.SecretStub {
+		t.Errorf("expected the secret master key to be removed (stub), got secret status %q", master.Secret)
+	}
+	if listing := e.run("list", "--secret", "--long"); !strings.Contains(listing, "sec#") {
+		t.Errorf("expected the master key to be listed as 'sec#', got:\n%s", listing)
+	}
+	for _, subkey := range master.Subkeys {
+		if subkey.Secret != keylist.SecretAvailable {
+			t.Errorf("expected the secret part of subkey %s to be available, got %q", subkey.Fingerprint, subkey.Secret)
+		}
+	}
+}
+
+// assertSigningSubkeyUsable signs a file with the key and verifies the signature, which requires a usable signing subkey
+func assertSigningSubkeyUsable(t *testing.T, e env, master keylist.Key) {
+	t.Helper()
+	var signingSubkey *keylist.Subkey
+	for i, subkey := range master.Subkeys {
+		if subkey.HasCapability(keylist.Sign) {
+			signingSubkey = &master.Subkeys[i]
+		}
+	}
+	if signingSubkey == nil {
+		t.Fatal("the key has no signing subkey")
+	}
+	dir := t.TempDir()
+	dataFilePath := filepath.Join(dir, "data.txt")
+	signatureFilePath := dataFilePath + ".sig"
+	if err := os.WriteFile(dataFilePath, []byte("signed by the signing subkey\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	e.gpg("--pinentry-mode", "loopback", "--passphrase-file", e.passphraseFile,
+		"--local-user", master.Fingerprint, "--output", signatureFilePath, "--detach-sign", dataFilePath)
+	status := e.gpg("--status-fd", "1", "--verify", signatureFilePath, dataFilePath)
+	if !strings.Contains(status, "VALIDSIG "+signingSubkey.Fingerprint) {
+		t.Errorf("expected a valid signature of the signing subkey %s, got:\n%s", signingSubkey.Fingerprint, status)
+	}
+}
+
+// assertExportedFilesParse checks that the manifest in the output directory lists every exported file
+// and that every exported file is OpenPGP data gpg can read
+func assertExportedFilesParse(t *testing.T, e env, outputDir string, masterFingerprint string) {
+	t.Helper()
+	manifestData, err := os.ReadFile(filepath.Join(outputDir, tmpdir.ManifestFileName))
+	if err != nil {
+		t.Fatalf("could not read manifest: %v", err)
+	}
+	var manifest tmpdir.Manifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		t.Fatalf("could not parse manifest: %v", err)
+	}
+	if manifest.Fingerprint != masterFingerprint {
+		t.Errorf("manifest is of key %s, want %s", manifest.Fingerprint, masterFingerprint)
+	}
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Files) != len(entries)-1 {
+		t.Errorf("manifest lists %d files, but %d were exported", len(manifest.Files), len(entries)-1)
+	}
+	for _, entry := range entries {
+		if entry.Name() == tmpdir.ManifestFileName {
+			continue
+		}
+		filePath := filepath.Join(outputDir, entry.Name())
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyData, err := openpgp.ReadKeyData(data)
+		if err != nil {
+			t.Errorf("%s is not OpenPGP data: %v", entry.Name(), err)
+			continue
+		}
+		if _, err := openpgp.ReadPackets(keyData); err != nil {
+			t.Errorf("could not read the packets of %s: %v", entry.Name(), err)
+		}
+		e.gpg("--list-packets", filePath)
+		if strings.Contains(entry.Name(), "revocation") {
+			continue
+		}
+		if keys := e.gpg("--with-colons", "--show-keys", filePath); !strings.Contains(keys, ":"+masterFingerprint+":") {
+			t.Errorf("%s does not hold the key %s:\n%s", entry.Name(), masterFingerprint, keys)
+		}
+	}
+}
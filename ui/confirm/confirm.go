@@ -1,10 +1,12 @@
 package confirm
 
 import (
+	"errors"
 	"fmt"
 
 	huh "github.com/charmbracelet/huh"
 
+	utils "perfect-gpg-keypair/internal/utils"
 	styles "perfect-gpg-keypair/ui/styles"
 )
 
@@ -35,6 +37,9 @@ func Confirm(prompt string) (bool, error) {
 	confirm_form := createThemedConfirmForm(prompt, &choice)
 
 	if err := confirm_form.Run(); err != nil {
+		if errors.Is(err, huh.ErrUserAborted) {
+			return false, &utils.UserInterrupt{}
+		}
 		return false, fmt.Errorf("Unable to confirm user info: %w", err)
 	}
 
@@ -0,0 +1,50 @@
+package selection
+
+import (
+	"errors"
+	"fmt"
+
+	huh "github.com/charmbracelet/huh"
+
+	utils "perfect-gpg-keypair/internal/utils"
+	styles "perfect-gpg-keypair/ui/styles"
+)
+
+type Option struct {
+	Label string
+	Value string
+}
+
+func createTheme() *huh.Theme {
+	theme := huh.ThemeCharm()
+	theme.Focused.Title = styles.InfoStyle.Margin(0, 0, 0, 1)
+	theme.Focused.SelectSelector = styles.CursorStyle.SetString("> ")
+	theme.Focused.SelectedOption = styles.FocusedStyle
+	return theme
+}
+
+func createThemedSelectForm(prompt string, options []Option, choice *string) *huh.Form {
+	huhOptions := make([]huh.Option[string], len(options))
+	for i, option := range options {
+		huhOptions[i] = huh.NewOption(option.Label, option.Value)
+	}
+	selectField := huh.NewSelect[string]().
+		Title(prompt).
+		Options(huhOptions...).
+		Value(choice)
+	return huh.NewForm(huh.NewGroup(selectField)).WithTheme(createTheme())
+}
+
+func Select(prompt string, options []Option, defaultValue string) (string, error) {
+	choice := defaultValue
+	selectForm := createThemedSelectForm(prompt, options, &choice)
+
+	if err := selectForm.Run(); err != nil {
+		if errors.Is(err, huh.ErrUserAborted) {
+			return "", &utils.UserInterrupt{}
+		}
+		return "", fmt.Errorf("Unable to select option: %w", err)
+	}
+
+	return choice, nil
+}
@@ -110,3 +110,18 @@ func Spinner(m *SpinnerModel) error {
 	}
 	return nil
 }
+
+// RunWithoutTty runs the action of the spinner without rendering it,
+// for use when no terminal is available (e.g. in batch mode)
+func RunWithoutTty(m *SpinnerModel) error {
+	utils.Print(m.title)
+	switch msg := m.action().(type) {
+	case SpinnerErrMsg:
+		m.error = msg
+		return m.error
+	case ActionCompleteSpinnerMsg:
+		m.isComplete = true
+		m.actionOutput = string(msg)
+	}
+	return nil
+}
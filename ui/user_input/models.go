@@ -1,10 +1,13 @@
 package userinput
 
 import (
+	"fmt"
+	"os"
 	"strings"
 
 	textinput "github.com/charmbracelet/bubbles/textinput"
 
+	userinfo "perfect-gpg-keypair/internal/state/user_info"
 	utils "perfect-gpg-keypair/internal/utils"
 	styles "perfect-gpg-keypair/ui/styles"
 )
@@ -93,13 +96,91 @@ func NewExpiryInputModel() userInput {
 		input:           initialTextInputModel("<n>w|m|y", 4),
 		prompt:          "Please specify how long the key should be valid:",
 		helpMsg:         description,
-		defaultValue:    "1y",
+		defaultValue:    userinfo.DefaultExpiry,
 		userInterrupt:   false,
 		validator:       utils.ValidateExpiry,
 		validationError: nil,
 	}
 }
 
+func NewSubkeyExpiryInputModel(subkeyDescription string, defaultValue string) userInput {
+	description := fmt.Sprintf("Input is '<n>w|m|y', where n is an integer\nInput 0 for a subkey that never expires (NOT RECOMMENDED)\nThe default is '%s'", defaultValue)
+	return userInput{
+		input:           initialTextInputModel("<n>w|m|y", 4),
+		prompt:          fmt.Sprintf("Please specify how long the %s subkey should be valid:", subkeyDescription),
+		helpMsg:         description,
+		defaultValue:    defaultValue,
+		userInterrupt:   false,
+		validator:       utils.ValidateExpiry,
+		validationError: nil,
+	}
+}
+
+func NewRevocationDescriptionInputModel() userInput {
+	return userInput{
+		input:           initialTextInputModel("Description", 200),
+		prompt:          "Please enter an optional description of the revocation:",
+		helpMsg:         "The description is published along with the revocation, leave empty for none",
+		userInterrupt:   false,
+		validationError: nil,
+	}
+}
+
+func NewOutputDirInputModel() userInput {
+	return userInput{
+		input:  initialTextInputModel("e.g. /Volumes/USB/gpg", 200),
+		prompt: "Please enter the directory to save the exported keys to:",
+		helpMsg: "The directory is created if it does not exist and must not be accessible by its group or other users\n" +
+			"Leave empty to back up the files from the temporary directory yourself",
+		userInterrupt: false,
+		validator: func(dir string) error {
+			if dir == "" {
+				return nil
+			}
+			return utils.ValidateOutputDir(dir)
+		},
+		validationError: nil,
+	}
+}
+
+func NewShamirDirInputModel(backupDir string) userInput {
+	return userInput{
+		input:  initialTextInputModel("e.g. /Volumes/USB2/shares", 200),
+		prompt: "Please enter the directory to save the shares to:",
+		helpMsg: "Each share is saved to a directory of its own, to be handed out separately\n" +
+			"The directory must not be accessible by its group or other users and must be apart from the backup of the keys",
+		userInterrupt: false,
+		validator: func(dir string) error {
+			return utils.ValidateShamirDir(dir, backupDir)
+		},
+		validationError: nil,
+	}
+}
+
+func NewBackupLocationInputModel() userInput {
+	return userInput{
+		input:  initialTextInputModel("e.g. /Volumes/USB/gpg", 200),
+		prompt: "Please enter the directory you backed up the files to, to verify the backup:",
+		helpMsg: "The copies are checked against the exported files and the master key is test-imported\n" +
+			"Leave empty to confirm the backup without verifying it",
+		userInterrupt: false,
+		validator: func(dir string) error {
+			if dir == "" {
+				return nil
+			}
+			info, err := os.Stat(utils.ExpandHome(dir))
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return fmt.Errorf("'%s' is not a directory", dir)
+			}
+			return nil
+		},
+		validationError: nil,
+	}
+}
+
 type UserInfoInputModel struct {
 	Name   *userInput
 	Email  *userInput